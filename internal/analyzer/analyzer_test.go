@@ -0,0 +1,104 @@
+package analyzer
+
+import (
+	"alna-lang/internal/lexer"
+	"alna-lang/internal/loader"
+	"alna-lang/internal/logger"
+	"alna-lang/internal/parser"
+	"bufio"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// analyze runs an Alna program through semantic analysis, with the prelude
+// loaded the way the compiler loads it, and returns the analyzer
+func analyze(t *testing.T, source string) (*Analyzer, error) {
+	t.Helper()
+	lgr := logger.New(logger.LevelInfo, false)
+
+	tokens, sourceLines, err := lexer.NewLexer(*bufio.NewScanner(strings.NewReader(source))).Analyze()
+	if err != nil {
+		t.Fatalf("Failed to lex program: %v", err)
+	}
+	tree, err := parser.NewParser(tokens, sourceLines, lgr).Parse()
+	if err != nil {
+		t.Fatalf("Failed to parse program: %v", err)
+	}
+	if err := loader.NewLoader(lgr).Resolve(&tree, "test.alna"); err != nil {
+		t.Fatalf("Failed to resolve includes: %v", err)
+	}
+
+	semantic := NewAnalyzer(&tree, sourceLines, lgr)
+	return semantic, semantic.Analyze()
+}
+
+// errorTest is a program that must fail analysis with message, reported at
+// line and column
+type errorTest struct {
+	name    string
+	source  string
+	message string
+	line    int
+	column  int
+}
+
+func runErrorTests(t *testing.T, tests []errorTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := analyze(t, tt.source)
+			if err == nil {
+				t.Fatalf("Expected the error %q", tt.message)
+			}
+			if !strings.Contains(err.Error(), "Compiler Error:\033[0m "+tt.message+"\n") {
+				t.Errorf("Expected the error %q, got:\n%s", tt.message, err)
+			}
+			if at := fmt.Sprintf("At line %d, column %d", tt.line, tt.column); !strings.Contains(err.Error(), at) {
+				t.Errorf("Expected the error %s, got:\n%s", at, err)
+			}
+		})
+	}
+}
+
+const genericFunctions = `
+T pick<T>(a: T, b: T) {
+  return a
+}
+
+int size<T>(xs: array<T>, extra: int) {
+  return extra
+}
+`
+
+func TestGenericInference(t *testing.T) {
+	source := genericFunctions + `
+int main() {
+  string word = pick("a", "b")
+  int n = pick(1, 2)
+  array<bool> flags = pick([true], [false])
+  return size(["x"], n)
+}`
+	if _, err := analyze(t, source); err != nil {
+		t.Errorf("Expected the type arguments to be inferred, got:\n%v", err)
+	}
+}
+
+func TestGenericErrors(t *testing.T) {
+	runErrorTests(t, []errorTest{
+		{"conflicting inference", genericFunctions + `
+int main() {
+  int n = pick(1, "x")
+  return n
+}`, "cannot infer type parameter T of 'pick': argument 2 is string, but T was inferred as int", 11, 10},
+		{"substituted parameter", genericFunctions + `
+int main() {
+  return size([1], "x")
+}`, "argument 2 of 'size' must be int, got string (with T = int)", 11, 9},
+		{"instantiated return type", genericFunctions + `
+int main() {
+  int n = pick("a", "b")
+  return n
+}`, "cannot initialize 'n' of type int with a value of type string", 11, 10},
+	})
+}
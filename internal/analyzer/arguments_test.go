@@ -0,0 +1,66 @@
+package analyzer
+
+import (
+	"alna-lang/internal/ast"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+const volume = `
+int vol(w: int, h: int = 1, d: int = 1) {
+  return w * h * d
+}
+`
+
+// TestArgumentsAreResolved checks that named arguments are put in parameter
+// order and left out parameters get their defaults, which is what codegen
+// passes by position
+func TestArgumentsAreResolved(t *testing.T) {
+	tests := []struct {
+		call     string
+		expected []string
+	}{
+		{"vol(4)", []string{"4", "1", "1"}},
+		{"vol(4, 5)", []string{"4", "5", "1"}},
+		{"vol(4, d: 5)", []string{"4", "1", "5"}},
+		{"vol(d: 2, h: 3, w: 4)", []string{"4", "3", "2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.call, func(t *testing.T) {
+			semantic, err := analyze(t, volume+"\nint main() {\n  return "+tt.call+"\n}")
+			if err != nil {
+				t.Fatalf("Failed analysis: %v", err)
+			}
+
+			var arguments []string
+			ast.Walk(*semantic.ast, func(node ast.Node) bool {
+				if call, isCall := node.(ast.FunctionCallNode); isCall && call.Name == "vol" {
+					for _, arg := range call.PositionalArguments() {
+						number, _ := arg.(ast.NumberNode)
+						arguments = append(arguments, fmt.Sprint(number.Value))
+					}
+				}
+				return true
+			})
+			if !slices.Equal(arguments, tt.expected) {
+				t.Errorf("Expected the arguments %v, got %v", tt.expected, arguments)
+			}
+		})
+	}
+}
+
+func TestArgumentErrors(t *testing.T) {
+	call := func(call string) string {
+		return fmt.Sprintf("%s\nint main() {\n  return %s\n}", volume, call)
+	}
+	runErrorTests(t, []errorTest{
+		{"duplicate", call("vol(2, d: 3, d: 4)"), "parameter 'd' of 'vol' is passed more than once", 7, 22},
+		{"named and positional", call("vol(2, w: 3)"), "parameter 'w' of 'vol' is passed more than once", 7, 16},
+		{"unknown", call("vol(2, z: 3)"), "function 'vol' has no parameter named 'z'", 7, 16},
+		{"positional after named", call("vol(h: 3, 2)"), "positional arguments must come before named arguments", 7, 19},
+		{"missing", call("vol(h: 3)"), "missing argument for parameter 'w' of 'vol'", 7, 9},
+		{"too many", call("vol(1, 2, 3, 4)"), "function 'vol' expects 3 arguments, got 4", 7, 9},
+	})
+}
@@ -0,0 +1,145 @@
+package analyzer
+
+import (
+	"alna-lang/internal/ast"
+	"math"
+	"strconv"
+)
+
+// foldConstant evaluates the initializer of constant name to a literal.
+// Constants are inlined wherever they are used, so an initializer that would
+// trap at runtime is reported here instead of on every use. Int arithmetic
+// overflowing is an error too, as the wrapped value is never what was meant.
+func (a *Analyzer) foldConstant(name string, expr ast.Node) (ast.Node, error) {
+	switch node := expr.(type) {
+	case ast.NumberNode, ast.BooleanNode, ast.StringNode:
+		return node, nil
+	case ast.IdentifierNode:
+		if value, isConstant := a.constants[node.Name]; isConstant {
+			return value, nil
+		}
+	case ast.BinaryOpNode:
+		left, err := a.foldConstant(name, node.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := a.foldConstant(name, node.Right)
+		if err != nil {
+			return nil, err
+		}
+		return a.foldOperator(name, node, left, right)
+	}
+	return nil, a.errorAt(expr, "the value of constant '%s' must be known at compile time", name)
+}
+
+// foldOperator applies the operator of node to the folded literals on each
+// side of it
+func (a *Analyzer) foldOperator(name string, node ast.BinaryOpNode, left, right ast.Node) (ast.Node, error) {
+	op := node.Operator.Value
+	switch l := left.(type) {
+	case ast.NumberNode:
+		r, ok := right.(ast.NumberNode)
+		if !ok {
+			break
+		}
+		x, _ := strconv.ParseInt(l.Value.(string), 10, 64)
+		y, _ := strconv.ParseInt(r.Value.(string), 10, 64)
+		var result int64
+		switch op {
+		case "+":
+			result = x + y
+			if (x^result)&(y^result) < 0 {
+				return nil, a.errorAt(node, "int overflow in the value of constant '%s': %d + %d", name, x, y)
+			}
+		case "-":
+			result = x - y
+			if (x^y)&(x^result) < 0 {
+				return nil, a.errorAt(node, "int overflow in the value of constant '%s': %d - %d", name, x, y)
+			}
+		case "*":
+			result = x * y
+			if x != 0 && (result/x != y || (x == -1 && y == math.MinInt64)) {
+				return nil, a.errorAt(node, "int overflow in the value of constant '%s': %d * %d", name, x, y)
+			}
+		case "/", "%":
+			if y == 0 {
+				return nil, a.errorAt(node, "division by zero in the value of constant '%s': %d %s 0", name, x, op)
+			}
+			if op == "%" {
+				result = x % y
+			} else if x == math.MinInt64 && y == -1 {
+				return nil, a.errorAt(node, "int overflow in the value of constant '%s': %d / %d", name, x, y)
+			} else {
+				result = x / y
+			}
+		case "==":
+			return ast.BooleanNode{Value: x == y, Position: node.Position}, nil
+		case "!=":
+			return ast.BooleanNode{Value: x != y, Position: node.Position}, nil
+		case "<":
+			return ast.BooleanNode{Value: x < y, Position: node.Position}, nil
+		case "<=":
+			return ast.BooleanNode{Value: x <= y, Position: node.Position}, nil
+		case ">":
+			return ast.BooleanNode{Value: x > y, Position: node.Position}, nil
+		case ">=":
+			return ast.BooleanNode{Value: x >= y, Position: node.Position}, nil
+		default:
+			return nil, a.errorAt(node, "operator '%s' cannot be used in the value of constant '%s'", op, name)
+		}
+		return ast.NumberNode{Value: strconv.FormatInt(result, 10), Position: node.Position}, nil
+	case ast.BooleanNode:
+		r, ok := right.(ast.BooleanNode)
+		if !ok {
+			break
+		}
+		y := r.Value
+		switch op {
+		case "&&":
+			return ast.BooleanNode{Value: l.Value && y, Position: node.Position}, nil
+		case "||":
+			return ast.BooleanNode{Value: l.Value || y, Position: node.Position}, nil
+		case "==":
+			return ast.BooleanNode{Value: l.Value == y, Position: node.Position}, nil
+		case "!=":
+			return ast.BooleanNode{Value: l.Value != y, Position: node.Position}, nil
+		}
+	case ast.StringNode:
+		r, ok := right.(ast.StringNode)
+		if !ok {
+			break
+		}
+		y := r.Value
+		switch op {
+		case "+":
+			return ast.StringNode{Value: l.Value + y, Position: node.Position}, nil
+		case "==":
+			return ast.BooleanNode{Value: l.Value == y, Position: node.Position}, nil
+		case "!=":
+			return ast.BooleanNode{Value: l.Value != y, Position: node.Position}, nil
+		}
+	}
+	return nil, a.errorAt(node, "operator '%s' cannot be used in the value of constant '%s'", op, name)
+}
+
+// checkIntLiterals reports the first int literal in the program that does
+// not fit in an int, which is 64 bits
+func (a *Analyzer) checkIntLiterals() error {
+	var err error
+	for _, node := range a.ast.Children {
+		ast.Walk(node, func(node ast.Node) bool {
+			number, isNumber := node.(ast.NumberNode)
+			if err != nil || !isNumber {
+				return err == nil
+			}
+			if _, parseErr := strconv.ParseInt(number.Value.(string), 10, 64); parseErr != nil {
+				err = a.errorAt(number, "int literal %s is out of range, ints go up to %d", number.Value, int64(math.MaxInt64))
+			}
+			return true
+		})
+		if err != nil {
+			return a.compilerError(node, err)
+		}
+	}
+	return nil
+}
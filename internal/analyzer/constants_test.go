@@ -0,0 +1,90 @@
+package analyzer
+
+import (
+	"alna-lang/internal/ast"
+	"testing"
+)
+
+// TestConstantsAreFolded checks that the initializer of a constant is
+// replaced by its value, which codegen inlines where the constant is used
+func TestConstantsAreFolded(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected ast.Node
+	}{
+		{"const int x = 6 * 7", ast.NumberNode{Value: "42"}},
+		{"const int x = 7 / 2 - 10 % 4", ast.NumberNode{Value: "1"}},
+		{"const int base = 3\nconst int x = base * base", ast.NumberNode{Value: "9"}},
+		{"const bool x = 2 < 3 && 1 != 1", ast.BooleanNode{Value: false}},
+		{`const string x = "al" + "na"`, ast.StringNode{Value: "alna"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			semantic, err := analyze(t, tt.source)
+			if err != nil {
+				t.Fatalf("Failed analysis: %v", err)
+			}
+
+			children := semantic.ast.Children
+			declaration := children[len(children)-1].(ast.VariableDeclarationNode)
+			var value any
+			switch node := declaration.Initializer.(type) {
+			case ast.NumberNode:
+				value = node.Value
+			case ast.BooleanNode:
+				value = node.Value
+			case ast.StringNode:
+				value = node.Value
+			}
+			var expected any
+			switch node := tt.expected.(type) {
+			case ast.NumberNode:
+				expected = node.Value
+			case ast.BooleanNode:
+				expected = node.Value
+			case ast.StringNode:
+				expected = node.Value
+			}
+			if declaration.Initializer.NodeType() != tt.expected.NodeType() || value != expected {
+				t.Errorf("Expected the value %v, got %#v", expected, declaration.Initializer)
+			}
+		})
+	}
+}
+
+func TestConstantErrors(t *testing.T) {
+	runErrorTests(t, []errorTest{
+		{"division by zero", `
+const int x = 1 / 0`, "division by zero in the value of constant 'x': 1 / 0", 2, 14},
+		{"remainder by zero", `
+const int zero = 0
+const int x = 5 % zero`, "division by zero in the value of constant 'x': 5 % 0", 3, 14},
+		{"overflow", `
+const int x = 9223372036854775807 + 1`, "int overflow in the value of constant 'x': 9223372036854775807 + 1", 2, 14},
+		{"not known at compile time", `
+int limit = 3
+const int x = limit + 1`, "the value of constant 'x' must be known at compile time", 3, 14},
+		{"inside a function", `
+int main() {
+  const int x = 1
+  return x
+}`, "constant 'x' must be declared at the top level", 3, 2},
+	})
+}
+
+func TestIntLiteralRange(t *testing.T) {
+	runErrorTests(t, []errorTest{
+		{"too large", `
+int main() {
+  return 9223372036854775808
+}`, "int literal 9223372036854775808 is out of range, ints go up to 9223372036854775807", 3, 9},
+		{"default value", `
+int get(n: int = 99999999999999999999) {
+  return n
+}`, "int literal 99999999999999999999 is out of range, ints go up to 9223372036854775807", 2, 17},
+	})
+	if _, err := analyze(t, "int main() {\n  return 9223372036854775807\n}"); err != nil {
+		t.Errorf("Expected the largest int to be accepted, got:\n%v", err)
+	}
+}
@@ -0,0 +1,15 @@
+package analyzer
+
+import "testing"
+
+func TestFormatSpecErrors(t *testing.T) {
+	source := func(spec string) string {
+		return "\nint main() {\n  string s = format(1, \"" + spec + "\")\n  return 0\n}"
+	}
+	runErrorTests(t, []errorTest{
+		{"unexpected", source("z"), `invalid format spec "z": unexpected "z"`, 3, 23},
+		{"width too large", source("5000"), `invalid format spec "5000": width must be at most 1000`, 3, 23},
+		{"width out of range", source("99999999999999999999"), `invalid format spec "99999999999999999999": width must be at most 1000`, 3, 23},
+		{"precision on an int", source(".2"), "precision is not allowed for int values", 3, 23},
+	})
+}
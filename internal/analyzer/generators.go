@@ -0,0 +1,75 @@
+package analyzer
+
+import (
+	"alna-lang/internal/ast"
+	"alna-lang/internal/symbol_table"
+	"alna-lang/internal/types"
+)
+
+// analyzeFor checks that a for-in loop iterates over an array or a
+// generator. The name it declares holds each value in the body alone.
+func (a *Analyzer) analyzeFor(n ast.ForNode, st *symboltable.SymbolTable) error {
+	if err := a.analyzeBinaryExpression(n.Iterable, st); err != nil {
+		return err
+	}
+	iterableType, err := a.inferType(n.Iterable, st)
+	if err != nil {
+		return err
+	}
+	valueType, isIterable := types.Iterated(iterableType)
+	if !isIterable {
+		return a.errorAt(n.Iterable, "for-in expects an array or a generator, got %s", iterableType)
+	}
+
+	bodySt := symboltable.NewSymbolTable(st, false)
+	bodySt.Parent = st
+	// The scope is new, so the name cannot be declared in it already
+	_ = bodySt.Declare(symboltable.VariableInfo{Name: n.Binding.Name, Type: valueType, Position: n.Binding.Position})
+	return a.analyzeExpression(n.Body, bodySt)
+}
+
+// analyzeYield checks that a yield hands out values of the type the
+// generator it is in produces
+func (a *Analyzer) analyzeYield(n ast.YieldNode, st *symboltable.SymbolTable) error {
+	fn := a.currentFunction
+	if fn == nil {
+		return a.errorAt(n, "yield outside of a function")
+	}
+	generated, _ := types.Generated(fn.ReturnType)
+
+	if err := a.analyzeBinaryExpression(n.Value, st); err != nil {
+		return err
+	}
+	valueType, err := a.inferType(n.Value, st)
+	if err != nil {
+		return err
+	}
+	if !types.Assignable(generated, valueType) {
+		return a.errorAt(n.Value, "generator '%s' yields %s, got %s%s", fn.Name, generated, valueType, unwrapHint(generated, valueType))
+	}
+	return nil
+}
+
+// checkGenerator checks that a function that yields, which makes it a
+// generator, returns the generator type of the values it yields
+func (a *Analyzer) checkGenerator(fn ast.FunctionDeclarationNode) error {
+	if _, isGenerator := types.Generated(fn.ReturnType); !isGenerator {
+		return a.errorAt(fn, "'%s' yields values, so it must return gen<T>, got %s", fn.Name, fn.ReturnType)
+	}
+	return nil
+}
+
+// hasYield reports whether a function body has yield statements of its own
+func hasYield(body ast.BlockNode) bool {
+	found := false
+	ast.Walk(body, func(node ast.Node) bool {
+		switch node.(type) {
+		case ast.YieldNode:
+			found = true
+		case ast.FunctionLiteralNode:
+			return false
+		}
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,32 @@
+package analyzer
+
+import "testing"
+
+func TestGlobalsDeclaredAfterFunctions(t *testing.T) {
+	source := `
+int get() {
+  return limit + step
+}
+
+int limit = 5
+const int step = 2
+
+int main() {
+  return get()
+}`
+	if _, err := analyze(t, source); err != nil {
+		t.Errorf("Expected functions to see globals declared after them, got:\n%v", err)
+	}
+}
+
+func TestGlobalErrors(t *testing.T) {
+	runErrorTests(t, []errorTest{
+		{"used before its declaration", `
+int early = later
+int later = 2`, "undefined variable 'later'", 2, 12},
+		{"undefined in a function", `
+int get() {
+  return missing
+}`, "undefined variable 'missing'", 3, 9},
+	})
+}
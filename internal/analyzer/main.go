@@ -6,38 +6,239 @@ import (
 	"alna-lang/internal/common"
 	"alna-lang/internal/logger"
 	"alna-lang/internal/symbol_table"
+	"alna-lang/internal/types"
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
 )
 
+type functionSignature struct {
+	TypeParams []string
+	Params     []string
+	ReturnType string
+	// ParamNames and Defaults are only known for declared functions. A nil
+	// default marks a parameter every call must pass.
+	ParamNames []string
+	Defaults   []ast.Node
+}
+
 type Analyzer struct {
-	ast         *ast.RootNode
-	SymbolTable *symboltable.SymbolTable
-	sourceLines []string
-	logger      *logger.Logger
+	ast             *ast.RootNode
+	SymbolTable     *symboltable.SymbolTable
+	sourceLines     []string
+	logger          *logger.Logger
+	functions       map[string]functionSignature
+	currentFunction *ast.FunctionDeclarationNode
+	// generator is set while analyzing a function that yields
+	generator bool
+	// valueBranchDepth counts the if expressions whose branches are being
+	// analyzed for their value, where returning is not allowed
+	valueBranchDepth int
+	// typeParams are the type parameters of the generic functions enclosing
+	// the code being analyzed
+	typeParams []string
+	// calls holds the declared functions each declared function calls
+	calls map[string][]string
+	// constants holds the folded value of each constant
+	constants map[string]ast.Node
+	// Warnings are the problems found in the program that do not stop it
+	// from compiling
+	Warnings []Warning
+}
+
+// semanticError is an analysis error tied to the node that caused it, so the
+// reported source excerpt points at the offending code instead of the whole
+// top-level declaration.
+type semanticError struct {
+	Position common.Position
+	Message  string
+	Fix      *common.Fix
+}
+
+func (e semanticError) Error() string {
+	return e.Message
+}
+
+// Warning is a problem in the code of a function that does not stop the
+// program from compiling
+type Warning struct {
+	Function string
+	Position common.Position
+	Message  string
 }
 
 func NewAnalyzer(tree *ast.RootNode, srcLines []string, lgr *logger.Logger) *Analyzer {
 	tree.SymbolTable = symboltable.NewSymbolTable(nil, true)
-	return &Analyzer{ast: tree, SymbolTable: symboltable.NewSymbolTable(nil, true), sourceLines: srcLines, logger: lgr}
+	return &Analyzer{
+		ast:         tree,
+		SymbolTable: symboltable.NewSymbolTable(nil, true),
+		sourceLines: srcLines,
+		logger:      lgr,
+		functions:   make(map[string]functionSignature),
+		constants:   make(map[string]ast.Node),
+	}
 }
 
 func (a *Analyzer) Analyze() error {
+	for _, builtin := range builtins.GetBuiltins() {
+		a.functions[builtin.Name] = functionSignature{TypeParams: builtin.TypeParams, Params: builtin.Params, ReturnType: builtin.ReturnType}
+	}
+
+	if err := a.checkIntLiterals(); err != nil {
+		return err
+	}
+
+	// Functions are registered up front so they can be called before their
+	// declaration and recursively
 	for _, expr := range a.ast.Children {
+		if fn, ok := expr.(ast.FunctionDeclarationNode); ok {
+			if err := a.declareFunction(fn, a.SymbolTable); err != nil {
+				return a.compilerError(expr, err)
+			}
+		}
+	}
+
+	a.calls = callGraph(a.ast.Children)
+
+	// The top-level statements run in order before main, so each of them only
+	// sees the globals declared before it. Function bodies are analyzed once
+	// every global is declared, since they can only run after the globals
+	// they use are.
+	var functions []ast.Node
+	for i, expr := range a.ast.Children {
+		if _, ok := expr.(ast.FunctionDeclarationNode); ok {
+			functions = append(functions, expr)
+			continue
+		}
+		if err := a.analyzeExpression(expr, a.SymbolTable); err != nil {
+			return a.compilerError(expr, err)
+		}
+		if n, ok := expr.(ast.VariableDeclarationNode); ok && n.Constant {
+			n.Initializer = a.constants[n.Name]
+			a.ast.Children[i] = n
+		}
+	}
+	for _, expr := range functions {
 		if err := a.analyzeExpression(expr, a.SymbolTable); err != nil {
-			panic(common.CompilerError(expr.Pos(), err.Error(), a.sourceLines))
+			return a.compilerError(expr, err)
 		}
 	}
 
 	return nil
 }
 
+func (a *Analyzer) compilerError(expr ast.Node, err error) error {
+	var semErr semanticError
+	if errors.As(err, &semErr) {
+		if semErr.Fix != nil {
+			return common.CompilerErrorWithFix(semErr.Position, semErr.Message, *semErr.Fix, a.sourceLines)
+		}
+		return common.CompilerError(semErr.Position, semErr.Message, a.sourceLines)
+	}
+	return common.CompilerError(expr.Pos(), err.Error(), a.sourceLines)
+}
+
+func (a *Analyzer) errorAt(node ast.Node, format string, args ...any) error {
+	return semanticError{Position: node.Pos(), Message: fmt.Sprintf(format, args...)}
+}
+
+// errorWithFix is like errorAt, with a suggested fix for the error
+func (a *Analyzer) errorWithFix(node ast.Node, fix common.Fix, format string, args ...any) error {
+	return semanticError{Position: node.Pos(), Message: fmt.Sprintf(format, args...), Fix: &fix}
+}
+
+func (a *Analyzer) declareFunction(fn ast.FunctionDeclarationNode, st *symboltable.SymbolTable) error {
+	if err := st.Insert(fn.Name, "function"); err != nil {
+		return a.errorAt(fn, "function '%s' is already declared", fn.Name)
+	}
+
+	if _, _, isBuiltin := builtins.Lookup(fn.Name); isBuiltin {
+		return a.errorAt(fn, "function '%s' shadows a builtin function", fn.Name)
+	}
+
+	for i, typeParam := range fn.TypeParameters {
+		if slices.Contains(fn.TypeParameters[:i], typeParam) {
+			return a.errorAt(fn, "duplicate type parameter '%s' in function '%s'", typeParam, fn.Name)
+		}
+	}
+
+	// Declared functions are the only ones that can return several values
+	returnTypes := []string{fn.ReturnType}
+	if elems, isTuple := types.TupleTypes(fn.ReturnType); isTuple {
+		returnTypes = elems
+	}
+	for _, returnType := range returnTypes {
+		if returnType == types.Void && len(returnTypes) == 1 {
+			continue
+		}
+		if err := validateType(returnType, fn.TypeParameters); err != nil {
+			return a.errorAt(fn, "invalid return type of '%s': %v", fn.Name, err)
+		}
+	}
+
+	signature := functionSignature{TypeParams: fn.TypeParameters, ReturnType: fn.ReturnType}
+	for _, param := range fn.Parameters {
+		if err := validateType(param.Type, fn.TypeParameters); err != nil {
+			return a.errorAt(fn, "invalid type of parameter '%s': %v", param.Name, err)
+		}
+		if param.Default != nil {
+			if err := a.checkDefault(param, st); err != nil {
+				return err
+			}
+		}
+		signature.Params = append(signature.Params, param.Type)
+		signature.ParamNames = append(signature.ParamNames, param.Name)
+		signature.Defaults = append(signature.Defaults, param.Default)
+	}
+	a.functions[fn.Name] = signature
+
+	return nil
+}
+
+// checkDefault checks the default value of a parameter. Default values are
+// copied into the calls that leave the parameter out, so they are limited to
+// literals and operators, which mean the same in every scope.
+func (a *Analyzer) checkDefault(param ast.FunctionParam, st *symboltable.SymbolTable) error {
+	if bad, ok := literalExpression(param.Default); !ok {
+		return a.errorAt(bad, "the default value of parameter '%s' must be built from literals", param.Name)
+	}
+
+	defaultType, err := a.inferType(param.Default, st)
+	if err != nil {
+		return err
+	}
+	if !types.Assignable(param.Type, defaultType) {
+		return a.errorAt(param.Default, "the default value of parameter '%s' must be %s, got %s", param.Name, param.Type, defaultType)
+	}
+	return nil
+}
+
+// literalExpression reports whether expr is built from literals and
+// operators, returning the first node that is not when it isn't
+func literalExpression(expr ast.Node) (ast.Node, bool) {
+	switch node := expr.(type) {
+	case ast.NumberNode, ast.BooleanNode, ast.StringNode, ast.NoneNode:
+		return nil, true
+	case ast.BinaryOpNode:
+		if bad, ok := literalExpression(node.Left); !ok {
+			return bad, false
+		}
+		return literalExpression(node.Right)
+	default:
+		return expr, false
+	}
+}
+
 func (a *Analyzer) analyzeExpression(node ast.Node, st *symboltable.SymbolTable) error {
 	switch n := node.(type) {
 	case ast.IfExpressionNode:
-		if err := a.analyzeBinaryExpression(n.Condition, st); err != nil {
+		thenSt, err := a.analyzeIfCondition(n, st)
+		if err != nil {
 			return err
 		}
-		if err := a.analyzeExpression(n.ThenBranch, st); err != nil {
+		if err := a.analyzeExpression(n.ThenBranch, thenSt); err != nil {
 			return err
 		}
 		if n.ElseBranch != nil {
@@ -74,41 +275,159 @@ func (a *Analyzer) analyzeExpression(node ast.Node, st *symboltable.SymbolTable)
 			}
 		}
 	case ast.VariableDeclarationNode:
-		st.Insert(n.Name, n.Type)
+		if err := validateType(n.Type, a.typeParams); err != nil {
+			return a.errorAt(n, "invalid type of variable '%s': %v", n.Name, err)
+		}
+
+		// Values of a type parameter have no zero value
+		if n.Initializer == nil && slices.Contains(a.typeParams, n.Type) {
+			return a.errorAt(n, "variable '%s' of type parameter type %s must be initialized", n.Name, n.Type)
+		}
+
+		if n.Initializer == nil && types.IsFunction(n.Type) {
+			return a.errorAt(n, "variable '%s' of function type %s must be initialized", n.Name, n.Type)
+		}
+
+		if _, isGenerator := types.Generated(n.Type); n.Initializer == nil && isGenerator {
+			return a.errorAt(n, "variable '%s' of generator type %s must be initialized", n.Name, n.Type)
+		}
+
+		if n.Initializer != nil {
+			if err := a.analyzeBinaryExpression(n.Initializer, st); err != nil {
+				return err
+			}
+			initType, err := a.inferType(n.Initializer, st)
+			if err != nil {
+				return err
+			}
+			if !types.Assignable(n.Type, initType) {
+				return a.errorAt(n.Initializer, "cannot initialize '%s' of type %s with a value of type %s%s", n.Name, n.Type, initType, unwrapHint(n.Type, initType))
+			}
+		}
+
+		if n.Constant {
+			return a.declareConstant(n, st)
+		}
+
+		if err := st.Declare(symboltable.VariableInfo{Name: n.Name, Type: n.Type, Mutable: n.Mutable, Position: n.Position}); err != nil {
+			return a.errorAt(n, "variable '%s' is already declared in this scope", n.Name)
+		}
 	case ast.AssignmentNode:
 		var varName string
 		switch n.Left.(type) {
 		case ast.IdentifierNode:
 			varName = n.Left.(ast.IdentifierNode).Name
 		default:
-			return fmt.Errorf("invalid assignment target at position %+v", n.Left.Pos())
+			return a.errorAt(n.Left, "invalid assignment target")
+		}
+
+		varInfo, exists := st.Lookup(varName)
+		if !exists {
+			return a.errorAt(n.Left, "undefined variable '%s'", varName)
+		}
+
+		if varInfo.Type == "function" {
+			return a.errorAt(n.Left, "cannot assign to function '%s'", varName)
+		}
+
+		if err := a.checkAssignable(n.Left, varInfo); err != nil {
+			return err
 		}
 
-		if _, exists := st.Lookup(varName); !exists {
-			return fmt.Errorf("undefined variable '%s' at position %+v", varName, n.Left.Pos())
+		if err := a.analyzeBinaryExpression(n.Right, st); err != nil {
+			return err
 		}
 
-		if err := a.analyzeExpression(n.Right, st); err != nil {
+		valueType, err := a.inferType(n.Right, st)
+		if err != nil {
 			return err
 		}
-	case ast.BinaryOpNode, ast.NumberNode, ast.BooleanNode, ast.IdentifierNode:
+		if !types.Assignable(varInfo.Type, valueType) {
+			return a.errorAt(n.Right, "cannot assign a value of type %s to '%s' of type %s%s", valueType, varName, varInfo.Type, unwrapHint(varInfo.Type, valueType))
+		}
+	case ast.DestructuringNode:
+		return a.analyzeDestructuring(n, st)
+	case ast.BinaryOpNode, ast.NumberNode, ast.BooleanNode, ast.IdentifierNode, ast.StringNode, ast.NoneNode,
+		ast.ArrayLiteralNode, ast.IndexNode, ast.FunctionCallNode, ast.FunctionLiteralNode, ast.TryNode:
 		return a.analyzeBinaryExpression(node, st)
 	case ast.FunctionDeclarationNode:
-		st.Insert(n.Name, "function")
-		newSt := symboltable.NewSymbolTable(st, false)
-		newSt.Parent = st
-		a.logger.Debug("Entering new function scope for '%s'", n.Name)
-	case ast.FunctionCallNode:
-		if _, exists := st.Lookup(n.Name); !exists {
-			if _, exists := builtins.GetBuiltins()[n.Name]; !exists {
-				return fmt.Errorf("undefined function '%s' at position %+v", n.Name, n.Pos())
+		if _, declared := a.functions[n.Name]; !declared {
+			if err := a.declareFunction(n, st); err != nil {
+				return err
 			}
 		}
-		for _, arg := range n.Arguments {
-			if err := a.analyzeBinaryExpression(arg, st); err != nil {
-				return err
+
+		return a.analyzeFunctionBody(n, st)
+	case ast.ReturnNode:
+		if a.currentFunction == nil {
+			return a.errorAt(n, "return outside of a function")
+		}
+
+		if a.valueBranchDepth > 0 {
+			return a.errorAt(n, "cannot return from an if expression whose value is used")
+		}
+
+		// A return ends a generator, whose values are the ones it yields
+		if a.generator {
+			if n.Value != nil {
+				return a.errorAt(n.Value, "generator '%s' cannot return a value, yield it instead", a.currentFunction.Name)
 			}
+			return nil
 		}
+
+		returnType := a.currentFunction.ReturnType
+		if n.Value == nil {
+			if returnType != types.Void {
+				return a.errorAt(n, "function '%s' must return a value of type %s", a.currentFunction.Name, returnType)
+			}
+			return nil
+		}
+
+		if returnType == types.Void {
+			return a.errorAt(n.Value, "void function '%s' cannot return a value", a.currentFunction.Name)
+		}
+
+		valueTypes, err := a.inferValueTypes(n.Value, st)
+		if err != nil {
+			return err
+		}
+
+		returnTypes := []string{returnType}
+		if elems, isTuple := types.TupleTypes(returnType); isTuple {
+			returnTypes = elems
+		}
+		if len(valueTypes) != len(returnTypes) {
+			return a.errorAt(n.Value, "function '%s' returns %s, got %s", a.currentFunction.Name, plural(len(returnTypes), "value"), plural(len(valueTypes), "value"))
+		}
+		if len(returnTypes) == 1 && !types.Assignable(returnType, valueTypes[0]) {
+			return a.errorAt(n.Value, "function '%s' returns %s, got %s%s", a.currentFunction.Name, returnType, valueTypes[0], unwrapHint(returnType, valueTypes[0]))
+		}
+		for i, valueType := range valueTypes {
+			if !types.Assignable(returnTypes[i], valueType) {
+				return a.errorAt(valueAt(n.Value, i), "value %d returned from '%s' must be %s, got %s", i+1, a.currentFunction.Name, returnTypes[i], valueType)
+			}
+		}
+		a.checkTailCall(n, st)
+	case ast.DeferNode:
+		if a.currentFunction == nil {
+			return a.errorAt(n, "defer can only be used inside a function")
+		}
+		return a.analyzeFunctionCall(n.Call, st)
+	case ast.SpawnNode:
+		if _, _, isBuiltin := builtins.Lookup(n.Call.Name); isBuiltin {
+			if _, isVariable := st.Lookup(n.Call.Name); !isVariable {
+				return a.errorAt(n.Call, "spawn expects a function written in Alna, '%s' is a builtin", n.Call.Name)
+			}
+		}
+		return a.analyzeFunctionCall(n.Call, st)
+	case ast.SelectNode:
+		return a.analyzeSelect(n, st)
+	case ast.ForNode:
+		return a.analyzeFor(n, st)
+	case ast.YieldNode:
+		return a.analyzeYield(n, st)
+	case ast.IncludeNode:
+		return a.errorAt(n, "include is only allowed at the top level of a file")
 	default:
 		a.logger.Warn("Unknown expression type: %T at position %+v", node, node.Pos())
 	}
@@ -122,11 +441,13 @@ func (a *Analyzer) analyzeBinaryExpression(expr ast.Node, st *symboltable.Symbol
 		return nil
 	case ast.BooleanNode:
 		return nil
-	case ast.IdentifierNode:
-		if _, exists := st.Lookup(node.Name); !exists {
-			return fmt.Errorf("undefined variable '%s' at position %+v", node.Name, node.Pos())
-		}
+	case ast.StringNode:
+		return nil
+	case ast.NoneNode:
 		return nil
+	case ast.IdentifierNode:
+		_, err := a.inferType(node, st)
+		return err
 	case ast.BinaryOpNode:
 		if err := a.analyzeBinaryExpression(node.Left, st); err != nil {
 			return err
@@ -137,22 +458,652 @@ func (a *Analyzer) analyzeBinaryExpression(expr ast.Node, st *symboltable.Symbol
 
 		_, err := a.inferType(node, st)
 		return err
+	case ast.ArrayLiteralNode:
+		for _, element := range node.Elements {
+			if err := a.analyzeBinaryExpression(element, st); err != nil {
+				return err
+			}
+		}
+
+		_, err := a.inferType(node, st)
+		return err
+	case ast.IndexNode:
+		if err := a.analyzeBinaryExpression(node.Target, st); err != nil {
+			return err
+		}
+		if err := a.analyzeBinaryExpression(node.Index, st); err != nil {
+			return err
+		}
+
+		_, err := a.inferType(node, st)
+		return err
+	case ast.FunctionCallNode:
+		return a.analyzeFunctionCall(node, st)
+	case ast.TryNode:
+		if err := a.analyzeBinaryExpression(node.Value, st); err != nil {
+			return err
+		}
+
+		_, err := a.inferType(node, st)
+		return err
+	case ast.IfExpressionNode:
+		_, err := a.analyzeIfValue(node, st)
+		return err
+	case ast.FunctionLiteralNode:
+		if _, err := a.inferType(node, st); err != nil {
+			return err
+		}
+		return a.analyzeFunctionBody(ast.FunctionDeclarationNode{
+			Name:       "<anonymous>",
+			Parameters: node.Parameters,
+			ReturnType: node.ReturnType,
+			Body:       node.Body,
+			Position:   node.Position,
+		}, st)
 	default:
 		return fmt.Errorf("unknown expression type: %T at position %+v", node, node.Pos())
 	}
 }
 
+// analyzeDestructuring checks that a destructuring assignment has a value for
+// each of its targets, then declares the targets or checks that the values
+// can be assigned to them. The type of a declared target is the type of its
+// value.
+func (a *Analyzer) analyzeDestructuring(n ast.DestructuringNode, st *symboltable.SymbolTable) error {
+	valueTypes, err := a.inferValueTypes(n.Value, st)
+	if err != nil {
+		return err
+	}
+	if len(valueTypes) != len(n.Targets) {
+		return a.errorAt(n, "cannot assign %s to %s", plural(len(valueTypes), "value"), plural(len(n.Targets), "name"))
+	}
+
+	for i, target := range n.Targets {
+		if target.Name == "_" {
+			continue
+		}
+
+		valueType := valueTypes[i]
+		if n.Declare {
+			if parsed, err := types.Parse(valueType); err != nil || mentionsAny(parsed) || parsed.Name == types.None {
+				return a.errorAt(valueAt(n.Value, i), "cannot infer the type of '%s' from a value of type %s, declare it with a type instead", target.Name, valueType)
+			}
+			// The position of the whole assignment is where mut goes
+			if err := st.Declare(symboltable.VariableInfo{Name: target.Name, Type: valueType, Mutable: n.Mutable, Position: n.Position}); err != nil {
+				return a.errorAt(target, "variable '%s' is already declared in this scope", target.Name)
+			}
+			continue
+		}
+
+		info, exists := st.Lookup(target.Name)
+		if !exists {
+			return a.errorAt(target, "undefined variable '%s'", target.Name)
+		}
+		if info.Type == "function" {
+			return a.errorAt(target, "cannot assign to function '%s'", target.Name)
+		}
+		if err := a.checkAssignable(target, info); err != nil {
+			return err
+		}
+		if !types.Assignable(info.Type, valueType) {
+			return a.errorAt(valueAt(n.Value, i), "cannot assign a value of type %s to '%s' of type %s%s", valueType, target.Name, info.Type, unwrapHint(info.Type, valueType))
+		}
+	}
+	return nil
+}
+
+// inferValueTypes analyzes the values of a return or a destructuring
+// assignment and returns their types. A call to a function that returns
+// several values produces all of them.
+func (a *Analyzer) inferValueTypes(node ast.Node, st *symboltable.SymbolTable) ([]string, error) {
+	switch n := node.(type) {
+	case ast.ValueListNode:
+		valueTypes := make([]string, len(n.Values))
+		for i, value := range n.Values {
+			if err := a.analyzeBinaryExpression(value, st); err != nil {
+				return nil, err
+			}
+			valueType, err := a.inferType(value, st)
+			if err != nil {
+				return nil, err
+			}
+			valueTypes[i] = valueType
+		}
+		return valueTypes, nil
+	case ast.FunctionCallNode:
+		if err := a.analyzeFunctionCall(n, st); err != nil {
+			return nil, err
+		}
+		call, err := a.resolveArguments(n, st)
+		if err != nil {
+			return nil, err
+		}
+		signature, err := a.lookupFunction(call, st)
+		if err != nil {
+			return nil, err
+		}
+		if elems, isTuple := types.TupleTypes(signature.ReturnType); isTuple {
+			return elems, nil
+		}
+	default:
+		if err := a.analyzeBinaryExpression(node, st); err != nil {
+			return nil, err
+		}
+	}
+
+	valueType, err := a.inferType(node, st)
+	if err != nil {
+		return nil, err
+	}
+	return []string{valueType}, nil
+}
+
+// valueAt returns the node of the i-th value of a return or destructuring
+// assignment, which is the whole value when it is a single call
+func valueAt(node ast.Node, i int) ast.Node {
+	if list, isList := node.(ast.ValueListNode); isList {
+		return list.Values[i]
+	}
+	return node
+}
+
+// mentionsAny reports whether t is or contains the any type, which cannot
+// be written in source and so cannot be the type of a variable
+func mentionsAny(t *types.Type) bool {
+	if t.Name == types.Any {
+		return true
+	}
+	return slices.ContainsFunc(t.Args, mentionsAny)
+}
+
+// unwrapHint returns the advice appended to a type error where an optional
+// is used as the type it holds, which is empty for other type errors
+func unwrapHint(expected, actual string) string {
+	held, isOptional := types.OptionalType(actual)
+	if !isOptional || !types.Assignable(expected, held) {
+		return ""
+	}
+	return ", unwrap it with 'is some' or '??' first"
+}
+
+// plural returns count followed by noun, which gets an s unless count is one
+func plural(count int, noun string) string {
+	if count == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	return fmt.Sprintf("%d %ss", count, noun)
+}
+
+// checkAssignable reports an error when target names a variable that cannot
+// be assigned to, suggesting how to fix the declaration where possible
+func (a *Analyzer) checkAssignable(target ast.Node, info symboltable.VariableInfo) error {
+	switch {
+	case info.Mutable:
+		return nil
+	case info.Constant:
+		return a.errorAt(target, "cannot assign to constant '%s'", info.Name)
+	case info.Parameter:
+		return a.errorWithFix(target, common.Fix{
+			Position: info.Position,
+			Message:  fmt.Sprintf("parameters are immutable; copy '%s' into a variable declared with mut instead", info.Name),
+		}, "cannot assign to parameter '%s'", info.Name)
+	default:
+		return a.errorWithFix(target, common.Fix{
+			Position: info.Position,
+			Message:  fmt.Sprintf("declare '%s' with mut to make it mutable", info.Name),
+			Insert:   "mut ",
+		}, "cannot assign to immutable variable '%s'", info.Name)
+	}
+}
+
+// declareConstant declares a const, whose initializer has already been
+// checked against its type. The initializer is folded to a literal, which
+// Analyze puts in its place so codegen inlines the value itself.
+func (a *Analyzer) declareConstant(n ast.VariableDeclarationNode, st *symboltable.SymbolTable) error {
+	if !st.Global {
+		return a.errorAt(n, "constant '%s' must be declared at the top level", n.Name)
+	}
+
+	value, err := a.foldConstant(n.Name, n.Initializer)
+	if err != nil {
+		return err
+	}
+
+	if err := st.Declare(symboltable.VariableInfo{Name: n.Name, Type: n.Type, Constant: true, Position: n.Position}); err != nil {
+		return a.errorAt(n, "variable '%s' is already declared in this scope", n.Name)
+	}
+	a.constants[n.Name] = value
+	return nil
+}
+
+// analyzeFunctionBody analyzes the body of a declared or anonymous function
+// in a new scope holding its parameters. The scope's parent is st, so the
+// body of a function literal can use the variables around it.
+func (a *Analyzer) analyzeFunctionBody(fn ast.FunctionDeclarationNode, st *symboltable.SymbolTable) error {
+	newSt := symboltable.NewSymbolTable(st, false)
+	newSt.Parent = st
+	a.logger.Debug("Entering new function scope for '%s'", fn.Name)
+
+	for _, param := range fn.Parameters {
+		if err := newSt.Declare(symboltable.VariableInfo{Name: param.Name, Type: param.Type, Parameter: true, Position: param.Position}); err != nil {
+			return a.errorAt(fn, "duplicate parameter '%s' in function '%s'", param.Name, fn.Name)
+		}
+	}
+
+	generator := hasYield(fn.Body)
+	if generator {
+		if err := a.checkGenerator(fn); err != nil {
+			return err
+		}
+	}
+
+	enclosingFunction, enclosingDepth, enclosingTypeParams, enclosingGenerator := a.currentFunction, a.valueBranchDepth, a.typeParams, a.generator
+	a.currentFunction, a.valueBranchDepth, a.generator = &fn, 0, generator
+	a.typeParams = append(slices.Clone(a.typeParams), fn.TypeParameters...)
+	defer func() {
+		a.currentFunction, a.valueBranchDepth, a.typeParams, a.generator = enclosingFunction, enclosingDepth, enclosingTypeParams, enclosingGenerator
+	}()
+
+	fn.Body.SymbolTable = newSt
+	for _, expr := range fn.Body.Expressions {
+		if err := a.analyzeExpression(expr, newSt); err != nil {
+			return err
+		}
+	}
+
+	if fn.ReturnType != types.Void && !generator && !returns(fn.Body) {
+		var end ast.Node = fn
+		if len(fn.Body.Expressions) > 0 {
+			end = fn.Body.Expressions[len(fn.Body.Expressions)-1]
+		}
+		return a.errorAt(end, "function '%s' must return a value of type %s on every path", fn.Name, fn.ReturnType)
+	}
+	return nil
+}
+
+// returns reports whether running block always ends in a return statement.
+// The value of a block is never returned implicitly, so this is how every
+// path of a function that is not void returns a value.
+func returns(block ast.BlockNode) bool {
+	if len(block.Expressions) == 0 {
+		return false
+	}
+	switch last := block.Expressions[len(block.Expressions)-1].(type) {
+	case ast.ReturnNode:
+		return true
+	case ast.BlockNode:
+		return returns(last)
+	case ast.IfExpressionNode:
+		return last.ElseBranch != nil && branchReturns(last.ThenBranch) && branchReturns(last.ElseBranch)
+	case ast.SelectNode:
+		if last.Else == nil && len(last.Cases) == 0 {
+			return false
+		}
+		for _, c := range last.Cases {
+			if !returns(c.Body) {
+				return false
+			}
+		}
+		return last.Else == nil || returns(*last.Else)
+	}
+	return false
+}
+
+// branchReturns is returns for the branches of an if, which are blocks or,
+// for else if, another if
+func branchReturns(branch ast.Node) bool {
+	switch branch := branch.(type) {
+	case ast.BlockNode:
+		return returns(branch)
+	case ast.IfExpressionNode:
+		return returns(ast.BlockNode{Expressions: []ast.Node{branch}})
+	}
+	return false
+}
+
+// resolveArguments matches the named arguments of a call to the parameters of
+// the declared function it calls, and fills in the default values of the
+// parameters it leaves out. The returned call passes every argument by
+// position, in parameter order, and its arguments are recorded in the call
+// for code generation.
+func (a *Analyzer) resolveArguments(call ast.FunctionCallNode, st *symboltable.SymbolTable) (ast.FunctionCallNode, error) {
+	firstNamed := slices.IndexFunc(call.Arguments, func(arg ast.Node) bool {
+		_, isNamed := arg.(ast.NamedArgumentNode)
+		return isNamed
+	})
+
+	// Function values and builtins have no parameter names or defaults
+	if info, declared := st.Lookup(call.Name); declared && info.Type != "function" {
+		if firstNamed >= 0 {
+			return call, a.errorAt(call.Arguments[firstNamed], "named arguments cannot be passed to the function value '%s'", call.Name)
+		}
+		return call, nil
+	}
+	if _, _, isBuiltin := builtins.Lookup(call.Name); isBuiltin {
+		if firstNamed >= 0 {
+			return call, a.errorAt(call.Arguments[firstNamed], "builtin function '%s' does not take named arguments", call.Name)
+		}
+		return call, nil
+	}
+	signature, exists := a.functions[call.Name]
+	if !exists {
+		return call, nil
+	}
+
+	arguments := make([]ast.Node, len(signature.Params))
+	for i, arg := range call.Arguments {
+		named, isNamed := arg.(ast.NamedArgumentNode)
+		if !isNamed {
+			if firstNamed >= 0 && i > firstNamed {
+				return call, a.errorAt(arg, "positional arguments must come before named arguments")
+			}
+			if i >= len(arguments) {
+				return call, a.errorAt(call, "function '%s' expects %d arguments, got %d", call.Name, len(signature.Params), len(call.Arguments))
+			}
+			arguments[i] = arg
+			continue
+		}
+
+		index := slices.Index(signature.ParamNames, named.Name)
+		if index < 0 {
+			return call, a.errorAt(arg, "function '%s' has no parameter named '%s'", call.Name, named.Name)
+		}
+		if arguments[index] != nil {
+			return call, a.errorAt(arg, "parameter '%s' of '%s' is passed more than once", named.Name, call.Name)
+		}
+		arguments[index] = named.Value
+	}
+
+	hasDefaults := slices.ContainsFunc(signature.Defaults, func(value ast.Node) bool { return value != nil })
+	for i := range arguments {
+		if arguments[i] != nil {
+			continue
+		}
+		if signature.Defaults[i] == nil {
+			if firstNamed < 0 && !hasDefaults {
+				return call, a.errorAt(call, "function '%s' expects %d arguments, got %d", call.Name, len(signature.Params), len(call.Arguments))
+			}
+			return call, a.errorAt(call, "missing argument for parameter '%s' of '%s'", signature.ParamNames[i], call.Name)
+		}
+		arguments[i] = signature.Defaults[i]
+	}
+
+	if call.Resolved != nil {
+		*call.Resolved = arguments
+	}
+	call.Arguments = arguments
+	return call, nil
+}
+
+// lookupFunction returns the signature of the function called name. This is
+// either a declared function, or a variable holding a function value, which
+// takes precedence when it shadows a declared function.
+func (a *Analyzer) lookupFunction(call ast.FunctionCallNode, st *symboltable.SymbolTable) (functionSignature, error) {
+	if info, declared := st.Lookup(call.Name); declared && info.Type != "function" {
+		params, returnType, isFunction := types.Signature(info.Type)
+		if !isFunction {
+			return functionSignature{}, a.errorAt(call, "'%s' is a variable of type %s, not a function", call.Name, info.Type)
+		}
+		return functionSignature{Params: params, ReturnType: returnType}, nil
+	}
+
+	signature, exists := a.functions[call.Name]
+	if !exists {
+		return functionSignature{}, a.errorAt(call, "undefined function '%s'", call.Name)
+	}
+
+	if len(signature.TypeParams) > 0 {
+		return a.instantiate(call, signature, st)
+	}
+	return signature, nil
+}
+
+// instantiate infers the type arguments of a call to a generic function from
+// the types of its arguments and returns the signature with the type
+// parameters substituted. Generic functions are compiled once: values of any
+// type share the VM's uniform representation, so no specialized copies of
+// the function are generated.
+func (a *Analyzer) instantiate(call ast.FunctionCallNode, signature functionSignature, st *symboltable.SymbolTable) (functionSignature, error) {
+	if len(call.Arguments) != len(signature.Params) {
+		return functionSignature{}, a.errorAt(call, "function '%s' expects %d arguments, got %d", call.Name, len(signature.Params), len(call.Arguments))
+	}
+
+	bindings := make(map[string]string)
+	for i, arg := range call.Arguments {
+		argType, err := a.inferType(arg, st)
+		if err != nil {
+			return functionSignature{}, err
+		}
+
+		previous := maps.Clone(bindings)
+		if typeParam, ok := types.Infer(signature.Params[i], argType, signature.TypeParams, bindings); !ok {
+			if typeParam != "" {
+				return functionSignature{}, a.errorAt(call, "cannot infer type parameter %s of '%s': argument %d is %s, but %s was inferred as %s",
+					typeParam, call.Name, i+1, argType, typeParam, previous[typeParam])
+			}
+			message := fmt.Sprintf("argument %d of '%s' must be %s, got %s", i+1, call.Name, types.Substitute(signature.Params[i], bindings), argType)
+			if len(bindings) > 0 {
+				message += fmt.Sprintf(" (with %s)", formatBindings(signature.TypeParams, bindings))
+			}
+			return functionSignature{}, a.errorAt(call, "%s", message)
+		}
+	}
+
+	for _, typeParam := range signature.TypeParams {
+		if _, isBound := bindings[typeParam]; !isBound {
+			return functionSignature{}, a.errorAt(call, "cannot infer type parameter %s of '%s' from its arguments", typeParam, call.Name)
+		}
+	}
+	a.logger.Debug("Instantiated '%s' with %s", call.Name, formatBindings(signature.TypeParams, bindings))
+
+	instance := functionSignature{ReturnType: types.Substitute(signature.ReturnType, bindings)}
+	for _, param := range signature.Params {
+		instance.Params = append(instance.Params, types.Substitute(param, bindings))
+	}
+	return instance, nil
+}
+
+// formatBindings describes the type arguments inferred for a generic call,
+// as in "T = int, U = string"
+func formatBindings(typeParams []string, bindings map[string]string) string {
+	parts := make([]string, 0, len(typeParams))
+	for _, typeParam := range typeParams {
+		if bound, isBound := bindings[typeParam]; isBound {
+			parts = append(parts, fmt.Sprintf("%s = %s", typeParam, bound))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (a *Analyzer) analyzeCondition(condition ast.Node, st *symboltable.SymbolTable) error {
+	if err := a.analyzeBinaryExpression(condition, st); err != nil {
+		return err
+	}
+	conditionType, err := a.inferType(condition, st)
+	if err != nil {
+		return err
+	}
+	if !types.Assignable("bool", conditionType) {
+		return a.errorAt(condition, "if condition must be bool, got %s%s", conditionType, unwrapHint("bool", conditionType))
+	}
+	return nil
+}
+
+// analyzeIfCondition analyzes the condition of an if and returns the scope of
+// its then branch. An if unwrapping an optional declares the value it holds
+// in a scope of its own, which only the then branch sees.
+func (a *Analyzer) analyzeIfCondition(n ast.IfExpressionNode, st *symboltable.SymbolTable) (*symboltable.SymbolTable, error) {
+	if n.Binding == nil {
+		return st, a.analyzeCondition(n.Condition, st)
+	}
+
+	if err := a.analyzeBinaryExpression(n.Condition, st); err != nil {
+		return nil, err
+	}
+	conditionType, err := a.inferType(n.Condition, st)
+	if err != nil {
+		return nil, err
+	}
+	held, isOptional := types.OptionalType(conditionType)
+	if !isOptional {
+		return nil, a.errorAt(n.Condition, "'is some' expects an optional, got %s", conditionType)
+	}
+
+	newSt := symboltable.NewSymbolTable(st, false)
+	newSt.Parent = st
+	// The scope is new, so the name cannot be declared in it already
+	_ = newSt.Declare(symboltable.VariableInfo{Name: n.Binding.Name, Type: held, Position: n.Binding.Position})
+	return newSt, nil
+}
+
+// analyzeIfValue analyzes an if expression whose value is used, such as the
+// initializer of a variable, and returns the type its branches unify to. The
+// value of a branch is the value of the last expression of its block.
+func (a *Analyzer) analyzeIfValue(n ast.IfExpressionNode, st *symboltable.SymbolTable) (string, error) {
+	if n.ElseBranch == nil {
+		return "", a.errorAt(n, "an if expression used as a value must have an else branch")
+	}
+
+	thenSt, err := a.analyzeIfCondition(n, st)
+	if err != nil {
+		return "", err
+	}
+
+	a.valueBranchDepth++
+	defer func() { a.valueBranchDepth-- }()
+
+	thenType, err := a.analyzeBranchValue(n.ThenBranch, thenSt)
+	if err != nil {
+		return "", err
+	}
+	elseType, err := a.analyzeBranchValue(n.ElseBranch, st)
+	if err != nil {
+		return "", err
+	}
+
+	valueType, ok := types.Unify(thenType, elseType)
+	if !ok {
+		return "", a.errorAt(n, "if branches have different types: %s and %s", thenType, elseType)
+	}
+	return valueType, nil
+}
+
+func (a *Analyzer) analyzeBranchValue(branch ast.Node, st *symboltable.SymbolTable) (string, error) {
+	switch b := branch.(type) {
+	case ast.IfExpressionNode:
+		return a.analyzeIfValue(b, st)
+	case ast.BlockNode:
+		newSt := symboltable.NewSymbolTable(st, false)
+		newSt.Parent = st
+
+		last := len(b.Expressions) - 1
+		for _, expr := range b.Expressions[:last] {
+			if err := a.analyzeExpression(expr, newSt); err != nil {
+				return "", err
+			}
+		}
+
+		value := b.Expressions[last]
+		if !isValueExpression(value) {
+			return "", a.errorAt(value, "the last expression of an if branch used as a value must produce a value")
+		}
+		if err := a.analyzeBinaryExpression(value, newSt); err != nil {
+			return "", err
+		}
+		return a.inferType(value, newSt)
+	default:
+		return "", fmt.Errorf("unknown if branch type: %T at position %+v", branch, branch.Pos())
+	}
+}
+
+// isValueExpression reports whether node produces a value, as opposed to
+// statements such as declarations, assignments and returns
+func isValueExpression(node ast.Node) bool {
+	switch node.(type) {
+	case ast.NumberNode, ast.BooleanNode, ast.StringNode, ast.NoneNode, ast.IdentifierNode, ast.BinaryOpNode,
+		ast.ArrayLiteralNode, ast.IndexNode, ast.FunctionCallNode, ast.IfExpressionNode, ast.FunctionLiteralNode,
+		ast.TryNode:
+		return true
+	default:
+		return false
+	}
+}
+
+func (a *Analyzer) analyzeFunctionCall(call ast.FunctionCallNode, st *symboltable.SymbolTable) error {
+	call, err := a.resolveArguments(call, st)
+	if err != nil {
+		return err
+	}
+
+	signature, err := a.lookupFunction(call, st)
+	if err != nil {
+		return err
+	}
+
+	if len(call.Arguments) != len(signature.Params) {
+		return a.errorAt(call, "function '%s' expects %d arguments, got %d", call.Name, len(signature.Params), len(call.Arguments))
+	}
+
+	for i, arg := range call.Arguments {
+		if err := a.analyzeBinaryExpression(arg, st); err != nil {
+			return err
+		}
+
+		argType, err := a.inferType(arg, st)
+		if err != nil {
+			return err
+		}
+		if !types.Assignable(signature.Params[i], argType) {
+			return a.errorAt(arg, "argument %d of '%s' must be %s, got %s%s", i+1, call.Name, signature.Params[i], argType, unwrapHint(signature.Params[i], argType))
+		}
+	}
+
+	// Specs written as literals, which include those of interpolations, are
+	// checked here instead of failing at runtime
+	if call.Name == "format" && len(call.Arguments) == 2 {
+		if spec, isLiteral := call.Arguments[1].(ast.StringNode); isLiteral {
+			parsed, err := builtins.ParseFormatSpec(spec.Value)
+			if err != nil {
+				return a.errorAt(spec, "%v", err)
+			}
+			if valueType, _ := a.inferType(call.Arguments[0], st); valueType == "int" && parsed.Precision >= 0 {
+				return a.errorAt(spec, "precision is not allowed for int values")
+			}
+		}
+	}
+
+	return nil
+}
+
 func (a *Analyzer) inferType(expr ast.Node, st *symboltable.SymbolTable) (string, error) {
 	switch node := expr.(type) {
 	case ast.NumberNode:
 		return "int", nil
 	case ast.BooleanNode:
 		return "bool", nil
+	case ast.StringNode:
+		return "string", nil
+	case ast.NoneNode:
+		return types.None, nil
 	case ast.IdentifierNode:
-		if varInfo, exists := st.Lookup(node.Name); exists {
-			return varInfo.Type, nil
+		varInfo, exists := st.Lookup(node.Name)
+		if !exists {
+			if _, _, isBuiltin := builtins.Lookup(node.Name); isBuiltin {
+				return "", a.errorAt(node, "builtin function '%s' cannot be used as a value", node.Name)
+			}
+			return "", a.errorAt(node, "undefined variable '%s'", node.Name)
 		}
-		return "", fmt.Errorf("undefined variable '%s' at position %+v", node.Name, node.Pos())
+		if varInfo.Type == "function" {
+			signature := a.functions[node.Name]
+			if len(signature.TypeParams) > 0 {
+				return "", a.errorAt(node, "generic function '%s' cannot be used as a value", node.Name)
+			}
+			if _, isTuple := types.TupleTypes(signature.ReturnType); isTuple {
+				return "", a.errorAt(node, "function '%s' returns several values and cannot be used as a value", node.Name)
+			}
+			return types.NewFunction(signature.Params, signature.ReturnType), nil
+		}
+		return varInfo.Type, nil
 	case ast.BinaryOpNode:
 		leftType, err := a.inferType(node.Left, st)
 		if err != nil {
@@ -162,15 +1113,233 @@ func (a *Analyzer) inferType(expr ast.Node, st *symboltable.SymbolTable) (string
 		if err != nil {
 			return "", err
 		}
-		if leftType != rightType {
-			return "", fmt.Errorf("type mismatch: %s vs %s at position %+v", leftType, rightType, node.Pos())
+		return a.inferBinaryOpType(node, leftType, rightType)
+	case ast.ArrayLiteralNode:
+		if len(node.Elements) == 0 {
+			return "array<any>", nil
+		}
+
+		elementType, err := a.inferType(node.Elements[0], st)
+		if err != nil {
+			return "", err
+		}
+		for _, element := range node.Elements[1:] {
+			otherType, err := a.inferType(element, st)
+			if err != nil {
+				return "", err
+			}
+			if types.Assignable(elementType, otherType) {
+				continue
+			}
+			// Mixing values with none makes an array of optionals
+			unified, ok := types.Unify(elementType, otherType)
+			if !ok || !optionalOperand(unified) {
+				return "", a.errorAt(element, "array elements must all be %s, got %s", elementType, otherType)
+			}
+			elementType = unified
+		}
+		return fmt.Sprintf("array<%s>", elementType), nil
+	case ast.IndexNode:
+		targetType, err := a.inferType(node.Target, st)
+		if err != nil {
+			return "", err
+		}
+		keyType, isContainer := types.Key(targetType)
+		if !isContainer {
+			return "", a.errorAt(node.Target, "cannot index into a value of type %s", targetType)
+		}
+
+		indexType, err := a.inferType(node.Index, st)
+		if err != nil {
+			return "", err
+		}
+		if !types.Assignable(keyType, indexType) {
+			return "", a.errorAt(node.Index, "index must be %s, got %s", keyType, indexType)
+		}
+
+		elementType, _ := types.Elem(targetType)
+		return elementType, nil
+	case ast.FunctionCallNode:
+		call, err := a.resolveArguments(node, st)
+		if err != nil {
+			return "", err
 		}
-		return leftType, nil
+		signature, err := a.lookupFunction(call, st)
+		if err != nil {
+			return "", err
+		}
+		if signature.ReturnType == types.Void {
+			return "", a.errorAt(node, "function '%s' returns void and cannot be used as a value", node.Name)
+		}
+		if elems, isTuple := types.TupleTypes(signature.ReturnType); isTuple {
+			return "", a.errorAt(node, "function '%s' returns %d values, which can only be destructured or returned", node.Name, len(elems))
+		}
+		return signature.ReturnType, nil
+	case ast.TryNode:
+		return a.inferTryType(node, st)
+	case ast.IfExpressionNode:
+		return a.analyzeIfValue(node, st)
+	case ast.FunctionLiteralNode:
+		params := make([]string, len(node.Parameters))
+		for i, param := range node.Parameters {
+			if param.Default != nil {
+				return "", a.errorAt(param.Default, "default values are only allowed in function declarations")
+			}
+			if err := validateType(param.Type, a.typeParams); err != nil {
+				return "", a.errorAt(node, "invalid type of parameter '%s': %v", param.Name, err)
+			}
+			params[i] = param.Type
+		}
+		if node.ReturnType != types.Void {
+			if err := validateType(node.ReturnType, a.typeParams); err != nil {
+				return "", a.errorAt(node, "invalid return type of function literal: %v", err)
+			}
+		}
+		return types.NewFunction(params, node.ReturnType), nil
 	default:
 		return "", fmt.Errorf("unknown expression type: %T at position %+v", node, node.Pos())
 	}
 }
 
+// inferTryType returns the value type of the result a ? operator unwraps.
+// Its error is returned from the enclosing function, which must therefore
+// return a result whose error type can hold it.
+func (a *Analyzer) inferTryType(node ast.TryNode, st *symboltable.SymbolTable) (string, error) {
+	if a.currentFunction == nil {
+		return "", a.errorAt(node, "the ? operator can only be used inside a function")
+	}
+
+	resultType, err := a.inferType(node.Value, st)
+	if err != nil {
+		return "", err
+	}
+	valueType, errorType, isResult := types.ResultTypes(resultType)
+	if !isResult {
+		return "", a.errorAt(node.Value, "the ? operator expects a Result, got %s", resultType)
+	}
+
+	fn := a.currentFunction
+	_, returnedErrorType, returnsResult := types.ResultTypes(fn.ReturnType)
+	if !returnsResult {
+		return "", a.errorAt(node, "the ? operator can only be used in a function that returns a Result, but '%s' returns %s", fn.Name, fn.ReturnType)
+	}
+	if !types.Assignable(returnedErrorType, errorType) {
+		return "", a.errorAt(node, "cannot propagate an error of type %s from '%s', which returns %s", errorType, fn.Name, fn.ReturnType)
+	}
+	return valueType, nil
+}
+
+func (a *Analyzer) inferBinaryOpType(node ast.BinaryOpNode, leftType, rightType string) (string, error) {
+	mismatch := a.errorAt(node, "type mismatch: %s %s %s", leftType, node.Operator.Value, rightType)
+	if optionalOperand(leftType) || optionalOperand(rightType) {
+		mismatch = a.errorAt(node, "type mismatch: %s %s %s, unwrap optionals with 'is some' or '??' first", leftType, node.Operator.Value, rightType)
+	}
+
+	switch node.Operator.Value {
+	case "+":
+		if types.Assignable("string", leftType) && types.Assignable("string", rightType) && (leftType == "string" || rightType == "string") {
+			return "string", nil
+		}
+		fallthrough
+	case "-", "*", "/", "%":
+		if types.Assignable("int", leftType) && types.Assignable("int", rightType) {
+			return "int", nil
+		}
+		return "", mismatch
+	case "<", "<=", ">", ">=":
+		if types.Assignable("int", leftType) && types.Assignable("int", rightType) {
+			return "bool", nil
+		}
+		return "", mismatch
+	case "==", "!=":
+		if types.Assignable(leftType, rightType) || types.Assignable(rightType, leftType) {
+			return "bool", nil
+		}
+		return "", mismatch
+	case "??":
+		if leftType == types.None {
+			return rightType, nil
+		}
+		held, isOptional := types.OptionalType(leftType)
+		if !isOptional {
+			return "", a.errorAt(node.Left, "the left side of ?? must be an optional, got %s", leftType)
+		}
+		// A default that is itself optional keeps the result optional
+		if types.Assignable(held, rightType) {
+			return held, nil
+		}
+		if types.Assignable(leftType, rightType) {
+			return leftType, nil
+		}
+		return "", a.errorAt(node.Right, "the default of ?? must be %s, got %s", held, rightType)
+	case "&&", "||":
+		if types.Assignable("bool", leftType) && types.Assignable("bool", rightType) {
+			return "bool", nil
+		}
+		return "", mismatch
+	default:
+		return "", a.errorAt(node, "unknown operator '%s'", node.Operator.Value)
+	}
+}
+
+// optionalOperand reports whether an operand of type name is an optional or
+// none, which operators other than ==, != and ?? do not accept
+func optionalOperand(name string) bool {
+	_, isOptional := types.OptionalType(name)
+	return isOptional || name == types.None
+}
+
+// validateType checks that a declared type names a known type and that
+// container types have the right number of type arguments
+func validateType(name string, typeParams []string) error {
+	t, err := types.Parse(name)
+	if err != nil {
+		return err
+	}
+	return validateParsedType(t, typeParams)
+}
+
+func validateParsedType(t *types.Type, typeParams []string) error {
+	expectedArgs := 0
+	switch {
+	case types.IsInteger(t.Name), t.Name == "bool", t.Name == "string", slices.Contains(typeParams, t.Name):
+	case t.Name == "array":
+		expectedArgs = 1
+	case t.Name == types.Optional, t.Name == "chan", t.Name == "gen":
+		expectedArgs = 1
+	case t.Name == "map", t.Name == types.Result:
+		expectedArgs = 2
+	case t.Name == types.Void:
+		return fmt.Errorf("'void' can only be used as a function return type")
+	case t.Name == types.Tuple:
+		return fmt.Errorf("several values can only be returned from declared functions")
+	case t.Name == types.Function:
+		params, returnType := t.Args[:len(t.Args)-1], t.Args[len(t.Args)-1]
+		for _, param := range params {
+			if err := validateParsedType(param, typeParams); err != nil {
+				return err
+			}
+		}
+		if returnType.Name == types.Void {
+			return nil
+		}
+		return validateParsedType(returnType, typeParams)
+	default:
+		return fmt.Errorf("unknown type '%s'", t.Name)
+	}
+
+	if len(t.Args) != expectedArgs {
+		return fmt.Errorf("type '%s' expects %d type arguments, got %d", t.Name, expectedArgs, len(t.Args))
+	}
+
+	for _, arg := range t.Args {
+		if err := validateParsedType(arg, typeParams); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (a *Analyzer) PrintSymbolTable() {
 	fmt.Println("Symbol Table:")
 	a.SymbolTable.Print()
@@ -0,0 +1,96 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAssignmentErrors(t *testing.T) {
+	runErrorTests(t, []errorTest{
+		{"immutable variable", `
+int main() {
+  int x = 1
+  x = 2
+  return x
+}`, "cannot assign to immutable variable 'x'", 4, 2},
+		{"parameter", `
+int bump(n: int) {
+  n = n + 1
+  return n
+}`, "cannot assign to parameter 'n'", 3, 2},
+		{"constant", `
+const int limit = 3
+
+int main() {
+  limit = 4
+  return 0
+}`, "cannot assign to constant 'limit'", 5, 2},
+		{"immutable global", `
+int calls = 0
+
+int count() {
+  calls = calls + 1
+  return calls
+}`, "cannot assign to immutable variable 'calls'", 5, 2},
+		{"destructuring", `
+(int, int) pair() {
+  return 1, 2
+}
+
+int main() {
+  int a = 0
+  mut int b = 0
+  a, b = pair()
+  return a
+}`, "cannot assign to immutable variable 'a'", 9, 2},
+	})
+}
+
+// TestAssignmentFixes checks the fix suggested for assigning to an immutable
+// name, which is shown at its declaration
+func TestAssignmentFixes(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		help   string
+		fix    string
+	}{
+		{"mut is inserted", `
+int main() {
+  int x = 1
+  x = 2
+  return x
+}`, "declare 'x' with mut to make it mutable", "  3 |   \033[32mmut \033[0mint x = 1\n    |   \033[32m++++\033[0m\n"},
+		{"global", `
+int calls = 0
+
+int count() {
+  calls = calls + 1
+  return calls
+}`, "declare 'calls' with mut to make it mutable", "  2 | \033[32mmut \033[0mint calls = 0\n"},
+		{"parameter is underlined", `
+int bump(n: int) {
+  n = n + 1
+  return n
+}`, "parameters are immutable; copy 'n' into a variable declared with mut instead", "  2 | int bump(n: int) {\n    |          \033[36m------\033[0m\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := analyze(t, tt.source)
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			_, fix, found := strings.Cut(err.Error(), "\033[36mhelp:\033[0m ")
+			if !found {
+				t.Fatalf("Expected a suggested fix, got:\n%s", err)
+			}
+			if !strings.HasPrefix(fix, tt.help+"\n") {
+				t.Errorf("Expected the help %q, got:\n%s", tt.help, fix)
+			}
+			if !strings.Contains(fix, tt.fix) {
+				t.Errorf("Expected the fix to show:\n%s\ngot:\n%s", tt.fix, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package analyzer
+
+import "testing"
+
+func TestEveryPathReturns(t *testing.T) {
+	source := `
+int sign(x: int) {
+  if x > 0 {
+    return 1
+  } else if x < 0 {
+    return 0 - 1
+  } else {
+    return 0
+  }
+}
+
+void log(x: int) {
+  if x > 0 {
+    print(x)
+  }
+}
+
+int main() {
+  fn(int) int twice = fn(int x) int { return x * 2 }
+  log(sign(5))
+  return twice(2)
+}`
+	if _, err := analyze(t, source); err != nil {
+		t.Errorf("Expected every path to return, got:\n%v", err)
+	}
+}
+
+func TestMissingReturnErrors(t *testing.T) {
+	runErrorTests(t, []errorTest{
+		{"trailing value", `
+int f() {
+  5
+}`, "function 'f' must return a value of type int on every path", 3, 2},
+		{"if without else", `
+int f(x: int) {
+  if x > 0 {
+    return 1
+  }
+}`, "function 'f' must return a value of type int on every path", 3, 2},
+		{"branch without return", `
+int f(x: int) {
+  if x > 0 {
+    return 1
+  } else {
+    print(x)
+  }
+}`, "function 'f' must return a value of type int on every path", 3, 2},
+		{"function literal", `
+int main() {
+  fn() int g = fn() int { if true { 4 } else { 5 } }
+  return g()
+}`, "function '<anonymous>' must return a value of type int on every path", 3, 26},
+	})
+}
@@ -0,0 +1,53 @@
+package analyzer
+
+import (
+	"alna-lang/internal/ast"
+	"alna-lang/internal/symbol_table"
+)
+
+// maxSelectCases is the number of cases a select can have, which is the
+// number of bits in the SELECT operand marking its sending cases
+const maxSelectCases = 16
+
+// analyzeSelect checks that every case of a select sends or receives on a
+// channel. The name declared by a receiving case holds the value received,
+// an optional that is none once the channel is closed, in its body alone.
+func (a *Analyzer) analyzeSelect(n ast.SelectNode, st *symboltable.SymbolTable) error {
+	if len(n.Cases) > maxSelectCases {
+		return a.errorAt(n.Cases[maxSelectCases].Operation, "a select can have at most %d cases", maxSelectCases)
+	}
+
+	for _, selectCase := range n.Cases {
+		operation := selectCase.Operation
+		_, isVariable := st.Lookup(operation.Name)
+		if isVariable || (operation.Name != "send" && operation.Name != "receive") {
+			return a.errorAt(operation, "a select case must call send or receive, got '%s'", operation.Name)
+		}
+		if err := a.analyzeFunctionCall(operation, st); err != nil {
+			return err
+		}
+
+		bodySt := st
+		if selectCase.Binding != nil {
+			if operation.Name != "receive" {
+				return a.errorAt(selectCase.Binding, "only a case calling receive can declare a name")
+			}
+			received, err := a.inferType(operation, st)
+			if err != nil {
+				return err
+			}
+			bodySt = symboltable.NewSymbolTable(st, false)
+			bodySt.Parent = st
+			// The scope is new, so the name cannot be declared in it already
+			_ = bodySt.Declare(symboltable.VariableInfo{Name: selectCase.Binding.Name, Type: received, Position: selectCase.Binding.Position})
+		}
+		if err := a.analyzeExpression(selectCase.Body, bodySt); err != nil {
+			return err
+		}
+	}
+
+	if n.Else != nil {
+		return a.analyzeExpression(n.Else, st)
+	}
+	return nil
+}
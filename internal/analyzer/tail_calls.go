@@ -0,0 +1,136 @@
+package analyzer
+
+import (
+	"alna-lang/internal/ast"
+	"alna-lang/internal/symbol_table"
+	"fmt"
+)
+
+// callGraph maps every declared function to the declared functions its body
+// calls. Calls made by function literals are left out, as they do not run
+// in the frame of the function they are written in.
+func callGraph(declarations []ast.Node) map[string][]string {
+	calls := make(map[string][]string)
+	for _, node := range declarations {
+		fn, isFunction := node.(ast.FunctionDeclarationNode)
+		if !isFunction {
+			continue
+		}
+		calls[fn.Name] = nil
+		ast.Walk(fn.Body, func(node ast.Node) bool {
+			switch n := node.(type) {
+			case ast.FunctionCallNode:
+				calls[fn.Name] = append(calls[fn.Name], n.Name)
+			case ast.DeferNode:
+				calls[fn.Name] = append(calls[fn.Name], n.Call.Name)
+			case ast.FunctionLiteralNode:
+				return false
+			}
+			return true
+		})
+	}
+	return calls
+}
+
+// reaches reports whether calling the declared function from can lead to a
+// call to the declared function to
+func (a *Analyzer) reaches(from, to string) bool {
+	if from == to {
+		return true
+	}
+	seen := map[string]bool{from: true}
+	pending := []string{from}
+	for len(pending) > 0 {
+		name := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		for _, callee := range a.calls[name] {
+			if callee == to {
+				return true
+			}
+			if _, declared := a.calls[callee]; declared && !seen[callee] {
+				seen[callee] = true
+				pending = append(pending, callee)
+			}
+		}
+	}
+	return false
+}
+
+// checkTailCall warns about a return that looks meant to recurse as a tail
+// call but is not compiled as one, so that every call of the recursion
+// still takes a frame of its own: its value combines a single recursive
+// call with values computed without recursing, as an accumulator passed
+// along would, or it returns a recursive call from a function with deferred
+// calls, which must run after the callee returns. Recursing more than once,
+// as in fib(n - 1) + fib(n - 2), cannot be made a tail call that way and is
+// left alone.
+func (a *Analyzer) checkTailCall(n ast.ReturnNode, st *symboltable.SymbolTable) {
+	fn := a.currentFunction
+	switch value := n.Value.(type) {
+	case ast.FunctionCallNode:
+		if a.recursiveCall(value, st) && hasDefer(fn.Body) {
+			a.warnAt(value, "recursive call to '%s' is not a tail call, because '%s' defers calls that run after it returns", value.Name, fn.Name)
+		}
+	case ast.BinaryOpNode:
+		operands := [][2]ast.Node{{value.Left, value.Right}, {value.Right, value.Left}}
+		for _, pair := range operands {
+			call, isCall := pair[0].(ast.FunctionCallNode)
+			if isCall && a.recursiveCall(call, st) && !a.recurses(pair[1], st) {
+				a.warnAt(call, "recursive call to '%s' is not a tail call, because its result is used by '%s'; pass the result along as an argument to make it one", call.Name, value.Operator.Value)
+			}
+		}
+	case ast.TryNode:
+		if call, isCall := value.Value.(ast.FunctionCallNode); isCall && a.recursiveCall(call, st) {
+			a.warnAt(call, "recursive call to '%s' is not a tail call, because its result is checked by '?'", call.Name)
+		}
+	}
+}
+
+// recursiveCall reports whether call is to a declared function that can call
+// the function being analyzed back
+func (a *Analyzer) recursiveCall(call ast.FunctionCallNode, st *symboltable.SymbolTable) bool {
+	if info, declared := st.Lookup(call.Name); !declared || info.Type != "function" {
+		return false
+	}
+	return a.reaches(call.Name, a.currentFunction.Name)
+}
+
+// recurses reports whether evaluating node makes a recursive call. Calls in
+// function literals are left out, as they only run when the literal is
+// called.
+func (a *Analyzer) recurses(node ast.Node, st *symboltable.SymbolTable) bool {
+	found := false
+	ast.Walk(node, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case ast.FunctionCallNode:
+			found = found || a.recursiveCall(n, st)
+		case ast.FunctionLiteralNode:
+			return false
+		}
+		return !found
+	})
+	return found
+}
+
+// hasDefer reports whether a function body has defer statements of its own
+func hasDefer(body ast.BlockNode) bool {
+	found := false
+	ast.Walk(body, func(node ast.Node) bool {
+		switch node.(type) {
+		case ast.DeferNode:
+			found = true
+		case ast.FunctionLiteralNode:
+			return false
+		}
+		return !found
+	})
+	return found
+}
+
+func (a *Analyzer) warnAt(node ast.Node, format string, args ...any) {
+	a.Warnings = append(a.Warnings, Warning{
+		Function: a.currentFunction.Name,
+		Position: node.Pos(),
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
@@ -0,0 +1,85 @@
+package analyzer
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTailCallWarnings(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		warnings []string
+	}{
+		{"accumulator", `
+int sum(n: int) {
+  if n == 0 {
+    return 0
+  }
+  return n + sum(n - 1)
+}`, []string{"recursive call to 'sum' is not a tail call, because its result is used by '+'; pass the result along as an argument to make it one"}},
+		{"tail call", `
+int sum(n: int, total: int) {
+  if n == 0 {
+    return total
+  }
+  return sum(n - 1, total + n)
+}`, nil},
+		{"tree recursion", `
+int fib(n: int) {
+  if n < 2 {
+    return n
+  }
+  return fib(n - 1) + fib(n - 2)
+}`, nil},
+		{"nested tree recursion", `
+int count(n: int) {
+  if n < 2 {
+    return 1
+  }
+  return 1 + count(n - 1) + count(n - 2)
+}`, nil},
+		{"mutual recursion", `
+int even(n: int) {
+  if n == 0 {
+    return 1
+  }
+  return 0 + odd(n - 1)
+}
+
+int odd(n: int) {
+  if n == 0 {
+    return 0
+  }
+  return even(n - 1)
+}`, []string{"recursive call to 'odd' is not a tail call, because its result is used by '+'; pass the result along as an argument to make it one"}},
+		{"deferred calls", `
+done() {
+  printString("done")
+}
+
+int down(n: int) {
+  defer done()
+  if n == 0 {
+    return 0
+  }
+  return down(n - 1)
+}`, []string{"recursive call to 'down' is not a tail call, because 'down' defers calls that run after it returns"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			semantic, err := analyze(t, tt.source)
+			if err != nil {
+				t.Fatalf("Failed analysis: %v", err)
+			}
+			var warnings []string
+			for _, warning := range semantic.Warnings {
+				warnings = append(warnings, warning.Message)
+			}
+			if !slices.Equal(warnings, tt.warnings) {
+				t.Errorf("Expected the warnings %q, got %q", tt.warnings, warnings)
+			}
+		})
+	}
+}
@@ -41,6 +41,19 @@ func (b BooleanNode) Pos() common.Position {
 	return b.Position
 }
 
+// NoneNode represents the none literal, the absent value of optional types
+type NoneNode struct {
+	Position common.Position
+}
+
+func (n NoneNode) NodeType() string {
+	return "NoneNode"
+}
+
+func (n NoneNode) Pos() common.Position {
+	return n.Position
+}
+
 // NumberNode represents a numeric literal
 type NumberNode struct {
 	Value    interface{}
@@ -100,12 +113,52 @@ func (a AssignmentNode) Pos() common.Position {
 	return a.Position
 }
 
+// DestructuringNode represents an assignment of several values at once, as in
+// q, r := divmod(7, 2). With Declare set, written :=, the targets are
+// declared as new variables, which are mutable when Mutable is set. Values
+// assigned to _ are discarded.
+type DestructuringNode struct {
+	Targets  []IdentifierNode
+	Value    Node
+	Declare  bool
+	Mutable  bool
+	Position common.Position
+}
+
+func (d DestructuringNode) NodeType() string {
+	return "DestructuringNode"
+}
+
+func (d DestructuringNode) Pos() common.Position {
+	return d.Position
+}
+
+// ValueListNode represents the values of a return or a destructuring
+// assignment written as a comma-separated list, as in return q, r
+type ValueListNode struct {
+	Values   []Node
+	Position common.Position
+}
+
+func (v ValueListNode) NodeType() string {
+	return "ValueListNode"
+}
+
+func (v ValueListNode) Pos() common.Position {
+	return v.Position
+}
+
 // VariableDeclarationNode represents a variable declaration
 type VariableDeclarationNode struct {
 	Name        string
 	Type        string
 	Initializer Node
-	Position    common.Position
+	// Constant is set for const declarations, whose value is inlined
+	// wherever they are used, and Mutable for mut declarations, which are
+	// the only variables that can be assigned to
+	Constant bool
+	Mutable  bool
+	Position common.Position
 }
 
 func (v VariableDeclarationNode) NodeType() string {
@@ -131,9 +184,12 @@ func (b BlockNode) Pos() common.Position {
 	return b.Position
 }
 
-// IfExpressionNode represents an if-else expression
+// IfExpressionNode represents an if-else expression. An if whose condition
+// is written as value is some name has a Binding, which names the value held
+// by the optional Condition in the ThenBranch.
 type IfExpressionNode struct {
 	Condition  Node
+	Binding    *IdentifierNode
 	ThenBranch Node
 	ElseBranch Node
 	Position   common.Position
@@ -147,33 +203,59 @@ func (i IfExpressionNode) Pos() common.Position {
 	return i.Position
 }
 
-// Parameter represents a function parameter
+// Parameter represents a function parameter. Default is the value used when
+// a call leaves the parameter out, or nil if it must be passed.
 type FunctionParam struct {
-	Name string
-	Type string
+	Name     string
+	Type     string
+	Default  Node
+	Position common.Position
 }
 
 // FunctionDeclarationNode represents a function declaration
 type FunctionDeclarationNode struct {
-	Name       string
+	Name string
+	// TypeParameters are the names of the type parameters of a generic
+	// function, which its signature and body can use as types
+	TypeParameters []string
+	Parameters     []FunctionParam
+	ReturnType     string
+	Body           BlockNode
+	Position       common.Position
+}
+
+func (f FunctionDeclarationNode) NodeType() string {
+	return "FunctionDeclarationNode"
+}
+
+func (f FunctionDeclarationNode) Pos() common.Position {
+	return f.Position
+}
+
+// FunctionLiteralNode represents an anonymous function, which can capture
+// the variables of the scopes it is declared in
+type FunctionLiteralNode struct {
 	Parameters []FunctionParam
 	ReturnType string
 	Body       BlockNode
 	Position   common.Position
 }
 
-func (f FunctionDeclarationNode) NodeType() string {
-	return "FunctionDeclarationNode"
+func (f FunctionLiteralNode) NodeType() string {
+	return "FunctionLiteralNode"
 }
 
-func (f FunctionDeclarationNode) Pos() common.Position {
+func (f FunctionLiteralNode) Pos() common.Position {
 	return f.Position
 }
 
-// FunctionCallNode represents a function call
+// FunctionCallNode represents a function call. Arguments are in the order
+// they were written and may be NamedArgumentNodes. The analyzer stores them
+// in parameter order, with default values filled in, in Resolved.
 type FunctionCallNode struct {
 	Name      string
 	Arguments []Node
+	Resolved  *[]Node
 	Position  common.Position
 }
 
@@ -185,6 +267,121 @@ func (f FunctionCallNode) Pos() common.Position {
 	return f.Position
 }
 
+// PositionalArguments returns the arguments in parameter order, as resolved
+// by the analyzer
+func (f FunctionCallNode) PositionalArguments() []Node {
+	if f.Resolved != nil && *f.Resolved != nil {
+		return *f.Resolved
+	}
+	return f.Arguments
+}
+
+// NamedArgumentNode represents an argument passed by parameter name, as in
+// f(limit: 10)
+type NamedArgumentNode struct {
+	Name     string
+	Value    Node
+	Position common.Position
+}
+
+func (n NamedArgumentNode) NodeType() string {
+	return "NamedArgumentNode"
+}
+
+func (n NamedArgumentNode) Pos() common.Position {
+	return n.Position
+}
+
+// DeferNode represents a defer statement, whose call is made when the
+// enclosing function returns
+type DeferNode struct {
+	Call     FunctionCallNode
+	Position common.Position
+}
+
+func (d DeferNode) NodeType() string {
+	return "DeferNode"
+}
+
+func (d DeferNode) Pos() common.Position {
+	return d.Position
+}
+
+// SpawnNode represents a spawn statement, which makes its call in a task of
+// its own that runs concurrently with the rest of the program
+type SpawnNode struct {
+	Call     FunctionCallNode
+	Position common.Position
+}
+
+func (s SpawnNode) NodeType() string {
+	return "SpawnNode"
+}
+
+func (s SpawnNode) Pos() common.Position {
+	return s.Position
+}
+
+// SelectNode represents a select statement, which waits until one of its
+// cases can send or receive on a channel and runs the body of that case. When
+// it has an Else branch, the branch runs instead of waiting when no case can.
+type SelectNode struct {
+	Cases    []SelectCase
+	Else     *BlockNode
+	Position common.Position
+}
+
+func (s SelectNode) NodeType() string {
+	return "SelectNode"
+}
+
+func (s SelectNode) Pos() common.Position {
+	return s.Position
+}
+
+// SelectCase is a case of a select statement. Operation is a call to send or
+// receive, and a receiving case can have a Binding, which names the value
+// received in its Body.
+type SelectCase struct {
+	Binding   *IdentifierNode
+	Operation FunctionCallNode
+	Body      BlockNode
+	Position  common.Position
+}
+
+// ForNode represents a for-in loop, which runs its Body once for every
+// value of Iterable, an array or a generator, named Binding in the body
+type ForNode struct {
+	Binding  IdentifierNode
+	Iterable Node
+	Body     BlockNode
+	Position common.Position
+}
+
+func (f ForNode) NodeType() string {
+	return "ForNode"
+}
+
+func (f ForNode) Pos() common.Position {
+	return f.Position
+}
+
+// YieldNode represents a yield statement, which hands Value to the loop
+// iterating over the generator and suspends the generator until the loop
+// asks for the next value
+type YieldNode struct {
+	Value    Node
+	Position common.Position
+}
+
+func (y YieldNode) NodeType() string {
+	return "YieldNode"
+}
+
+func (y YieldNode) Pos() common.Position {
+	return y.Position
+}
+
 type ReturnNode struct {
 	Value    Node
 	Position common.Position
@@ -197,3 +394,76 @@ func (r ReturnNode) NodeType() string {
 func (r ReturnNode) Pos() common.Position {
 	return r.Position
 }
+
+// StringNode represents a string literal
+type StringNode struct {
+	Value    string
+	Position common.Position
+}
+
+func (s StringNode) NodeType() string {
+	return "StringNode"
+}
+
+func (s StringNode) Pos() common.Position {
+	return s.Position
+}
+
+// ArrayLiteralNode represents an array literal (e.g., [1, 2, 3])
+type ArrayLiteralNode struct {
+	Elements []Node
+	Position common.Position
+}
+
+func (a ArrayLiteralNode) NodeType() string {
+	return "ArrayLiteralNode"
+}
+
+func (a ArrayLiteralNode) Pos() common.Position {
+	return a.Position
+}
+
+// IndexNode represents indexing into an array or map (e.g., xs[0])
+type IndexNode struct {
+	Target   Node
+	Index    Node
+	Position common.Position
+}
+
+func (i IndexNode) NodeType() string {
+	return "IndexNode"
+}
+
+func (i IndexNode) Pos() common.Position {
+	return i.Position
+}
+
+// TryNode represents propagating the error of a Result (e.g., parseInt(s)?).
+// An ok result evaluates to its value, while an err result is returned from
+// the enclosing function.
+type TryNode struct {
+	Value    Node
+	Position common.Position
+}
+
+func (t TryNode) NodeType() string {
+	return "TryNode"
+}
+
+func (t TryNode) Pos() common.Position {
+	return t.Position
+}
+
+// IncludeNode represents an include of a standard library module or source file
+type IncludeNode struct {
+	Path     string
+	Position common.Position
+}
+
+func (i IncludeNode) NodeType() string {
+	return "IncludeNode"
+}
+
+func (i IncludeNode) Pos() common.Position {
+	return i.Position
+}
@@ -2,6 +2,7 @@ package ast
 
 import (
 	"fmt"
+	"strings"
 )
 
 // PrintAST prints the AST in a tree-like visual format
@@ -39,6 +40,44 @@ func PrintAST(node Node, indent string, isLast bool) {
 		fmt.Printf("%s%sNumber: %v\n", indent, connector, n.Value)
 	case BooleanNode:
 		fmt.Printf("%s%sBoolean: %v\n", indent, connector, n.Value)
+	case NoneNode:
+		fmt.Printf("%s%sNone\n", indent, connector)
+	case StringNode:
+		fmt.Printf("%s%sString: %q\n", indent, connector, n.Value)
+	case ArrayLiteralNode:
+		fmt.Printf("%s%sArrayLiteral\n", indent, connector)
+		childIndent := indent
+		if isLast {
+			childIndent += "    "
+		} else {
+			childIndent += "│   "
+		}
+		for i, element := range n.Elements {
+			PrintAST(element, childIndent, i == len(n.Elements)-1)
+		}
+	case IndexNode:
+		fmt.Printf("%s%sIndex\n", indent, connector)
+		childIndent := indent
+		if isLast {
+			childIndent += "    "
+		} else {
+			childIndent += "│   "
+		}
+		fmt.Printf("%s├── Target:\n", childIndent)
+		PrintAST(n.Target, childIndent+"│   ", true)
+		fmt.Printf("%s└── Index:\n", childIndent)
+		PrintAST(n.Index, childIndent+"    ", true)
+	case TryNode:
+		fmt.Printf("%s%sTry\n", indent, connector)
+		childIndent := indent
+		if isLast {
+			childIndent += "    "
+		} else {
+			childIndent += "│   "
+		}
+		PrintAST(n.Value, childIndent, true)
+	case IncludeNode:
+		fmt.Printf("%s%sInclude: %q\n", indent, connector, n.Path)
 	case BinaryOpNode:
 		fmt.Printf("%s%sBinaryOp (%v)\n", indent, connector, n.Operator.Value)
 		childIndent := indent
@@ -63,6 +102,12 @@ func PrintAST(node Node, indent string, isLast bool) {
 		fmt.Printf("%s├── Name: %s\n", childIndent, n.Name)
 		// Print type
 		fmt.Printf("%s├── Type: %s\n", childIndent, n.Type)
+		if n.Constant {
+			fmt.Printf("%s├── Constant\n", childIndent)
+		}
+		if n.Mutable {
+			fmt.Printf("%s├── Mutable\n", childIndent)
+		}
 		// Print initializer (if present)
 		if n.Initializer != nil {
 			fmt.Printf("%s└── Initializer:\n", childIndent)
@@ -84,6 +129,38 @@ func PrintAST(node Node, indent string, isLast bool) {
 		// Print value
 		fmt.Printf("%s└── Value:\n", childIndent)
 		PrintAST(n.Right, childIndent+"    ", true)
+	case DestructuringNode:
+		operator := "="
+		if n.Declare {
+			operator = ":="
+		}
+		if n.Mutable {
+			operator = "mut " + operator
+		}
+		fmt.Printf("%s%sDestructuring (%s)\n", indent, connector, operator)
+		childIndent := indent
+		if isLast {
+			childIndent += "    "
+		} else {
+			childIndent += "│   "
+		}
+		fmt.Printf("%s├── Targets:\n", childIndent)
+		for i, target := range n.Targets {
+			PrintAST(target, childIndent+"│   ", i == len(n.Targets)-1)
+		}
+		fmt.Printf("%s└── Value:\n", childIndent)
+		PrintAST(n.Value, childIndent+"    ", true)
+	case ValueListNode:
+		fmt.Printf("%s%sValueList\n", indent, connector)
+		childIndent := indent
+		if isLast {
+			childIndent += "    "
+		} else {
+			childIndent += "│   "
+		}
+		for i, value := range n.Values {
+			PrintAST(value, childIndent, i == len(n.Values)-1)
+		}
 	case IfExpressionNode:
 		fmt.Printf("%s%sIfExpression\n", indent, connector)
 		childIndent := indent
@@ -94,6 +171,9 @@ func PrintAST(node Node, indent string, isLast bool) {
 		}
 		fmt.Printf("%s├── Condition:\n", childIndent)
 		PrintAST(n.Condition, childIndent+"│   ", false)
+		if n.Binding != nil {
+			fmt.Printf("%s├── IsSome: %s\n", childIndent, n.Binding.Name)
+		}
 		fmt.Printf("%s├── ThenBlock:\n", childIndent)
 		PrintAST(n.ThenBranch, childIndent+"│   ", n.ElseBranch == nil)
 		if n.ElseBranch != nil {
@@ -137,6 +217,15 @@ func PrintAST(node Node, indent string, isLast bool) {
 		for i, arg := range n.Arguments {
 			PrintAST(arg, childIndent, i == len(n.Arguments)-1)
 		}
+	case NamedArgumentNode:
+		fmt.Printf("%s%sNamedArgument: %s\n", indent, connector, n.Name)
+		childIndent := indent
+		if isLast {
+			childIndent += "    "
+		} else {
+			childIndent += "│   "
+		}
+		PrintAST(n.Value, childIndent, true)
 	case FunctionDeclarationNode:
 		fmt.Printf("%s%sFunctionDeclaration: %s\n", indent, connector, n.Name)
 		childIndent := indent
@@ -145,22 +234,82 @@ func PrintAST(node Node, indent string, isLast bool) {
 		} else {
 			childIndent += "│   "
 		}
-		// Print parameters
-		fmt.Printf("%s├── Parameters:\n", childIndent)
-		paramIndent := childIndent + "│   "
-		for i, param := range n.Parameters {
-			fmt.Printf("%s%sParameter: %s Type: %s\n", paramIndent, func() string {
-				if i == len(n.Parameters)-1 {
-					return "└── "
-				}
-				return "├── "
-			}(), param.Name, param.Type)
+		if len(n.TypeParameters) > 0 {
+			fmt.Printf("%s├── TypeParameters: %s\n", childIndent, strings.Join(n.TypeParameters, ", "))
 		}
-		// Print return type
-		fmt.Printf("%s├── ReturnType: %s\n", childIndent, n.ReturnType)
-		// Print body
+		printFunction(childIndent, n.Parameters, n.ReturnType, n.Body)
+	case FunctionLiteralNode:
+		fmt.Printf("%s%sFunctionLiteral\n", indent, connector)
+		childIndent := indent
+		if isLast {
+			childIndent += "    "
+		} else {
+			childIndent += "│   "
+		}
+		printFunction(childIndent, n.Parameters, n.ReturnType, n.Body)
+	case DeferNode:
+		fmt.Printf("%s%sDefer\n", indent, connector)
+		childIndent := indent
+		if isLast {
+			childIndent += "    "
+		} else {
+			childIndent += "│   "
+		}
+		PrintAST(n.Call, childIndent, true)
+	case SpawnNode:
+		fmt.Printf("%s%sSpawn\n", indent, connector)
+		childIndent := indent
+		if isLast {
+			childIndent += "    "
+		} else {
+			childIndent += "│   "
+		}
+		PrintAST(n.Call, childIndent, true)
+	case SelectNode:
+		fmt.Printf("%s%sSelect\n", indent, connector)
+		childIndent := indent
+		if isLast {
+			childIndent += "    "
+		} else {
+			childIndent += "│   "
+		}
+		for i, selectCase := range n.Cases {
+			caseConnector, caseIndent := "├── ", childIndent+"│   "
+			if i == len(n.Cases)-1 && n.Else == nil {
+				caseConnector, caseIndent = "└── ", childIndent+"    "
+			}
+			fmt.Printf("%s%sCase\n", childIndent, caseConnector)
+			if selectCase.Binding != nil {
+				fmt.Printf("%s├── Binding: %s\n", caseIndent, selectCase.Binding.Name)
+			}
+			PrintAST(selectCase.Operation, caseIndent, false)
+			PrintAST(selectCase.Body, caseIndent, true)
+		}
+		if n.Else != nil {
+			fmt.Printf("%s└── ElseBlock:\n", childIndent)
+			PrintAST(n.Else, childIndent+"    ", true)
+		}
+	case ForNode:
+		fmt.Printf("%s%sFor: %s\n", indent, connector, n.Binding.Name)
+		childIndent := indent
+		if isLast {
+			childIndent += "    "
+		} else {
+			childIndent += "│   "
+		}
+		fmt.Printf("%s├── Iterable:\n", childIndent)
+		PrintAST(n.Iterable, childIndent+"│   ", true)
 		fmt.Printf("%s└── Body:\n", childIndent)
 		PrintAST(n.Body, childIndent+"    ", true)
+	case YieldNode:
+		fmt.Printf("%s%sYield\n", indent, connector)
+		childIndent := indent
+		if isLast {
+			childIndent += "    "
+		} else {
+			childIndent += "│   "
+		}
+		PrintAST(n.Value, childIndent, true)
 	case ReturnNode:
 		fmt.Printf("%s%sReturn\n", indent, connector)
 		childIndent := indent
@@ -174,3 +323,32 @@ func PrintAST(node Node, indent string, isLast bool) {
 		fmt.Printf("%s%sUnknown Node Type\n", indent, connector)
 	}
 }
+
+// printFunction prints the parameters, return type and body shared by
+// function declarations and function literals
+func printFunction(childIndent string, parameters []FunctionParam, returnType string, body BlockNode) {
+	// Print parameters
+	fmt.Printf("%s├── Parameters:\n", childIndent)
+	paramIndent := childIndent + "│   "
+	for i, param := range parameters {
+		fmt.Printf("%s%sParameter: %s Type: %s\n", paramIndent, func() string {
+			if i == len(parameters)-1 {
+				return "└── "
+			}
+			return "├── "
+		}(), param.Name, param.Type)
+		if param.Default != nil {
+			defaultIndent := paramIndent + "│   "
+			if i == len(parameters)-1 {
+				defaultIndent = paramIndent + "    "
+			}
+			fmt.Printf("%s└── Default:\n", defaultIndent)
+			PrintAST(param.Default, defaultIndent+"    ", true)
+		}
+	}
+	// Print return type
+	fmt.Printf("%s├── ReturnType: %s\n", childIndent, returnType)
+	// Print body
+	fmt.Printf("%s└── Body:\n", childIndent)
+	PrintAST(body, childIndent+"    ", true)
+}
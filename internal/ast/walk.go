@@ -0,0 +1,87 @@
+package ast
+
+// Walk calls visit for node and every node below it, depth first and in the
+// order they appear in the source. The nodes below a node are skipped when
+// visit returns false for it.
+func Walk(node Node, visit func(Node) bool) {
+	if block, isBlock := node.(*BlockNode); node == nil || (isBlock && block == nil) {
+		return
+	}
+	if !visit(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	case RootNode:
+		walkAll(n.Children, visit)
+	case BlockNode:
+		walkAll(n.Expressions, visit)
+	case *BlockNode:
+		walkAll(n.Expressions, visit)
+	case VariableDeclarationNode:
+		Walk(n.Initializer, visit)
+	case AssignmentNode:
+		Walk(n.Left, visit)
+		Walk(n.Right, visit)
+	case DestructuringNode:
+		for _, target := range n.Targets {
+			Walk(target, visit)
+		}
+		Walk(n.Value, visit)
+	case ValueListNode:
+		walkAll(n.Values, visit)
+	case BinaryOpNode:
+		Walk(n.Left, visit)
+		Walk(n.Right, visit)
+	case IfExpressionNode:
+		Walk(n.Condition, visit)
+		Walk(n.ThenBranch, visit)
+		Walk(n.ElseBranch, visit)
+	case FunctionDeclarationNode:
+		walkParameters(n.Parameters, visit)
+		Walk(n.Body, visit)
+	case FunctionLiteralNode:
+		walkParameters(n.Parameters, visit)
+		Walk(n.Body, visit)
+	case FunctionCallNode:
+		walkAll(n.Arguments, visit)
+	case NamedArgumentNode:
+		Walk(n.Value, visit)
+	case DeferNode:
+		Walk(n.Call, visit)
+	case SpawnNode:
+		Walk(n.Call, visit)
+	case SelectNode:
+		for _, selectCase := range n.Cases {
+			Walk(selectCase.Operation, visit)
+			Walk(selectCase.Body, visit)
+		}
+		Walk(n.Else, visit)
+	case ForNode:
+		Walk(n.Iterable, visit)
+		Walk(n.Body, visit)
+	case YieldNode:
+		Walk(n.Value, visit)
+	case ReturnNode:
+		Walk(n.Value, visit)
+	case ArrayLiteralNode:
+		walkAll(n.Elements, visit)
+	case IndexNode:
+		Walk(n.Target, visit)
+		Walk(n.Index, visit)
+	case TryNode:
+		Walk(n.Value, visit)
+	}
+}
+
+func walkAll(nodes []Node, visit func(Node) bool) {
+	for _, node := range nodes {
+		Walk(node, visit)
+	}
+}
+
+func walkParameters(parameters []FunctionParam, visit func(Node) bool) {
+	for _, param := range parameters {
+		Walk(param.Default, visit)
+	}
+}
@@ -0,0 +1,166 @@
+package builtins
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxFormatWidth is the largest width and precision a format spec can have
+const MaxFormatWidth = 1000
+
+// FormatSpec describes how format lays out a value. Specs are written as
+// [[fill]align][0][width][.precision], where align is '<', '>' or '^'.
+type FormatSpec struct {
+	Fill      rune
+	Align     rune
+	ZeroPad   bool
+	Width     int
+	Precision int
+}
+
+// ParseFormatSpec parses a format spec. An empty spec formats values the
+// same way print does.
+func ParseFormatSpec(spec string) (FormatSpec, error) {
+	parsed := FormatSpec{Fill: ' ', Precision: -1}
+	rest := spec
+
+	isAlign := func(r rune) bool { return r == '<' || r == '>' || r == '^' }
+	if fill, size := utf8.DecodeRuneInString(rest); size > 0 {
+		if align, alignSize := utf8.DecodeRuneInString(rest[size:]); alignSize > 0 && isAlign(align) {
+			parsed.Fill, parsed.Align = fill, align
+			rest = rest[size+alignSize:]
+		} else if isAlign(fill) {
+			parsed.Align = fill
+			rest = rest[size:]
+		}
+	}
+
+	if strings.HasPrefix(rest, "0") {
+		parsed.ZeroPad = true
+		rest = rest[1:]
+	}
+
+	digits := leadingDigits(rest)
+	if digits != "" {
+		width, err := parseSpecNumber(spec, "width", digits)
+		if err != nil {
+			return FormatSpec{}, err
+		}
+		parsed.Width = width
+		rest = rest[len(digits):]
+	}
+
+	if strings.HasPrefix(rest, ".") {
+		digits = leadingDigits(rest[1:])
+		if digits == "" {
+			return FormatSpec{}, fmt.Errorf("invalid format spec %q: expected a precision after '.'", spec)
+		}
+		precision, err := parseSpecNumber(spec, "precision", digits)
+		if err != nil {
+			return FormatSpec{}, err
+		}
+		parsed.Precision = precision
+		rest = rest[1+len(digits):]
+	}
+
+	if rest != "" {
+		return FormatSpec{}, fmt.Errorf("invalid format spec %q: unexpected %q", spec, rest)
+	}
+	return parsed, nil
+}
+
+// parseSpecNumber parses the width or precision of spec, which are capped at
+// MaxFormatWidth so that a spec cannot ask for huge strings
+func parseSpecNumber(spec string, name string, digits string) (int, error) {
+	n, err := strconv.Atoi(digits)
+	if err != nil || n > MaxFormatWidth {
+		return 0, fmt.Errorf("invalid format spec %q: %s must be at most %d", spec, name, MaxFormatWidth)
+	}
+	return n, nil
+}
+
+// FormatSize is the size in bytes of the text format builds from value and
+// spec, or 0 when spec is invalid and the call fails. It counts the padding
+// and the text of strings: other values are short when formatted, or, for
+// arrays and maps, as long as what they already hold.
+func FormatSize(value Value, spec string) int {
+	parsed, err := ParseFormatSpec(spec)
+	if err != nil {
+		return 0
+	}
+	size := parsed.Width * utf8.RuneLen(parsed.Fill)
+	if value.Kind == KindString {
+		size += len(value.AsString())
+	}
+	return size
+}
+
+func leadingDigits(s string) string {
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	return s[:end]
+}
+
+// Format lays out value as described by spec. Numbers are aligned to the
+// right and everything else to the left unless the spec says otherwise.
+// Precision is the maximum length of a string.
+func Format(value Value, spec FormatSpec) (string, error) {
+	var text string
+	numeric := false
+
+	switch value.Kind {
+	case KindInt:
+		if spec.Precision >= 0 {
+			return "", fmt.Errorf("precision is not allowed for int values")
+		}
+		text = strconv.Itoa(value.AsInt())
+		numeric = true
+	case KindString:
+		text = value.AsString()
+		if spec.Precision >= 0 && utf8.RuneCountInString(text) > spec.Precision {
+			text = string([]rune(text)[:spec.Precision])
+		}
+	default:
+		if spec.Precision >= 0 {
+			return "", fmt.Errorf("precision is not allowed for %v", value)
+		}
+		text = value.String()
+	}
+
+	padding := spec.Width - utf8.RuneCountInString(text)
+	if padding <= 0 {
+		return text, nil
+	}
+
+	// Zero padding goes between the sign and the digits
+	if spec.ZeroPad && numeric && spec.Align == 0 {
+		sign := ""
+		if strings.HasPrefix(text, "-") {
+			sign, text = "-", text[1:]
+		}
+		return sign + strings.Repeat("0", padding) + text, nil
+	}
+
+	align := spec.Align
+	if align == 0 {
+		align = '<'
+		if numeric {
+			align = '>'
+		}
+	}
+
+	fill := string(spec.Fill)
+	switch align {
+	case '>':
+		return strings.Repeat(fill, padding) + text, nil
+	case '^':
+		left := padding / 2
+		return strings.Repeat(fill, left) + text + strings.Repeat(fill, padding-left), nil
+	default:
+		return text + strings.Repeat(fill, padding), nil
+	}
+}
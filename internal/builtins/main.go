@@ -1,19 +1,454 @@
 package builtins
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unsafe"
+)
 
-type Function = func(args ...any) any
+// Function is the signature of builtin implementations. A returned error is
+// a runtime failure that terminates the program, while failures the program
+// can handle are returned as err results.
+type Function = func(args ...Value) (Value, error)
 
-func GetBuiltins() map[string]Function {
-	builtins := map[string]Function{
-		"__write": func(args ...any) any {
-			if len(args) != 1 {
-				panic("Invalid number of arguments to __write")
-			}
+// ErrIndexOutOfRange is wrapped by the errors of builtins given an index or
+// range outside of a string or array
+var ErrIndexOutOfRange = errors.New("index out of range")
 
-			fmt.Println(args[0])
-			return nil
+func checkIndex(index, length int, of string) error {
+	if index < 0 || index >= length {
+		return fmt.Errorf("%w: index %d for %s of length %d", ErrIndexOutOfRange, index, of, length)
+	}
+	return nil
+}
+
+func checkRange(start, end, length int, of string) error {
+	if start < 0 || end < start || end > length {
+		return fmt.Errorf("%w: range %d to %d for %s of length %d", ErrIndexOutOfRange, start, end, of, length)
+	}
+	return nil
+}
+
+// rangeLength is the length of the range from start to end of a string or
+// array of length, or 0 when the range is out of bounds and the call fails
+func rangeLength(start, end, length int) int {
+	if checkRange(start, end, length, "") != nil {
+		return 0
+	}
+	return end - start
+}
+
+// ArraySize is the size of an array of length values
+func ArraySize(length int) int {
+	return int(unsafe.Sizeof(Array{})) + length*int(unsafe.Sizeof(Value{}))
+}
+
+// Builtin describes a function implemented in Go that Alna code can call.
+// Params and ReturnType use the same spelling as Alna types, with "any"
+// standing for values of any type. Generic builtins list the type parameters
+// their signature mentions in TypeParams. Builtins without an Implementation
+// work on the state of the VM, which provides them.
+type Builtin struct {
+	Name           string
+	TypeParams     []string
+	Params         []string
+	ReturnType     string
+	Implementation Function
+	// Allocates is set for builtins that build strings or arrays of a size
+	// their arguments decide. It returns the size in bytes of what a call
+	// with args builds, so that the VM can check it against its heap limit
+	// before making the call.
+	Allocates func(args ...Value) int
+}
+
+// Array is the runtime representation of array<T> values
+type Array struct {
+	Elements []Value
+}
+
+func (a *Array) String() string {
+	parts := make([]string, len(a.Elements))
+	for i, element := range a.Elements {
+		parts[i] = element.String()
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// Map is the runtime representation of map<K, V> values. Keys are kept in
+// insertion order so that iteration and printing are deterministic.
+type Map struct {
+	Keys    []Value
+	Entries map[Value]Value
+}
+
+func NewMap() *Map {
+	return &Map{Entries: make(map[Value]Value)}
+}
+
+func (m *Map) Set(key, value Value) {
+	if _, exists := m.Entries[key]; !exists {
+		m.Keys = append(m.Keys, key)
+	}
+	m.Entries[key] = value
+}
+
+func (m *Map) Delete(key Value) {
+	if _, exists := m.Entries[key]; !exists {
+		return
+	}
+	delete(m.Entries, key)
+	for i, k := range m.Keys {
+		if k == key {
+			m.Keys = append(m.Keys[:i], m.Keys[i+1:]...)
+			break
+		}
+	}
+}
+
+func (m *Map) String() string {
+	parts := make([]string, len(m.Keys))
+	for i, key := range m.Keys {
+		parts[i] = fmt.Sprintf("%v: %v", key, m.Entries[key])
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// Result is the runtime representation of Result<T, E> values. Value holds
+// the value of an ok result or the error of an err result.
+type Result struct {
+	Ok    bool
+	Value Value
+}
+
+func (r *Result) String() string {
+	if r.Ok {
+		return fmt.Sprintf("ok(%v)", r.Value)
+	}
+	return fmt.Sprintf("err(%v)", r.Value)
+}
+
+// Range is the runtime representation of the gen<int> values made by range,
+// which count from Next up to End, leaving End out, without running any code
+type Range struct {
+	Next int
+	End  int
+}
+
+func (r *Range) String() string {
+	return "<gen>"
+}
+
+// GetBuiltins returns the builtin functions in a stable order. The position
+// of a builtin in this list is the index used by CALL_BUILTIN.
+func GetBuiltins() []Builtin {
+	return []Builtin{
+		{
+			Name:       "__write",
+			Params:     []string{"any"},
+			ReturnType: "void",
+			Implementation: func(args ...Value) (Value, error) {
+				if len(args) != 1 {
+					return Nil, fmt.Errorf("__write expects 1 argument, got %d", len(args))
+				}
+
+				fmt.Println(args[0].String())
+				return Nil, nil
+			},
+		},
+		{
+			Name:       "__fail",
+			Params:     []string{"string"},
+			ReturnType: "void",
+			Implementation: func(args ...Value) (Value, error) {
+				return Nil, errors.New(args[0].AsString())
+			},
+		},
+		{
+			Name:       "__str_len",
+			Params:     []string{"string"},
+			ReturnType: "int",
+			Implementation: func(args ...Value) (Value, error) {
+				return IntValue(len(args[0].AsString())), nil
+			},
+		},
+		{
+			Name:       "__str_slice",
+			Params:     []string{"string", "int", "int"},
+			ReturnType: "string",
+			Implementation: func(args ...Value) (Value, error) {
+				s, start, end := args[0].AsString(), args[1].AsInt(), args[2].AsInt()
+				if err := checkRange(start, end, len(s), "a string"); err != nil {
+					return Nil, err
+				}
+				return StringValue(s[start:end]), nil
+			},
+			Allocates: func(args ...Value) int {
+				return rangeLength(args[1].AsInt(), args[2].AsInt(), len(args[0].AsString()))
+			},
+		},
+		{
+			Name:       "__str_index",
+			Params:     []string{"string", "string"},
+			ReturnType: "int",
+			Implementation: func(args ...Value) (Value, error) {
+				return IntValue(strings.Index(args[0].AsString(), args[1].AsString())), nil
+			},
+		},
+		{
+			Name:       "__str_char_code",
+			Params:     []string{"string", "int"},
+			ReturnType: "int",
+			Implementation: func(args ...Value) (Value, error) {
+				s, index := args[0].AsString(), args[1].AsInt()
+				if err := checkIndex(index, len(s), "a string"); err != nil {
+					return Nil, err
+				}
+				return IntValue(int(s[index])), nil
+			},
+		},
+		{
+			Name:       "__str_from_char_code",
+			Params:     []string{"int"},
+			ReturnType: "string",
+			Implementation: func(args ...Value) (Value, error) {
+				return StringValue(string(rune(args[0].AsInt()))), nil
+			},
+		},
+		{
+			Name:       "__str_from_int",
+			Params:     []string{"int"},
+			ReturnType: "string",
+			Implementation: func(args ...Value) (Value, error) {
+				return StringValue(strconv.Itoa(args[0].AsInt())), nil
+			},
+		},
+		{
+			Name:       "__str_to_int",
+			Params:     []string{"string"},
+			ReturnType: "Result<int, string>",
+			Implementation: func(args ...Value) (Value, error) {
+				value, err := strconv.Atoi(args[0].AsString())
+				if err != nil {
+					return ObjectValue(&Result{Value: StringValue(fmt.Sprintf("cannot convert %q to int", args[0].AsString()))}), nil
+				}
+				return ObjectValue(&Result{Ok: true, Value: IntValue(value)}), nil
+			},
+		},
+		{
+			Name:       "format",
+			Params:     []string{"any", "string"},
+			ReturnType: "string",
+			Implementation: func(args ...Value) (Value, error) {
+				spec, err := ParseFormatSpec(args[1].AsString())
+				if err != nil {
+					return Nil, err
+				}
+				text, err := Format(args[0], spec)
+				if err != nil {
+					return Nil, err
+				}
+				return StringValue(text), nil
+			},
+			Allocates: func(args ...Value) int {
+				return FormatSize(args[0], args[1].AsString())
+			},
+		},
+		{
+			Name:       "__array_len",
+			Params:     []string{"any"},
+			ReturnType: "int",
+			Implementation: func(args ...Value) (Value, error) {
+				return IntValue(len(args[0].Object().(*Array).Elements)), nil
+			},
+		},
+		{
+			Name:       "__array_push",
+			Params:     []string{"any", "any"},
+			ReturnType: "int",
+			Implementation: func(args ...Value) (Value, error) {
+				array := args[0].Object().(*Array)
+				array.Elements = append(array.Elements, args[1])
+				return IntValue(len(array.Elements)), nil
+			},
+		},
+		{
+			Name:       "__array_set",
+			Params:     []string{"any", "int", "any"},
+			ReturnType: "int",
+			Implementation: func(args ...Value) (Value, error) {
+				array := args[0].Object().(*Array)
+				index := args[1].AsInt()
+				if err := checkIndex(index, len(array.Elements), "an array"); err != nil {
+					return Nil, err
+				}
+				array.Elements[index] = args[2]
+				return IntValue(len(array.Elements)), nil
+			},
+		},
+		{
+			Name:       "__array_slice",
+			Params:     []string{"any", "int", "int"},
+			ReturnType: "any",
+			Implementation: func(args ...Value) (Value, error) {
+				elements, start, end := args[0].Object().(*Array).Elements, args[1].AsInt(), args[2].AsInt()
+				if err := checkRange(start, end, len(elements), "an array"); err != nil {
+					return Nil, err
+				}
+				elements = elements[start:end]
+				return ObjectValue(&Array{Elements: append([]Value{}, elements...)}), nil
+			},
+			Allocates: func(args ...Value) int {
+				return ArraySize(rangeLength(args[1].AsInt(), args[2].AsInt(), len(args[0].Object().(*Array).Elements)))
+			},
+		},
+		{
+			Name:       "__map_new",
+			Params:     []string{},
+			ReturnType: "any",
+			Implementation: func(args ...Value) (Value, error) {
+				return ObjectValue(NewMap()), nil
+			},
 		},
+		{
+			Name:       "__map_len",
+			Params:     []string{"any"},
+			ReturnType: "int",
+			Implementation: func(args ...Value) (Value, error) {
+				return IntValue(len(args[0].Object().(*Map).Keys)), nil
+			},
+		},
+		{
+			Name:       "__map_has",
+			Params:     []string{"any", "any"},
+			ReturnType: "bool",
+			Implementation: func(args ...Value) (Value, error) {
+				_, exists := args[0].Object().(*Map).Entries[args[1]]
+				return BoolValue(exists), nil
+			},
+		},
+		{
+			Name:       "__map_set",
+			Params:     []string{"any", "any", "any"},
+			ReturnType: "int",
+			Implementation: func(args ...Value) (Value, error) {
+				m := args[0].Object().(*Map)
+				m.Set(args[1], args[2])
+				return IntValue(len(m.Keys)), nil
+			},
+		},
+		{
+			Name:       "__map_delete",
+			Params:     []string{"any", "any"},
+			ReturnType: "int",
+			Implementation: func(args ...Value) (Value, error) {
+				m := args[0].Object().(*Map)
+				m.Delete(args[1])
+				return IntValue(len(m.Keys)), nil
+			},
+		},
+		{
+			Name:       "__map_keys",
+			Params:     []string{"any"},
+			ReturnType: "any",
+			Implementation: func(args ...Value) (Value, error) {
+				return ObjectValue(&Array{Elements: append([]Value{}, args[0].Object().(*Map).Keys...)}), nil
+			},
+			Allocates: func(args ...Value) int {
+				return ArraySize(len(args[0].Object().(*Map).Keys))
+			},
+		},
+		{
+			Name:       "ok",
+			TypeParams: []string{"T"},
+			Params:     []string{"T"},
+			ReturnType: "Result<T, any>",
+			Implementation: func(args ...Value) (Value, error) {
+				return ObjectValue(&Result{Ok: true, Value: args[0]}), nil
+			},
+		},
+		{
+			Name:       "err",
+			TypeParams: []string{"E"},
+			Params:     []string{"E"},
+			ReturnType: "Result<any, E>",
+			Implementation: func(args ...Value) (Value, error) {
+				return ObjectValue(&Result{Value: args[0]}), nil
+			},
+		},
+		{
+			Name:       "__result_is_ok",
+			Params:     []string{"any"},
+			ReturnType: "bool",
+			Implementation: func(args ...Value) (Value, error) {
+				return BoolValue(args[0].Object().(*Result).Ok), nil
+			},
+		},
+		{
+			Name:       "__result_value",
+			Params:     []string{"any"},
+			ReturnType: "any",
+			Implementation: func(args ...Value) (Value, error) {
+				result := args[0].Object().(*Result)
+				if !result.Ok {
+					return Nil, fmt.Errorf("called unwrap on %v", result)
+				}
+				return result.Value, nil
+			},
+		},
+		{
+			Name:       "__result_error",
+			Params:     []string{"any"},
+			ReturnType: "any",
+			Implementation: func(args ...Value) (Value, error) {
+				result := args[0].Object().(*Result)
+				if result.Ok {
+					return Nil, fmt.Errorf("called errorOf on %v", result)
+				}
+				return result.Value, nil
+			},
+		},
+		{
+			Name:       "channel",
+			Params:     []string{"int"},
+			ReturnType: "chan<any>",
+		},
+		{
+			Name:       "send",
+			TypeParams: []string{"T"},
+			Params:     []string{"chan<T>", "T"},
+			ReturnType: "void",
+		},
+		{
+			Name:       "receive",
+			TypeParams: []string{"T"},
+			Params:     []string{"chan<T>"},
+			ReturnType: "T?",
+		},
+		{
+			Name:       "close",
+			TypeParams: []string{"T"},
+			Params:     []string{"chan<T>"},
+			ReturnType: "void",
+		},
+		{
+			Name:       "range",
+			Params:     []string{"int", "int"},
+			ReturnType: "gen<int>",
+			Implementation: func(args ...Value) (Value, error) {
+				return ObjectValue(&Range{Next: args[0].AsInt(), End: args[1].AsInt()}), nil
+			},
+		},
+	}
+}
+
+// Lookup finds a builtin by name and returns its CALL_BUILTIN index
+func Lookup(name string) (int, Builtin, bool) {
+	for i, builtin := range GetBuiltins() {
+		if builtin.Name == name {
+			return i, builtin, true
+		}
 	}
-	return builtins
+	return -1, Builtin{}, false
 }
@@ -0,0 +1,120 @@
+package builtins
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Kind is the type tag of a Value
+type Kind uint8
+
+const (
+	// KindNil is the kind of the zero Value, which stands for the missing
+	// result of a void call and is never stored
+	KindNil Kind = iota
+	KindInt
+	KindBool
+	KindString
+	KindNone
+	// KindObject is the kind of values held by reference: arrays, maps,
+	// results and the closures and cells of the VM
+	KindObject
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindNil:
+		return "nil"
+	case KindInt:
+		return "int"
+	case KindBool:
+		return "bool"
+	case KindString:
+		return "string"
+	case KindNone:
+		return "none"
+	case KindObject:
+		return "object"
+	default:
+		return fmt.Sprintf("kind(%d)", uint8(k))
+	}
+}
+
+// Value is the runtime representation of Alna values. Ints and bools are
+// held in bits, so they are stored and computed without allocating, while
+// strings and objects are held in obj. Values of the same kind and contents
+// are equal with ==, which makes them usable as map keys.
+type Value struct {
+	Kind Kind
+	bits uint64
+	obj  any
+}
+
+// Nil is the missing result of a void call
+var Nil = Value{}
+
+// None is the value of none, which optional values hold when they hold
+// nothing. Optionals are otherwise represented as the values they hold.
+var None = Value{Kind: KindNone}
+
+func IntValue(n int) Value {
+	return Value{Kind: KindInt, bits: uint64(n)}
+}
+
+func BoolValue(b bool) Value {
+	if b {
+		return Value{Kind: KindBool, bits: 1}
+	}
+	return Value{Kind: KindBool}
+}
+
+func StringValue(s string) Value {
+	return Value{Kind: KindString, obj: s}
+}
+
+// ObjectValue wraps a value held by reference, such as an *Array
+func ObjectValue(obj any) Value {
+	return Value{Kind: KindObject, obj: obj}
+}
+
+// AsInt returns the int held by an int value
+func (v Value) AsInt() int {
+	return int(v.bits)
+}
+
+// AsBool returns the bool held by a bool value
+func (v Value) AsBool() bool {
+	return v.bits != 0
+}
+
+// AsString returns the string held by a string value
+func (v Value) AsString() string {
+	s, _ := v.obj.(string)
+	return s
+}
+
+// Object returns the object held by an object value, or nil for other kinds
+func (v Value) Object() any {
+	if v.Kind != KindObject {
+		return nil
+	}
+	return v.obj
+}
+
+// String formats the value the way Alna prints it
+func (v Value) String() string {
+	switch v.Kind {
+	case KindInt:
+		return strconv.Itoa(v.AsInt())
+	case KindBool:
+		return strconv.FormatBool(v.AsBool())
+	case KindString:
+		return v.AsString()
+	case KindNone:
+		return "none"
+	case KindObject:
+		return fmt.Sprint(v.obj)
+	default:
+		return "<nil>"
+	}
+}
@@ -0,0 +1,206 @@
+package codegen
+
+import "alna-lang/internal/ast"
+
+// freeVariables returns the names a function literal uses without declaring
+// them, in order of first use. Names that turn out to be functions rather
+// than variables of an enclosing function are filtered out by the caller.
+func freeVariables(node ast.FunctionLiteralNode) []string {
+	collector := &freeVariableCollector{seen: make(map[string]bool)}
+	scope := make(map[string]bool)
+	for _, param := range node.Parameters {
+		scope[param.Name] = true
+	}
+	collector.block(node.Body.Expressions, []map[string]bool{scope})
+	return collector.names
+}
+
+// capturedVariables returns the names captured by the function literals
+// nested anywhere in a function body. Variables with these names are stored
+// in cells so that closures share them with the function that declares them.
+func capturedVariables(body ast.BlockNode) map[string]bool {
+	captured := make(map[string]bool)
+	var visit func(node ast.Node)
+	visit = func(node ast.Node) {
+		if literal, ok := node.(ast.FunctionLiteralNode); ok {
+			for _, name := range freeVariables(literal) {
+				captured[name] = true
+			}
+			return
+		}
+		for _, child := range children(node) {
+			visit(child)
+		}
+	}
+
+	for _, expr := range body.Expressions {
+		visit(expr)
+	}
+	return captured
+}
+
+type freeVariableCollector struct {
+	names []string
+	seen  map[string]bool
+}
+
+func (c *freeVariableCollector) use(name string, scopes []map[string]bool) {
+	for _, scope := range scopes {
+		if scope[name] {
+			return
+		}
+	}
+	if !c.seen[name] {
+		c.seen[name] = true
+		c.names = append(c.names, name)
+	}
+}
+
+func (c *freeVariableCollector) block(expressions []ast.Node, scopes []map[string]bool) {
+	scopes = append(scopes, make(map[string]bool))
+	for _, expr := range expressions {
+		c.visit(expr, scopes)
+	}
+}
+
+func (c *freeVariableCollector) visit(node ast.Node, scopes []map[string]bool) {
+	switch n := node.(type) {
+	case ast.IdentifierNode:
+		c.use(n.Name, scopes)
+	case ast.FunctionCallNode:
+		c.use(n.Name, scopes)
+	case ast.AssignmentNode:
+		c.visit(n.Left, scopes)
+	case ast.DestructuringNode:
+		c.visit(n.Value, scopes)
+		for _, target := range n.Targets {
+			switch {
+			case target.Name == "_":
+			case n.Declare:
+				scopes[len(scopes)-1][target.Name] = true
+			default:
+				c.use(target.Name, scopes)
+			}
+		}
+		return
+	case ast.VariableDeclarationNode:
+		if n.Initializer != nil {
+			c.visit(n.Initializer, scopes)
+		}
+		scopes[len(scopes)-1][n.Name] = true
+		return
+	case ast.BlockNode:
+		c.block(n.Expressions, scopes)
+		return
+	case *ast.BlockNode:
+		if n != nil {
+			c.block(n.Expressions, scopes)
+		}
+		return
+	case ast.FunctionLiteralNode:
+		scope := make(map[string]bool)
+		for _, param := range n.Parameters {
+			scope[param.Name] = true
+		}
+		c.block(n.Body.Expressions, append(scopes, scope))
+		return
+	case ast.SelectNode:
+		for _, selectCase := range n.Cases {
+			c.visit(selectCase.Operation, scopes)
+			if selectCase.Binding != nil {
+				c.visit(selectCase.Body, append(scopes, map[string]bool{selectCase.Binding.Name: true}))
+			} else {
+				c.visit(selectCase.Body, scopes)
+			}
+		}
+		if n.Else != nil {
+			c.visit(n.Else, scopes)
+		}
+		return
+	case ast.ForNode:
+		c.visit(n.Iterable, scopes)
+		c.visit(n.Body, append(scopes, map[string]bool{n.Binding.Name: true}))
+		return
+	case ast.IfExpressionNode:
+		if n.Binding == nil {
+			break
+		}
+		c.visit(n.Condition, scopes)
+		c.visit(n.ThenBranch, append(scopes, map[string]bool{n.Binding.Name: true}))
+		if n.ElseBranch != nil {
+			c.visit(n.ElseBranch, scopes)
+		}
+		return
+	}
+
+	for _, child := range children(node) {
+		c.visit(child, scopes)
+	}
+}
+
+// children returns the nodes directly nested in node, except for the names of
+// variables and functions it refers to
+func children(node ast.Node) []ast.Node {
+	switch n := node.(type) {
+	case ast.BinaryOpNode:
+		return []ast.Node{n.Left, n.Right}
+	case ast.ArrayLiteralNode:
+		return n.Elements
+	case ast.IndexNode:
+		return []ast.Node{n.Target, n.Index}
+	case ast.TryNode:
+		return []ast.Node{n.Value}
+	case ast.FunctionCallNode:
+		return n.PositionalArguments()
+	case ast.IfExpressionNode:
+		nodes := []ast.Node{n.Condition, n.ThenBranch}
+		if n.ElseBranch != nil {
+			nodes = append(nodes, n.ElseBranch)
+		}
+		return nodes
+	case ast.BlockNode:
+		return n.Expressions
+	case *ast.BlockNode:
+		if n == nil {
+			return nil
+		}
+		return n.Expressions
+	case ast.VariableDeclarationNode:
+		if n.Initializer == nil {
+			return nil
+		}
+		return []ast.Node{n.Initializer}
+	case ast.AssignmentNode:
+		return []ast.Node{n.Right}
+	case ast.DestructuringNode:
+		return []ast.Node{n.Value}
+	case ast.ValueListNode:
+		return n.Values
+	case ast.DeferNode:
+		return []ast.Node{n.Call}
+	case ast.SpawnNode:
+		return []ast.Node{n.Call}
+	case ast.SelectNode:
+		var nodes []ast.Node
+		for _, selectCase := range n.Cases {
+			nodes = append(nodes, selectCase.Operation, selectCase.Body)
+		}
+		if n.Else != nil {
+			nodes = append(nodes, n.Else)
+		}
+		return nodes
+	case ast.ForNode:
+		return []ast.Node{n.Iterable, n.Body}
+	case ast.YieldNode:
+		return []ast.Node{n.Value}
+	case ast.ReturnNode:
+		if n.Value == nil {
+			return nil
+		}
+		return []ast.Node{n.Value}
+	case ast.FunctionLiteralNode:
+		return n.Body.Expressions
+	default:
+		return nil
+	}
+}
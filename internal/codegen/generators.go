@@ -0,0 +1,78 @@
+package codegen
+
+import (
+	"alna-lang/internal/ast"
+	"alna-lang/internal/opcode"
+	symboltable "alna-lang/internal/symbol_table"
+)
+
+// generateFor emits a for-in loop. ITER makes an iterator of the value
+// iterated over, which is kept in a hidden variable of a scope around the
+// loop. Every turn of the loop starts with NEXT, which leaves the next value
+// for the body to declare, or jumps out of the loop once there is none.
+func (cg *CodeGenerator) generateFor(node ast.ForNode, st *symboltable.SymbolTable) {
+	cg.generateBinaryExpression(node.Iterable, st)
+	cg.setCurrentSourcePos(node)
+	cg.emit(opcode.ITER)
+
+	varsBeforeScope := len(cg.variables)
+	savedVariablesMap := make(map[string]int, len(cg.variablesMap))
+	for name, idx := range cg.variablesMap {
+		savedVariablesMap[name] = idx
+	}
+
+	cg.scopeDepth++
+	cg.emit(opcode.START_SCOPE, varsBeforeScope)
+	iteratorSlot := cg.AddVariable("<iterator>")
+	cg.emit(opcode.STORE_VAR, iteratorSlot)
+
+	loopStart := len(cg.mainBytecode)
+	cg.emit(opcode.LOAD_VAR, iteratorSlot)
+	cg.emit(opcode.NEXT, 0)
+	bodyStart := len(cg.mainBytecode)
+	cg.generateUnwrapped(node.Binding.Name, node.Body, st, cg.generateExpression)
+	cg.setCurrentSourcePos(node)
+	cg.emit(opcode.JUMP, 0)
+	cg.patchAddress(len(cg.mainBytecode)-2, loopStart)
+	cg.patchAddress(bodyStart-2, len(cg.mainBytecode))
+
+	cg.emit(opcode.END_SCOPE)
+	cg.variables = cg.variables[:varsBeforeScope]
+	cg.variablesMap = savedVariablesMap
+	cg.scopeDepth--
+}
+
+// generateYield emits a yield statement, which suspends the generator
+// after pushing the value it hands to the loop resuming it
+func (cg *CodeGenerator) generateYield(node ast.YieldNode, st *symboltable.SymbolTable) {
+	cg.generateBinaryExpression(node.Value, st)
+	cg.setCurrentSourcePos(node)
+	cg.emit(opcode.YIELD)
+}
+
+// emitGenerator emits the start of a function that yields, once its
+// arguments are stored into its parameters. Calling the function runs no
+// further: GENERATOR suspends its frame into a generator, which it returns,
+// and the body after it runs as the generator is resumed.
+func (cg *CodeGenerator) emitGenerator() {
+	cg.emit(opcode.GENERATOR, 0)
+	resumeOffset := len(cg.mainBytecode) - 2
+	cg.emit(opcode.RETURN, 1)
+	cg.patchAddress(resumeOffset, len(cg.mainBytecode))
+}
+
+// containsYield reports whether a function body has yield statements of its
+// own, leaving out those in the function literals it contains
+func containsYield(body ast.BlockNode) bool {
+	found := false
+	ast.Walk(body, func(node ast.Node) bool {
+		switch node.(type) {
+		case ast.YieldNode:
+			found = true
+		case ast.FunctionLiteralNode:
+			return false
+		}
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,143 @@
+package codegen
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// FunctionRange maps the code of a function, from Start up to End, to the
+// function's name and the source file it was declared in
+type FunctionRange struct {
+	Start int
+	End   int
+	Name  string
+	File  string
+}
+
+// LineEntry maps the instructions from Pc up to the next entry to the source
+// position they were generated from. Lines are 1-based.
+type LineEntry struct {
+	Pc     int
+	Line   int
+	Column int
+}
+
+// SetSourceFiles names the files functions were declared in, so runtime
+// errors can point at them. Functions missing from functionFiles belong to
+// sourceFile.
+func (cg *CodeGenerator) SetSourceFiles(sourceFile string, functionFiles map[string]string) {
+	cg.sourceFile = sourceFile
+	cg.functionFiles = functionFiles
+}
+
+// fileOf returns the source file the function called name was declared in
+func (cg *CodeGenerator) fileOf(name string) string {
+	if file, exists := cg.functionFiles[name]; exists {
+		return file
+	}
+	return cg.sourceFile
+}
+
+// addLineEntry maps the instruction at pc to the current source position,
+// unless it maps to the same position as the previous instruction
+func (cg *CodeGenerator) addLineEntry(pc int) {
+	if cg.currentSourcePos == nil {
+		return
+	}
+
+	pos := cg.currentSourcePos.Pos()
+	if pos.Line <= 0 || pos.Column < 0 {
+		return
+	}
+	if last := len(cg.lineTable) - 1; last >= 0 && cg.lineTable[last].Line == pos.Line && cg.lineTable[last].Column == pos.Column {
+		return
+	}
+	cg.lineTable = append(cg.lineTable, LineEntry{Pc: pc, Line: pos.Line, Column: pos.Column})
+}
+
+// writeLineTable appends the function ranges and line entries the VM uses to
+// build stack traces. Unlike the debug file, they are always emitted.
+func (cg *CodeGenerator) writeLineTable() {
+	cg.Bytecode = binary.LittleEndian.AppendUint16(cg.Bytecode, uint16(len(cg.functionRanges)))
+	for _, fn := range cg.functionRanges {
+		cg.Bytecode = binary.LittleEndian.AppendUint16(cg.Bytecode, uint16(fn.Start))
+		cg.Bytecode = binary.LittleEndian.AppendUint16(cg.Bytecode, uint16(fn.End))
+		cg.Bytecode = append(cg.Bytecode, byte(len(fn.Name)))
+		cg.Bytecode = append(cg.Bytecode, fn.Name...)
+		cg.Bytecode = append(cg.Bytecode, byte(len(fn.File)))
+		cg.Bytecode = append(cg.Bytecode, fn.File...)
+	}
+
+	cg.Bytecode = binary.LittleEndian.AppendUint16(cg.Bytecode, uint16(len(cg.lineTable)))
+	for _, entry := range cg.lineTable {
+		cg.Bytecode = binary.LittleEndian.AppendUint16(cg.Bytecode, uint16(entry.Pc))
+		cg.Bytecode = binary.LittleEndian.AppendUint16(cg.Bytecode, uint16(entry.Line))
+		cg.Bytecode = binary.LittleEndian.AppendUint16(cg.Bytecode, uint16(entry.Column))
+	}
+}
+
+// DecodeLineTable reads the function ranges and line entries at the start of
+// data and returns them with the number of bytes they took
+func DecodeLineTable(data []byte) ([]FunctionRange, []LineEntry, int, error) {
+	pos := 0
+	readUint16 := func() (int, error) {
+		if pos+2 > len(data) {
+			return 0, fmt.Errorf("unexpected end of line table")
+		}
+		value := int(binary.LittleEndian.Uint16(data[pos:]))
+		pos += 2
+		return value, nil
+	}
+	readString := func() (string, error) {
+		if pos >= len(data) || pos+1+int(data[pos]) > len(data) {
+			return "", fmt.Errorf("unexpected end of line table")
+		}
+		length := int(data[pos])
+		value := string(data[pos+1 : pos+1+length])
+		pos += 1 + length
+		return value, nil
+	}
+
+	functionCount, err := readUint16()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	functions := make([]FunctionRange, functionCount)
+	for i := range functions {
+		var fn FunctionRange
+		if fn.Start, err = readUint16(); err != nil {
+			return nil, nil, 0, err
+		}
+		if fn.End, err = readUint16(); err != nil {
+			return nil, nil, 0, err
+		}
+		if fn.Name, err = readString(); err != nil {
+			return nil, nil, 0, err
+		}
+		if fn.File, err = readString(); err != nil {
+			return nil, nil, 0, err
+		}
+		functions[i] = fn
+	}
+
+	entryCount, err := readUint16()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	lines := make([]LineEntry, entryCount)
+	for i := range lines {
+		var entry LineEntry
+		if entry.Pc, err = readUint16(); err != nil {
+			return nil, nil, 0, err
+		}
+		if entry.Line, err = readUint16(); err != nil {
+			return nil, nil, 0, err
+		}
+		if entry.Column, err = readUint16(); err != nil {
+			return nil, nil, 0, err
+		}
+		lines[i] = entry
+	}
+
+	return functions, lines, pos, nil
+}
@@ -3,9 +3,12 @@ package codegen
 import (
 	"alna-lang/internal/ast"
 	"alna-lang/internal/builtins"
+	"alna-lang/internal/common"
 	"alna-lang/internal/logger"
 	"alna-lang/internal/opcode"
 	symboltable "alna-lang/internal/symbol_table"
+	"alna-lang/internal/types"
+	"encoding/binary"
 	"encoding/json"
 	"os"
 	"strconv"
@@ -13,6 +16,8 @@ import (
 
 const IntTypeId = 1
 const FunctionTypeId = 2
+const BoolTypeId = 3
+const StringTypeId = 4
 
 type ConstantDefinition struct {
 	Value  any
@@ -46,7 +51,7 @@ type DebugInfo struct {
 	Version     int              `json:"version"`
 	SourceFile  string           `json:"sourceFile"`
 	SourceLines []string         `json:"sourceLines"`
-	Variables   []VariableInfo   `json:"variables"`
+	Globals     []VariableInfo   `json:"globals"`
 	Functions   []FunctionInfo   `json:"functions"`
 	SourceMap   []SourceMapEntry `json:"sourceMap"`
 }
@@ -71,10 +76,50 @@ type CodeGenerator struct {
 	compiledFuncMap    map[string]int
 	scopeDepth         int
 	functionScopeDepth int
+	callFixups         []callFixup
+	// captured holds the names of the current function's variables that
+	// closures capture, boxedSlots the slots where those variables live in
+	// cells, and upvalues the index of each variable a function literal
+	// captured from its enclosing functions
+	captured   map[string]bool
+	boxedSlots map[int]bool
+	upvalues   map[string]int
+	// globals holds the slots of the variables declared at the top level,
+	// and constValues the initializers of constants, which are inlined
+	globals     map[string]int
+	constValues map[string]ast.Node
+	// functionFiles maps functions declared outside sourceFile to their
+	// file, and currentFile is the file of the function being generated
+	functionFiles  map[string]string
+	currentFile    string
+	functionRanges []FunctionRange
+	lineTable      []LineEntry
+	// returnCounts holds the number of values returned by the declared
+	// functions that return several
+	returnCounts map[string]int
+	// defers is set while generating a function with defer statements,
+	// whose returns run the deferred calls first
+	defers bool
+	// tailStatements holds the positions of the call statements a void
+	// function ends with, which can be compiled as tail calls
+	tailStatements map[common.Position]bool
+	// recent holds the addresses of the last two instructions emitted, and
+	// lastJumpTarget the highest address a jump was patched to land on
+	recent         [2]int
+	lastJumpTarget int
+}
+
+// callFixup records a CALL whose target address is patched once every
+// function has been compiled, so functions can be called before they are
+// declared and recursively
+type callFixup struct {
+	Offset   int
+	Function string
+	Node     ast.Node
 }
 
 func NewCodeGenerator(tree ast.RootNode, srcLines []string, st *symboltable.SymbolTable, lgr *logger.Logger) *CodeGenerator {
-	return &CodeGenerator{ast: tree, sourceLines: srcLines, symbolTable: st, constantMap: make(map[interface{}]int), logger: lgr}
+	return &CodeGenerator{ast: tree, sourceLines: srcLines, symbolTable: st, constantMap: make(map[interface{}]int), logger: lgr, recent: [2]int{-1, -1}}
 }
 
 func (cg *CodeGenerator) SetDebugMode(sourceFile string) {
@@ -84,7 +129,7 @@ func (cg *CodeGenerator) SetDebugMode(sourceFile string) {
 		Version:     1,
 		SourceFile:  sourceFile,
 		SourceLines: cg.sourceLines,
-		Variables:   []VariableInfo{},
+		Globals:     []VariableInfo{},
 		Functions:   []FunctionInfo{},
 		SourceMap:   []SourceMapEntry{},
 	}
@@ -105,19 +150,28 @@ func (cg *CodeGenerator) AddConstant(typeId int, value interface{}) int {
 	return len(cg.constants) - 1
 }
 
+// AddVariable allocates a new slot for a declared variable. A declaration
+// always gets a fresh slot so that it can shadow a variable of an enclosing
+// scope without clobbering it. The slot may have held a captured variable of
+// a scope that has ended, so it starts out unboxed.
 func (cg *CodeGenerator) AddVariable(name string) int {
-	if idx, exists := cg.variablesMap[name]; exists {
-		return idx
-	}
 	if cg.variablesMap == nil {
 		cg.variablesMap = make(map[string]int)
 	}
 	cg.variablesMap[name] = len(cg.variables)
 	idx := len(cg.variables)
 	cg.variables = append(cg.variables, nil)
+	delete(cg.boxedSlots, idx)
+	return idx
+}
+
+// AddGlobal allocates the slot of a variable declared at the top level
+func (cg *CodeGenerator) AddGlobal(name string) int {
+	idx := len(cg.globals)
+	cg.globals[name] = idx
 
-	if cg.debugMode && cg.scopeDepth == 0 {
-		cg.debugInfo.Variables = append(cg.debugInfo.Variables, VariableInfo{
+	if cg.debugMode {
+		cg.debugInfo.Globals = append(cg.debugInfo.Globals, VariableInfo{
 			Index: idx,
 			Name:  name,
 		})
@@ -127,15 +181,14 @@ func (cg *CodeGenerator) AddVariable(name string) int {
 
 func (cg *CodeGenerator) Generate() string {
 	cg.Bytecode = append(cg.Bytecode, 0x7F, 'A', 'L', 'N')
-	cg.Bytecode = append(cg.Bytecode, 0x01, 0x00, 0x00, 0x00)
+	cg.Bytecode = append(cg.Bytecode, 0x02, 0x00, 0x00, 0x00)
 	cg.Bytecode = append(cg.Bytecode, 0x00, 0x00, 0x00, 0x00)
 
-	builtins := builtins.GetBuiltins()
 	cg.functionsMap = make(map[string]int)
 	cg.compiledFuncMap = make(map[string]int)
-	for name, fn := range builtins {
-		cg.functions = append(cg.functions, fn)
-		cg.functionsMap[name] = len(cg.functions) - 1
+	for _, builtin := range builtins.GetBuiltins() {
+		cg.functions = append(cg.functions, builtin.Implementation)
+		cg.functionsMap[builtin.Name] = len(cg.functions) - 1
 	}
 
 	st := cg.ast.SymbolTable
@@ -143,18 +196,75 @@ func (cg *CodeGenerator) Generate() string {
 	cg.logger.Debug("Symbol Table at root:")
 	cg.logger.Debug("%+v", st)
 
+	// Globals and constants are known up front, since functions can use
+	// them wherever they are declared
+	cg.globals = make(map[string]int)
+	cg.constValues = make(map[string]ast.Node)
+	cg.returnCounts = make(map[string]int)
+	var statements []ast.Node
+	for _, expr := range cg.ast.Children {
+		switch n := expr.(type) {
+		case ast.FunctionDeclarationNode:
+			if elems, isTuple := types.TupleTypes(n.ReturnType); isTuple {
+				cg.returnCounts[n.Name] = len(elems)
+			}
+			continue
+		case ast.VariableDeclarationNode:
+			if n.Constant {
+				cg.constValues[n.Name] = n.Initializer
+			} else {
+				cg.AddGlobal(n.Name)
+			}
+		case ast.DestructuringNode:
+			if n.Declare {
+				for _, target := range n.Targets {
+					if target.Name != "_" {
+						cg.AddGlobal(target.Name)
+					}
+				}
+			}
+		}
+		statements = append(statements, expr)
+	}
+
 	for _, expr := range cg.ast.Children {
+		if fn, ok := expr.(ast.FunctionDeclarationNode); ok {
+			cg.generateExpression(fn, st)
+		}
+	}
+
+	// The top-level statements run in order before main, initializing the
+	// globals. They end by jumping to main, which returns to no caller.
+	initAddress := len(cg.mainBytecode)
+	cg.currentFile = cg.sourceFile
+	cg.captured = capturedVariables(ast.BlockNode{Expressions: statements})
+	cg.boxedSlots = make(map[int]bool)
+	for _, expr := range statements {
 		cg.generateExpression(expr, st)
 	}
+	if _, hasMain := cg.compiledFuncMap["main"]; hasMain {
+		cg.emit(opcode.JUMP, 0)
+		cg.callFixups = append(cg.callFixups, callFixup{
+			Offset:   len(cg.mainBytecode) - 2,
+			Function: "main",
+		})
+	}
+	cg.functionRanges = append(cg.functionRanges, FunctionRange{
+		Start: initAddress,
+		End:   len(cg.mainBytecode),
+		Name:  "<init>",
+		File:  cg.sourceFile,
+	})
+	cg.resolveCalls()
 
 	cg.writeConstantsPool()
+	cg.writeLineTable()
 	cg.Bytecode = append(cg.Bytecode, cg.mainBytecode...)
 
-	mainAddress := cg.compiledFuncMap["main"]
-	cg.Bytecode[8] = byte(mainAddress & 0xFF)
-	cg.Bytecode[9] = byte((mainAddress >> 8) & 0xFF)
-	cg.Bytecode[10] = byte((mainAddress >> 16) & 0xFF)
-	cg.Bytecode[11] = byte((mainAddress >> 24) & 0xFF)
+	cg.Bytecode[8] = byte(initAddress & 0xFF)
+	cg.Bytecode[9] = byte((initAddress >> 8) & 0xFF)
+	cg.Bytecode[10] = byte((initAddress >> 16) & 0xFF)
+	cg.Bytecode[11] = byte((initAddress >> 24) & 0xFF)
 
 	return ""
 }
@@ -166,7 +276,17 @@ func (cg *CodeGenerator) writeConstantsPool() {
 		cg.Bytecode = append(cg.Bytecode, byte(constant.TypeId))
 		switch constant.TypeId {
 		case IntTypeId:
-			cg.Bytecode = append(cg.Bytecode, byte(constant.Value.(int8)))
+			cg.Bytecode = binary.LittleEndian.AppendUint64(cg.Bytecode, uint64(constant.Value.(int64)))
+		case BoolTypeId:
+			if constant.Value.(bool) {
+				cg.Bytecode = append(cg.Bytecode, 1)
+			} else {
+				cg.Bytecode = append(cg.Bytecode, 0)
+			}
+		case StringTypeId:
+			str := constant.Value.(string)
+			cg.Bytecode = binary.LittleEndian.AppendUint16(cg.Bytecode, uint16(len(str)))
+			cg.Bytecode = append(cg.Bytecode, str...)
 		case FunctionTypeId:
 			instructions := constant.Value.([]byte)
 			cg.Bytecode = append(cg.Bytecode, byte(len(instructions)))
@@ -176,125 +296,86 @@ func (cg *CodeGenerator) writeConstantsPool() {
 }
 
 func (cg *CodeGenerator) generateExpression(node ast.Node, st *symboltable.SymbolTable) string {
-	if cg.debugMode && node != nil {
+	if node != nil {
 		if block, ok := node.(*ast.BlockNode); ok && block == nil {
 		} else {
 			cg.setCurrentSourcePos(node)
 		}
 	}
 
+	// Statements leave the operand stack as they found it, so the value of an
+	// expression used as a statement is discarded
 	switch n := node.(type) {
-	case ast.NumberNode:
-		intValue, err := strconv.ParseInt(n.Value.(string), 10, 8)
-		if err != nil {
-			cg.logger.Error("Error parsing number '%s' at position %+v: %v", n.Value, n.Pos(), err)
-			return ""
-		}
-		constIdx := cg.AddConstant(IntTypeId, int8(intValue))
-		cg.logger.Debug("Generating LOAD_CONST for number %d at index %d", intValue, constIdx)
-		cg.emit(opcode.LOAD_CONST, constIdx)
-	case ast.IdentifierNode:
-		if varIdx, exists := cg.variablesMap[n.Name]; exists {
-			if cg.debugMode {
-				cg.emitWithVarName(opcode.LOAD_VAR, n.Name, varIdx)
-			} else {
-				cg.emit(opcode.LOAD_VAR, varIdx)
-			}
-		} else {
-			cg.logger.Error("Undefined variable '%s' at position %+v", n.Name, n.Pos())
-		}
+	case ast.NumberNode, ast.BooleanNode, ast.StringNode, ast.NoneNode, ast.IdentifierNode, ast.ArrayLiteralNode, ast.IndexNode:
+		cg.generateBinaryExpression(n, st)
+		cg.emit(opcode.POP)
 	case ast.VariableDeclarationNode:
 		return cg.generateVariableDeclaration(n, st)
 	case ast.AssignmentNode:
-		cg.generateExpression(n.Right, st)
-		var varName string
-		switch n.Left.(type) {
+		cg.generateBinaryExpression(n.Right, st)
+		switch target := n.Left.(type) {
 		case ast.IdentifierNode:
-			varName = n.Left.(ast.IdentifierNode).Name
-			if cg.debugMode {
-				cg.setCurrentSourcePos(node)
-				cg.emitWithVarName(opcode.STORE_VAR, varName, cg.variablesMap[varName])
-			} else {
-				cg.emit(opcode.STORE_VAR, cg.variablesMap[varName])
-			}
+			cg.setCurrentSourcePos(node)
+			cg.generateStore(target.Name)
 		default:
 			cg.logger.Error("Invalid assignment target at position %+v", n.Left.Pos())
 		}
 	case ast.BinaryOpNode:
 		cg.generateBinaryExpression(n, st)
+		cg.emit(opcode.POP)
 	case ast.IfExpressionNode:
-		cg.generateBinaryExpression(n.Condition, st)
-		if cg.debugMode {
-			cg.setCurrentSourcePos(node)
-		}
-		cg.emit(opcode.JUMP_IF_FALSE, 0)
-		thenStart := len(cg.mainBytecode)
-		cg.generateExpression(n.ThenBranch, st)
-		cg.emit(opcode.JUMP, 0)
-		elseJump := len(cg.mainBytecode)
-
-		if n.ElseBranch != nil {
-			elseStart := len(cg.mainBytecode)
-			cg.mainBytecode[thenStart-1] = byte(elseStart)
-			cg.generateExpression(n.ElseBranch, st)
-			cg.mainBytecode[elseJump-1] = byte(len(cg.mainBytecode))
-		} else {
-			cg.mainBytecode[thenStart-1] = byte(len(cg.mainBytecode))
-		}
+		cg.generateIf(n, st, cg.generateExpression)
 	case *ast.BlockNode:
 		if n == nil {
 			return ""
 		}
 
-		varsBeforeScope := len(cg.variables)
-		cg.scopeDepth++
-		cg.emit(opcode.START_SCOPE, varsBeforeScope)
-		for _, expr := range n.Expressions {
-			cg.generateExpression(expr, n.SymbolTable)
-		}
-		cg.emit(opcode.END_SCOPE)
-		cg.variables = cg.variables[:varsBeforeScope]
-		cg.scopeDepth--
+		cg.generateBlock(n.Expressions, n.SymbolTable, false)
 
 	case ast.BlockNode:
 		cg.logger.Debug("Entering new block scope in codegen")
-		varsBeforeScope := len(cg.variables)
-		cg.scopeDepth++
-		cg.emit(opcode.START_SCOPE, varsBeforeScope)
-		for _, expr := range n.Expressions {
-			cg.generateExpression(expr, n.SymbolTable)
-		}
-		cg.emit(opcode.END_SCOPE)
-		cg.variables = cg.variables[:varsBeforeScope]
-		cg.scopeDepth--
+		cg.generateBlock(n.Expressions, n.SymbolTable, false)
+	case ast.DestructuringNode:
+		cg.generateDestructuring(n, st)
+	case ast.DeferNode:
+		cg.generateDefer(n, st)
+	case ast.SpawnNode:
+		cg.generateSpawn(n, st)
+	case ast.SelectNode:
+		cg.generateSelect(n, st)
+	case ast.ForNode:
+		cg.generateFor(n, st)
+	case ast.YieldNode:
+		cg.generateYield(n, st)
 	case ast.FunctionCallNode:
-		cg.logger.Debug("Generating function call to '%s'", n.Name)
-		cg.logger.Debug("Function is at address: %d", cg.compiledFuncMap[n.Name])
-		for _, arg := range n.Arguments {
-			cg.generateExpression(arg, st)
-		}
-		if cg.debugMode {
-			cg.setCurrentSourcePos(node)
+		if cg.tailStatements[n.Pos()] && cg.returnCount(n) == 1 && cg.generateTailCall(n, st) {
+			return ""
 		}
-		if fnIdx, exists := cg.functionsMap[n.Name]; exists {
-			cg.emit(opcode.CALL_BUILTIN, fnIdx)
-		} else {
-
-			if fnIdx, exists := cg.compiledFuncMap[n.Name]; exists {
-				cg.emit(opcode.CALL, fnIdx)
-			} else {
-				cg.logger.Error("Undefined function '%s' at position %+v", n.Name, n.Pos())
-			}
-
+		cg.generateBinaryExpression(n, st)
+		for i := 0; i < cg.returnCount(n); i++ {
+			cg.emit(opcode.POP)
 		}
+	case ast.FunctionLiteralNode, ast.TryNode:
+		cg.generateBinaryExpression(n, st)
+		cg.emit(opcode.POP)
 	case ast.FunctionDeclarationNode:
 		return cg.generateFunctionDeclaration(n, st)
 	case ast.ReturnNode:
+		if call, isCall := n.Value.(ast.FunctionCallNode); isCall && cg.generateTailCall(call, st) {
+			return ""
+		}
+		valueCount := 1
+		if n.Value != nil {
+			valueCount = cg.generateValues(n.Value, st)
+			cg.setCurrentSourcePos(node)
+		} else {
+			cg.emit(opcode.LOAD_NIL)
+		}
 		scopesToClose := cg.scopeDepth - cg.functionScopeDepth
 		for i := 0; i < scopesToClose; i++ {
 			cg.emit(opcode.END_SCOPE)
 		}
-		cg.emit(opcode.RETURN)
+		cg.emitReturn(valueCount)
 	default:
 		cg.logger.Warn("Unknown expression type: %T at position %+v", node, node.Pos())
 	}
@@ -302,93 +383,403 @@ func (cg *CodeGenerator) generateExpression(node ast.Node, st *symboltable.Symbo
 	return ""
 }
 
+// generateBlock emits the expressions of a block in a new scope. When
+// yieldValue is set, the last expression is left on the stack as the value of
+// the block.
+func (cg *CodeGenerator) generateBlock(expressions []ast.Node, st *symboltable.SymbolTable, yieldValue bool) {
+	varsBeforeScope := len(cg.variables)
+	savedVariablesMap := make(map[string]int, len(cg.variablesMap))
+	for name, idx := range cg.variablesMap {
+		savedVariablesMap[name] = idx
+	}
+
+	cg.scopeDepth++
+	cg.emit(opcode.START_SCOPE, varsBeforeScope)
+	for i, expr := range expressions {
+		if yieldValue && i == len(expressions)-1 {
+			cg.generateBinaryExpression(expr, st)
+		} else {
+			cg.generateExpression(expr, st)
+		}
+	}
+	cg.emit(opcode.END_SCOPE)
+	cg.variables = cg.variables[:varsBeforeScope]
+	cg.variablesMap = savedVariablesMap
+	cg.scopeDepth--
+}
+
+// generateIf emits the condition and jumps of an if expression, using
+// generateBranch for its then and else branches. An if unwrapping an optional
+// takes the else branch when it is none, and otherwise runs the then branch
+// in a scope holding the unwrapped value.
+func (cg *CodeGenerator) generateIf(node ast.IfExpressionNode, st *symboltable.SymbolTable, generateBranch func(ast.Node, *symboltable.SymbolTable) string) {
+	cg.generateBinaryExpression(node.Condition, st)
+	cg.setCurrentSourcePos(node)
+	if node.Binding != nil {
+		cg.emit(opcode.JUMP_IF_NONE, 0)
+	} else {
+		cg.emit(opcode.JUMP_IF_FALSE, 0)
+	}
+	thenStart := len(cg.mainBytecode)
+	if node.Binding != nil {
+		cg.generateUnwrapped(node.Binding.Name, node.ThenBranch, st, generateBranch)
+	} else {
+		generateBranch(node.ThenBranch, st)
+	}
+
+	if node.ElseBranch == nil {
+		cg.patchAddress(thenStart-2, len(cg.mainBytecode))
+		return
+	}
+
+	cg.emit(opcode.JUMP, 0)
+	elseJump := len(cg.mainBytecode)
+	cg.patchAddress(thenStart-2, elseJump)
+	generateBranch(node.ElseBranch, st)
+	cg.patchAddress(elseJump-2, len(cg.mainBytecode))
+}
+
+// generateUnwrapped emits the then branch of an if unwrapping an optional, in
+// a scope where name holds the unwrapped value on top of the stack
+func (cg *CodeGenerator) generateUnwrapped(name string, branch ast.Node, st *symboltable.SymbolTable, generateBranch func(ast.Node, *symboltable.SymbolTable) string) {
+	varsBeforeScope := len(cg.variables)
+	savedVariablesMap := make(map[string]int, len(cg.variablesMap))
+	for variable, idx := range cg.variablesMap {
+		savedVariablesMap[variable] = idx
+	}
+
+	cg.scopeDepth++
+	cg.emit(opcode.START_SCOPE, varsBeforeScope)
+	cg.generateDeclare(name)
+	generateBranch(branch, st)
+	cg.emit(opcode.END_SCOPE)
+	cg.variables = cg.variables[:varsBeforeScope]
+	cg.variablesMap = savedVariablesMap
+	cg.scopeDepth--
+}
+
+// generateBranchValue emits a branch of an if expression whose value is
+// used. The statements of the block are generated as usual and its last
+// expression is left on the stack as the value of the branch.
+func (cg *CodeGenerator) generateBranchValue(branch ast.Node, st *symboltable.SymbolTable) string {
+	block, ok := branch.(ast.BlockNode)
+	if !ok {
+		return cg.generateBinaryExpression(branch, st)
+	}
+
+	cg.generateBlock(block.Expressions, block.SymbolTable, true)
+	return ""
+}
+
 func (cg *CodeGenerator) generateFunctionDeclaration(node ast.FunctionDeclarationNode, st *symboltable.SymbolTable) string {
 	cg.logger.Debug("Generating function declaration for '%s'", node.Name)
 
 	functionStartPos := len(cg.mainBytecode)
-	cg.functionScopeDepth = cg.scopeDepth
+	cg.currentFile = cg.fileOf(node.Name)
+	returnCount := 1
+	if count, returnsSeveral := cg.returnCounts[node.Name]; returnsSeveral {
+		returnCount = count
+	}
+	cg.generateFunctionBody(node.Parameters, node.Body, nil, returnCount, node.ReturnType == types.Void)
+	cg.functionRanges = append(cg.functionRanges, FunctionRange{
+		Start: functionStartPos,
+		End:   len(cg.mainBytecode),
+		Name:  node.Name,
+		File:  cg.currentFile,
+	})
+
+	cg.logger.Debug("Saving function '%s' start position at bytecode index %d", node.Name, functionStartPos)
+	cg.compiledFuncMap[node.Name] = functionStartPos
+
+	return ""
+}
+
+// generateFunctionLiteral emits the body of an anonymous function in place,
+// jumping over it, followed by the MAKE_CLOSURE that creates a closure over
+// the variables it captures
+func (cg *CodeGenerator) generateFunctionLiteral(node ast.FunctionLiteralNode) {
+	var captures []string
+	for _, name := range freeVariables(node) {
+		_, isLocal := cg.variablesMap[name]
+		_, isUpvalue := cg.upvalues[name]
+		if isLocal || isUpvalue {
+			captures = append(captures, name)
+		}
+	}
+
+	cg.emit(opcode.JUMP, 0)
+	jumpEnd := len(cg.mainBytecode)
+	cg.generateFunctionBody(node.Parameters, node.Body, captures, 1, node.ReturnType == types.Void)
+	cg.patchAddress(jumpEnd-2, len(cg.mainBytecode))
+	cg.functionRanges = append(cg.functionRanges, FunctionRange{
+		Start: jumpEnd,
+		End:   len(cg.mainBytecode),
+		Name:  "<anonymous>",
+		File:  cg.currentFile,
+	})
+
+	cg.setCurrentSourcePos(node)
+	// Captured locals already hold cells, which the closure shares with
+	// the enclosing function
+	for _, name := range captures {
+		if slot, isLocal := cg.variablesMap[name]; isLocal {
+			cg.emitWithVarName(opcode.LOAD_VAR, name, slot)
+		} else {
+			cg.emit(opcode.CAPTURE_UPVALUE, cg.upvalues[name])
+		}
+	}
+	cg.emit(opcode.MAKE_CLOSURE, jumpEnd, len(captures))
+}
+
+// generateFunctionBody emits a function that starts by storing its arguments
+// into its parameters and returns returnCount values, or nothing when void
+// is set. A function that yields returns a generator running the rest of its
+// body instead. Functions get a frame of their own, so the state of an
+// enclosing function is saved and restored around them.
+func (cg *CodeGenerator) generateFunctionBody(params []ast.FunctionParam, body ast.BlockNode, upvalues []string, returnCount int, void bool) {
+	savedVariablesMap, savedVariables := cg.variablesMap, cg.variables
+	savedCaptured, savedBoxedSlots, savedUpvalues := cg.captured, cg.boxedSlots, cg.upvalues
+	savedFunctionScopeDepth, savedDefers := cg.functionScopeDepth, cg.defers
+	savedTailStatements := cg.tailStatements
 
-	savedVariablesMap := cg.variablesMap
-	savedVariables := cg.variables
 	cg.variablesMap = make(map[string]int)
 	cg.variables = nil
+	cg.captured = capturedVariables(body)
+	cg.boxedSlots = make(map[int]bool)
+	cg.upvalues = make(map[string]int)
+	for i, name := range upvalues {
+		cg.upvalues[name] = i
+	}
+	cg.functionScopeDepth = cg.scopeDepth
+	cg.defers = containsDefer(body)
+	cg.tailStatements = nil
+	if void {
+		cg.tailStatements = make(map[common.Position]bool)
+		markTailStatements(body.Expressions, cg.tailStatements)
+	}
 
 	cg.scopeDepth++
 	cg.emit(opcode.START_SCOPE, 0)
 
-	cg.logger.Debug("Adding function's %d parameters to variable map", len(node.Parameters))
-	for _, param := range node.Parameters {
-		varIdx := cg.AddVariable(param.Name)
-		cg.emitWithVarName(opcode.STORE_VAR, param.Name, varIdx)
+	cg.logger.Debug("Adding function's %d parameters to variable map", len(params))
+	paramIndexes := make([]int, len(params))
+	for i, param := range params {
+		paramIndexes[i] = cg.AddVariable(param.Name)
+	}
+
+	// Arguments are pushed in order, so the last one is on top of the stack
+	for i := len(params) - 1; i >= 0; i-- {
+		cg.emitWithVarName(opcode.STORE_VAR, params[i].Name, paramIndexes[i])
+	}
+
+	for i, param := range params {
+		if cg.captured[param.Name] {
+			cg.emitWithVarName(opcode.LOAD_VAR, param.Name, paramIndexes[i])
+			cg.emit(opcode.BOX)
+			cg.emitWithVarName(opcode.STORE_VAR, param.Name, paramIndexes[i])
+			cg.boxedSlots[paramIndexes[i]] = true
+		}
+	}
+
+	if containsYield(body) {
+		cg.emitGenerator()
 	}
 
-	for _, expr := range node.Body.Expressions {
+	for _, expr := range body.Expressions {
 		cg.logger.Debug("Generating function body expression")
-		cg.generateExpression(expr, node.Body.SymbolTable)
+		cg.generateExpression(expr, body.SymbolTable)
+	}
+
+	// Every call leaves as many values on the stack as the function returns.
+	// The analyzer makes functions returning values end in a return, so only
+	// void functions and generators get here, with a nil value.
+	for i := 0; i < returnCount; i++ {
+		cg.emit(opcode.LOAD_NIL)
 	}
 	cg.emit(opcode.END_SCOPE)
-	cg.emit(opcode.RETURN)
+	cg.emitReturn(returnCount)
 	cg.scopeDepth--
 
-	cg.variablesMap = savedVariablesMap
-	cg.variables = savedVariables
+	cg.variablesMap, cg.variables = savedVariablesMap, savedVariables
+	cg.captured, cg.boxedSlots, cg.upvalues = savedCaptured, savedBoxedSlots, savedUpvalues
+	cg.functionScopeDepth, cg.defers = savedFunctionScopeDepth, savedDefers
+	cg.tailStatements = savedTailStatements
+}
 
-	cg.logger.Debug("Saving function '%s' start position at bytecode index %d", node.Name, functionStartPos)
-	cg.compiledFuncMap[node.Name] = functionStartPos
+func (cg *CodeGenerator) generateVariableDeclaration(node ast.VariableDeclarationNode, st *symboltable.SymbolTable) string {
+	if node.Constant {
+		return ""
+	}
+
+	if node.Initializer != nil {
+		cg.generateBinaryExpression(node.Initializer, st)
+	} else {
+		cg.generateZeroValue(node.Type)
+	}
 
+	cg.setCurrentSourcePos(node)
+	cg.generateDeclare(node.Name)
 	return ""
 }
 
-func (cg *CodeGenerator) generateVariableDeclaration(node ast.VariableDeclarationNode, st *symboltable.SymbolTable) string {
-	varIdx := cg.AddVariable(node.Name)
+// generateDeclare pops the top of the stack into a newly declared variable.
+// Its slot is allocated after the initializer has been generated, so the
+// initializer still sees any variable the declaration shadows.
+func (cg *CodeGenerator) generateDeclare(name string) {
+	if cg.scopeDepth == 0 {
+		cg.emitWithVarName(opcode.STORE_GLOBAL, name, cg.globals[name])
+		return
+	}
 
-	if node.Initializer != nil {
-		cg.generateExpression(node.Initializer, st)
+	varIdx := cg.AddVariable(name)
+	if cg.captured[name] {
+		cg.emit(opcode.BOX)
+		cg.boxedSlots[varIdx] = true
 	}
+	cg.emitWithVarName(opcode.STORE_VAR, name, varIdx)
+}
 
-	if cg.debugMode {
-		cg.setCurrentSourcePos(node)
-		cg.emitWithVarName(opcode.STORE_VAR, node.Name, varIdx)
-	} else {
-		cg.emit(opcode.STORE_VAR, varIdx)
+// generateDestructuring pushes the values of a destructuring assignment and
+// pops them into its targets, last first. Values assigned to _ are dropped.
+func (cg *CodeGenerator) generateDestructuring(node ast.DestructuringNode, st *symboltable.SymbolTable) {
+	cg.generateValues(node.Value, st)
+	cg.setCurrentSourcePos(node)
+	for i := len(node.Targets) - 1; i >= 0; i-- {
+		target := node.Targets[i]
+		switch {
+		case target.Name == "_":
+			cg.emit(opcode.POP)
+		case node.Declare:
+			cg.generateDeclare(target.Name)
+		default:
+			cg.generateStore(target.Name)
+		}
 	}
-	return ""
+}
+
+// generateValues pushes the values of a return or destructuring assignment
+// in order and returns how many it pushed
+func (cg *CodeGenerator) generateValues(node ast.Node, st *symboltable.SymbolTable) int {
+	switch n := node.(type) {
+	case ast.ValueListNode:
+		for _, value := range n.Values {
+			cg.generateBinaryExpression(value, st)
+		}
+		return len(n.Values)
+	case ast.FunctionCallNode:
+		cg.generateBinaryExpression(n, st)
+		return cg.returnCount(n)
+	default:
+		cg.generateBinaryExpression(n, st)
+		return 1
+	}
+}
+
+// generateLoad pushes the value of a variable, reading through its cell if
+// it is captured, or a closure over a declared function
+func (cg *CodeGenerator) generateLoad(name string, node ast.Node) {
+	if slot, exists := cg.variablesMap[name]; exists {
+		if cg.boxedSlots[slot] {
+			cg.emitWithVarName(opcode.LOAD_CELL, name, slot)
+		} else {
+			cg.emitWithVarName(opcode.LOAD_VAR, name, slot)
+		}
+		return
+	}
+
+	if index, exists := cg.upvalues[name]; exists {
+		cg.emitWithVarName(opcode.LOAD_UPVALUE, name, index)
+		return
+	}
+
+	if value, isConstant := cg.constValues[name]; isConstant {
+		cg.generateBinaryExpression(value, nil)
+		return
+	}
+
+	if slot, isGlobal := cg.globals[name]; isGlobal {
+		cg.emitWithVarName(opcode.LOAD_GLOBAL, name, slot)
+		return
+	}
+
+	cg.emit(opcode.MAKE_CLOSURE, 0, 0)
+	cg.callFixups = append(cg.callFixups, callFixup{
+		Offset:   len(cg.mainBytecode) - 3,
+		Function: name,
+		Node:     node,
+	})
+}
+
+// generateStore pops the top of the stack into a variable
+func (cg *CodeGenerator) generateStore(name string) {
+	if slot, exists := cg.variablesMap[name]; exists {
+		if cg.boxedSlots[slot] {
+			cg.emitWithVarName(opcode.STORE_CELL, name, slot)
+		} else {
+			cg.emitWithVarName(opcode.STORE_VAR, name, slot)
+		}
+		return
+	}
+
+	if index, exists := cg.upvalues[name]; exists {
+		cg.emitWithVarName(opcode.STORE_UPVALUE, name, index)
+		return
+	}
+
+	if slot, isGlobal := cg.globals[name]; isGlobal {
+		cg.emitWithVarName(opcode.STORE_GLOBAL, name, slot)
+		return
+	}
+
+	cg.logger.Error("Undefined variable '%s'", name)
 }
 
 func (cg *CodeGenerator) generateBinaryExpression(expr ast.Node, st *symboltable.SymbolTable) string {
-	if cg.debugMode && expr != nil {
+	if expr != nil {
 		cg.setCurrentSourcePos(expr)
 	}
 
 	switch node := expr.(type) {
 	case ast.NumberNode:
-		intValue, err := strconv.ParseInt(node.Value.(string), 10, 8)
+		intValue, err := strconv.ParseInt(node.Value.(string), 10, 64)
 		if err != nil {
 			cg.logger.Error("Error parsing number '%s' at position %+v: %v", node.Value, node.Pos(), err)
 			return ""
 		}
 
-		constIdx := cg.AddConstant(IntTypeId, int8(intValue))
+		constIdx := cg.AddConstant(IntTypeId, intValue)
 		cg.logger.Debug("Generating LOAD_CONST for number %d at index %d", intValue, constIdx)
 
 		cg.emit(opcode.LOAD_CONST, constIdx)
+	case ast.BooleanNode:
+		cg.emit(opcode.LOAD_CONST, cg.AddConstant(BoolTypeId, node.Value))
+	case ast.StringNode:
+		cg.emit(opcode.LOAD_CONST, cg.AddConstant(StringTypeId, node.Value))
+	case ast.NoneNode:
+		cg.emit(opcode.LOAD_NONE)
 	case ast.IdentifierNode:
-		if varIdx, exists := cg.variablesMap[node.Name]; exists {
-			if cg.debugMode {
-				cg.emitWithVarName(opcode.LOAD_VAR, node.Name, varIdx)
-			} else {
-				cg.emit(opcode.LOAD_VAR, varIdx)
-			}
-		} else {
-			cg.logger.Error("Undefined variable '%s' at position %+v", node.Name, node.Pos())
+		cg.generateLoad(node.Name, node)
+	case ast.ArrayLiteralNode:
+		for _, element := range node.Elements {
+			cg.generateBinaryExpression(element, st)
 		}
+		cg.setCurrentSourcePos(node)
+		cg.emit(opcode.MAKE_ARRAY, len(node.Elements))
+	case ast.IndexNode:
+		cg.generateBinaryExpression(node.Target, st)
+		cg.generateBinaryExpression(node.Index, st)
+		cg.setCurrentSourcePos(node)
+		cg.emit(opcode.INDEX)
 	case ast.BinaryOpNode:
+		if node.Operator.Value == "??" {
+			cg.generateDefault(node, st)
+			return ""
+		}
+
 		cg.generateBinaryExpression(node.Left, st)
 		cg.generateBinaryExpression(node.Right, st)
 
-		if cg.debugMode {
-			cg.setCurrentSourcePos(node)
-		}
+		cg.setCurrentSourcePos(node)
 
 		op := node.Operator.Value
 		switch op {
@@ -396,69 +787,256 @@ func (cg *CodeGenerator) generateBinaryExpression(expr ast.Node, st *symboltable
 			cg.emit(opcode.MUL)
 		case "/":
 			cg.emit(opcode.DIV)
+		case "%":
+			cg.emit(opcode.MOD)
 		case "+":
 			cg.emit(opcode.ADD)
 		case "-":
 			cg.emit(opcode.SUB)
 		case "==":
 			cg.emit(opcode.EQ)
+		case "!=":
+			cg.emit(opcode.NEQ)
 		case "<":
 			cg.emit(opcode.LT)
+		case "<=":
+			cg.emit(opcode.LE)
 		case ">":
 			cg.emit(opcode.GT)
+		case ">=":
+			cg.emit(opcode.GE)
+		case "&&":
+			cg.emit(opcode.AND)
+		case "||":
+			cg.emit(opcode.OR)
 		default:
 			cg.logger.Error("Unknown binary operator '%s' at position %+v", op, node.Pos())
 		}
 	case ast.FunctionCallNode:
-		cg.logger.Debug("Generating function call to '%s'", node.Name)
-		for _, arg := range node.Arguments {
-			cg.generateExpression(arg, st)
-		}
-		if cg.debugMode {
-			cg.setCurrentSourcePos(node)
-		}
-		if fnIdx, exists := cg.functionsMap[node.Name]; exists {
-			cg.emit(opcode.CALL, fnIdx)
-		} else {
-			if fnIdx, exists := cg.compiledFuncMap[node.Name]; exists {
-				cg.emit(opcode.CALL, fnIdx)
-			} else {
-				cg.logger.Error("Undefined function '%s' at position %+v", node.Name, node.Pos())
-			}
-		}
-
+		cg.generateFunctionCall(node, st)
+	case ast.TryNode:
+		cg.generateTry(node, st)
+	case ast.IfExpressionNode:
+		cg.generateIf(node, st, cg.generateBranchValue)
+	case ast.FunctionLiteralNode:
+		cg.generateFunctionLiteral(node)
 	default:
 		cg.logger.Warn("Unknown binary expression type: %T at position %+v", node, node.Pos())
 	}
 	return ""
 }
 
+// generateDefault emits a ?? operator. JUMP_IF_SOME keeps the value of the
+// optional on the left and skips the right side unless it is none.
+func (cg *CodeGenerator) generateDefault(node ast.BinaryOpNode, st *symboltable.SymbolTable) {
+	cg.generateBinaryExpression(node.Left, st)
+	cg.setCurrentSourcePos(node)
+	cg.emit(opcode.JUMP_IF_SOME, 0)
+	rightStart := len(cg.mainBytecode)
+	cg.generateBinaryExpression(node.Right, st)
+	cg.patchAddress(rightStart-2, len(cg.mainBytecode))
+}
+
+func (cg *CodeGenerator) generateFunctionCall(node ast.FunctionCallNode, st *symboltable.SymbolTable) {
+	cg.logger.Debug("Generating function call to '%s'", node.Name)
+
+	// A variable holding a function value is called indirectly, and takes
+	// precedence over a declared function with the same name
+	isValue := cg.isVariable(node.Name)
+	if isValue {
+		cg.generateLoad(node.Name, node)
+	}
+
+	arguments := node.PositionalArguments()
+	for _, arg := range arguments {
+		cg.generateBinaryExpression(arg, st)
+	}
+	cg.setCurrentSourcePos(node)
+
+	if isValue {
+		cg.emit(opcode.CALL_VALUE, len(arguments))
+		return
+	}
+
+	if fnIdx, exists := cg.functionsMap[node.Name]; exists {
+		cg.emit(opcode.CALL_BUILTIN, fnIdx, len(arguments))
+		return
+	}
+
+	cg.emitCall(opcode.CALL, node, len(arguments))
+}
+
+// emitCall emits a CALL or TAIL_CALL to a declared function, whose address
+// is patched in by resolveCalls
+func (cg *CodeGenerator) emitCall(op opcode.Opcode, node ast.FunctionCallNode, argCount int) {
+	cg.emit(op, 0, argCount)
+	cg.callFixups = append(cg.callFixups, callFixup{
+		Offset:   len(cg.mainBytecode) - 3,
+		Function: node.Name,
+		Node:     node,
+	})
+}
+
+// isVariable reports whether name refers to a variable rather than to a
+// declared function
+func (cg *CodeGenerator) isVariable(name string) bool {
+	_, isLocal := cg.variablesMap[name]
+	_, isUpvalue := cg.upvalues[name]
+	_, isGlobal := cg.globals[name]
+	return isLocal || isUpvalue || isGlobal
+}
+
+// returnCount returns the number of values a call leaves on the stack, which
+// is one except for declared functions that return several
+func (cg *CodeGenerator) returnCount(call ast.FunctionCallNode) int {
+	if count, returnsSeveral := cg.returnCounts[call.Name]; returnsSeveral && !cg.isVariable(call.Name) {
+		return count
+	}
+	return 1
+}
+
+// generateTry emits a ? operator. TRY unwraps an ok result and jumps over the
+// return that propagates an err result from the current function.
+func (cg *CodeGenerator) generateTry(node ast.TryNode, st *symboltable.SymbolTable) {
+	cg.generateBinaryExpression(node.Value, st)
+	cg.setCurrentSourcePos(node)
+	cg.emit(opcode.TRY, 0)
+	tryEnd := len(cg.mainBytecode)
+
+	scopesToClose := cg.scopeDepth - cg.functionScopeDepth
+	for i := 0; i < scopesToClose; i++ {
+		cg.emit(opcode.END_SCOPE)
+	}
+	cg.emitReturn(1)
+	cg.patchAddress(tryEnd-2, len(cg.mainBytecode))
+}
+
+// generateDefer emits a defer statement. The function and its arguments are
+// evaluated where the statement is, and the call is made when the function
+// containing it returns.
+func (cg *CodeGenerator) generateDefer(node ast.DeferNode, st *symboltable.SymbolTable) {
+	call := node.Call
+	arguments := call.PositionalArguments()
+
+	fnIdx, isBuiltin := cg.functionsMap[call.Name]
+	isBuiltin = isBuiltin && !cg.isVariable(call.Name)
+	if !isBuiltin {
+		cg.generateLoad(call.Name, call)
+	}
+	for _, arg := range arguments {
+		cg.generateBinaryExpression(arg, st)
+	}
+
+	cg.setCurrentSourcePos(node)
+	if isBuiltin {
+		cg.emit(opcode.DEFER_BUILTIN, fnIdx, len(arguments))
+	} else {
+		cg.emit(opcode.DEFER, len(arguments))
+	}
+}
+
+// emitReturn emits a RETURN of count values, preceded in functions with
+// defer statements by the RUN_DEFERRED that makes their calls
+func (cg *CodeGenerator) emitReturn(count int) {
+	if cg.defers {
+		cg.emit(opcode.RUN_DEFERRED)
+	}
+	cg.emit(opcode.RETURN, count)
+}
+
+// containsDefer reports whether a function body has defer statements of its
+// own, leaving out those in the function literals it contains
+func containsDefer(body ast.BlockNode) bool {
+	found := false
+	ast.Walk(body, func(node ast.Node) bool {
+		switch node.(type) {
+		case ast.DeferNode:
+			found = true
+		case ast.FunctionLiteralNode:
+			return false
+		}
+		return !found
+	})
+	return found
+}
+
+// generateZeroValue pushes the value a variable declared without an
+// initializer starts with
+func (cg *CodeGenerator) generateZeroValue(typeName string) {
+	zeroType, err := types.Parse(typeName)
+	if err != nil {
+		cg.logger.Error("Invalid type '%s': %v", typeName, err)
+		return
+	}
+
+	switch {
+	case zeroType.Name == types.Optional:
+		cg.emit(opcode.LOAD_NONE)
+	case types.IsInteger(zeroType.Name):
+		cg.emit(opcode.LOAD_CONST, cg.AddConstant(IntTypeId, int64(0)))
+	case zeroType.Name == "bool":
+		cg.emit(opcode.LOAD_CONST, cg.AddConstant(BoolTypeId, false))
+	case zeroType.Name == "string":
+		cg.emit(opcode.LOAD_CONST, cg.AddConstant(StringTypeId, ""))
+	case zeroType.Name == "array":
+		cg.emit(opcode.MAKE_ARRAY, 0)
+	case zeroType.Name == "map":
+		cg.emit(opcode.CALL_BUILTIN, cg.functionsMap["__map_new"], 0)
+	case zeroType.Name == "chan":
+		cg.emit(opcode.LOAD_CONST, cg.AddConstant(IntTypeId, int64(0)))
+		cg.emit(opcode.CALL_BUILTIN, cg.functionsMap["channel"], 1)
+	default:
+		cg.logger.Error("No zero value for type '%s'", typeName)
+	}
+}
+
+func (cg *CodeGenerator) resolveCalls() {
+	for _, fixup := range cg.callFixups {
+		address, exists := cg.compiledFuncMap[fixup.Function]
+		if !exists {
+			cg.logger.Error("Undefined function '%s' at position %+v", fixup.Function, fixup.Node.Pos())
+			continue
+		}
+		cg.patchAddress(fixup.Offset, address)
+	}
+}
+
+// patchAddress overwrites the 2-byte address operand at offset
+func (cg *CodeGenerator) patchAddress(offset int, address int) {
+	binary.LittleEndian.PutUint16(cg.mainBytecode[offset:], uint16(address))
+	cg.lastJumpTarget = max(cg.lastJumpTarget, address)
+}
+
 func (cg *CodeGenerator) emit(op opcode.Opcode, operands ...int) {
 	cg.emitWithVarName(op, "", operands...)
 }
 
 func (cg *CodeGenerator) emitWithVarName(op opcode.Opcode, varName string, operands ...int) {
 	cg.logger.Debug("Emitting opcode: %s with operands %v", op, operands)
+	if cg.fuseVarConst(op) {
+		return
+	}
 
 	pc := len(cg.mainBytecode)
+	cg.recent = [2]int{cg.recent[1], pc}
 
-	switch op {
-	case opcode.LOAD_CONST, opcode.STORE_VAR, opcode.LOAD_VAR:
-		cg.mainBytecode = append(cg.mainBytecode, byte(op), byte(operands[0]))
-	case opcode.ADD, opcode.SUB, opcode.MUL, opcode.DIV, opcode.EQ, opcode.LT, opcode.GT:
-		cg.mainBytecode = append(cg.mainBytecode, byte(op))
-	case opcode.JUMP_IF_FALSE, opcode.JUMP, opcode.JUMP_IF_TRUE, opcode.CALL, opcode.CALL_BUILTIN:
-		cg.mainBytecode = append(cg.mainBytecode, byte(op), byte(operands[0]))
-	case opcode.START_SCOPE:
-		cg.mainBytecode = append(cg.mainBytecode, byte(op), byte(operands[0]))
-	case opcode.END_SCOPE:
-		cg.mainBytecode = append(cg.mainBytecode, byte(op))
-	case opcode.RETURN:
-		cg.mainBytecode = append(cg.mainBytecode, byte(op))
-	default:
-		cg.logger.Error("Unknown opcode to emit: %d", op)
+	widths := op.OperandWidths()
+	if len(operands) != len(widths) {
+		cg.logger.Error("Opcode %s expects %d operands, got %d", op, len(widths), len(operands))
+		return
+	}
+
+	cg.mainBytecode = append(cg.mainBytecode, byte(op))
+	for i, width := range widths {
+		switch width {
+		case 1:
+			cg.mainBytecode = append(cg.mainBytecode, byte(operands[i]))
+		case 2:
+			cg.mainBytecode = binary.LittleEndian.AppendUint16(cg.mainBytecode, uint16(operands[i]))
+		}
 	}
 
+	cg.addLineEntry(pc)
 	if cg.debugMode && cg.currentSourcePos != nil {
 		pos := cg.currentSourcePos.Pos()
 		if pos.Line > 0 && pos.Column >= 0 {
@@ -0,0 +1,52 @@
+package codegen
+
+import "alna-lang/internal/opcode"
+
+// varConstOps maps the binary operators that have a superinstruction to
+// it. A superinstruction takes the slot of a local variable and the index of
+// a constant, and replaces a LOAD_VAR, LOAD_CONST and operator sequence.
+var varConstOps = map[opcode.Opcode]opcode.Opcode{
+	opcode.ADD: opcode.ADD_VAR_CONST,
+	opcode.SUB: opcode.SUB_VAR_CONST,
+	opcode.MUL: opcode.MUL_VAR_CONST,
+	opcode.DIV: opcode.DIV_VAR_CONST,
+	opcode.MOD: opcode.MOD_VAR_CONST,
+	opcode.EQ:  opcode.EQ_VAR_CONST,
+	opcode.NEQ: opcode.NEQ_VAR_CONST,
+	opcode.LT:  opcode.LT_VAR_CONST,
+	opcode.LE:  opcode.LE_VAR_CONST,
+	opcode.GT:  opcode.GT_VAR_CONST,
+	opcode.GE:  opcode.GE_VAR_CONST,
+}
+
+// fuseVarConst emits op as a superinstruction when the two instructions
+// before it are a LOAD_VAR and a LOAD_CONST, and reports whether it did.
+// Instructions a jump lands on cannot be fused into the one before them.
+func (cg *CodeGenerator) fuseVarConst(op opcode.Opcode) bool {
+	fused, hasFused := varConstOps[op]
+	loadVar, loadConst := cg.recent[0], cg.recent[1]
+	if !hasFused || loadVar < 0 || loadVar < cg.lastJumpTarget ||
+		loadConst != loadVar+2 || len(cg.mainBytecode) != loadConst+2 ||
+		cg.mainBytecode[loadVar] != byte(opcode.LOAD_VAR) || cg.mainBytecode[loadConst] != byte(opcode.LOAD_CONST) {
+		return false
+	}
+
+	slot, constant := cg.mainBytecode[loadVar+1], cg.mainBytecode[loadConst+1]
+	cg.mainBytecode = append(cg.mainBytecode[:loadVar], byte(fused), slot, constant)
+	cg.recent = [2]int{-1, loadVar}
+
+	// The fused instruction maps to the operator, so that runtime errors
+	// point at it
+	for len(cg.lineTable) > 0 && cg.lineTable[len(cg.lineTable)-1].Pc >= loadVar {
+		cg.lineTable = cg.lineTable[:len(cg.lineTable)-1]
+	}
+	cg.addLineEntry(loadVar)
+	if cg.debugMode {
+		sourceMap := cg.debugInfo.SourceMap
+		for len(sourceMap) > 0 && sourceMap[len(sourceMap)-1].Pc > loadVar {
+			sourceMap = sourceMap[:len(sourceMap)-1]
+		}
+		cg.debugInfo.SourceMap = sourceMap
+	}
+	return true
+}
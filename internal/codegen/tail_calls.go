@@ -0,0 +1,59 @@
+package codegen
+
+import (
+	"alna-lang/internal/ast"
+	"alna-lang/internal/common"
+	"alna-lang/internal/opcode"
+	symboltable "alna-lang/internal/symbol_table"
+)
+
+// generateTailCall emits a call in tail position as a TAIL_CALL, which makes
+// the callee return straight to the caller of the current function, so that
+// recursion does not grow the call stack. It emits nothing and reports false
+// for calls that have to return to the current function: calls made by a
+// function with defer statements, whose deferred calls run once it returns,
+// and calls to function values and builtins.
+func (cg *CodeGenerator) generateTailCall(node ast.FunctionCallNode, st *symboltable.SymbolTable) bool {
+	_, isBuiltin := cg.functionsMap[node.Name]
+	if cg.defers || isBuiltin || cg.isVariable(node.Name) {
+		return false
+	}
+
+	arguments := node.PositionalArguments()
+	for _, arg := range arguments {
+		cg.generateBinaryExpression(arg, st)
+	}
+	cg.setCurrentSourcePos(node)
+	cg.emitCall(opcode.TAIL_CALL, node, len(arguments))
+	return true
+}
+
+// markTailStatements records the positions of the call statements a void
+// function ends with: its last statement, or the last statements of the
+// branches of an if statement it ends with. Nothing runs after them but the
+// function's return.
+func markTailStatements(statements []ast.Node, positions map[common.Position]bool) {
+	if len(statements) == 0 {
+		return
+	}
+	switch last := statements[len(statements)-1].(type) {
+	case ast.FunctionCallNode:
+		positions[last.Pos()] = true
+	case ast.IfExpressionNode:
+		markTailBranch(last.ThenBranch, positions)
+		markTailBranch(last.ElseBranch, positions)
+	}
+}
+
+func markTailBranch(branch ast.Node, positions map[common.Position]bool) {
+	switch b := branch.(type) {
+	case *ast.BlockNode:
+		if b != nil {
+			markTailStatements(b.Expressions, positions)
+		}
+	case ast.BlockNode:
+		markTailStatements(b.Expressions, positions)
+	case ast.IfExpressionNode:
+		markTailStatements([]ast.Node{b}, positions)
+	}
+}
@@ -0,0 +1,91 @@
+package codegen
+
+import (
+	"alna-lang/internal/ast"
+	"alna-lang/internal/opcode"
+	symboltable "alna-lang/internal/symbol_table"
+)
+
+// generateSpawn emits a spawn statement. The function and its arguments are
+// evaluated where the statement is, and SPAWN starts a task making the call.
+func (cg *CodeGenerator) generateSpawn(node ast.SpawnNode, st *symboltable.SymbolTable) {
+	call := node.Call
+	arguments := call.PositionalArguments()
+
+	cg.generateLoad(call.Name, call)
+	for _, arg := range arguments {
+		cg.generateBinaryExpression(arg, st)
+	}
+
+	cg.setCurrentSourcePos(node)
+	cg.emit(opcode.SPAWN, len(arguments))
+}
+
+// generateSelect emits a select statement. The channels of its cases, and
+// the values of those sending, are pushed for SELECT, which leaves the value
+// received and the index of the case that completed, the number of cases
+// for the else branch. Both are kept in hidden variables of a scope around
+// the cases, whose bodies are dispatched on the index like an if chain.
+func (cg *CodeGenerator) generateSelect(node ast.SelectNode, st *symboltable.SymbolTable) {
+	sends := 0
+	for i, selectCase := range node.Cases {
+		arguments := selectCase.Operation.PositionalArguments()
+		for _, arg := range arguments {
+			cg.generateBinaryExpression(arg, st)
+		}
+		if selectCase.Operation.Name == "send" {
+			sends |= 1 << i
+		}
+	}
+	hasElse := 0
+	if node.Else != nil {
+		hasElse = 1
+	}
+	cg.setCurrentSourcePos(node)
+	cg.emit(opcode.SELECT, len(node.Cases), sends, hasElse)
+
+	varsBeforeScope := len(cg.variables)
+	savedVariablesMap := make(map[string]int, len(cg.variablesMap))
+	for name, idx := range cg.variablesMap {
+		savedVariablesMap[name] = idx
+	}
+
+	cg.scopeDepth++
+	cg.emit(opcode.START_SCOPE, varsBeforeScope)
+	caseSlot := cg.AddVariable("<select case>")
+	cg.emit(opcode.STORE_VAR, caseSlot)
+	valueSlot := cg.AddVariable("<select value>")
+	cg.emit(opcode.STORE_VAR, valueSlot)
+
+	var endJumps []int
+	for i, selectCase := range node.Cases {
+		cg.setCurrentSourcePos(selectCase.Operation)
+		cg.emit(opcode.LOAD_VAR, caseSlot)
+		cg.emit(opcode.LOAD_CONST, cg.AddConstant(IntTypeId, int64(i)))
+		cg.emit(opcode.EQ)
+		cg.emit(opcode.JUMP_IF_FALSE, 0)
+		bodyStart := len(cg.mainBytecode)
+
+		if selectCase.Binding != nil {
+			cg.emit(opcode.LOAD_VAR, valueSlot)
+			cg.generateUnwrapped(selectCase.Binding.Name, selectCase.Body, st, cg.generateExpression)
+		} else {
+			cg.generateExpression(selectCase.Body, st)
+		}
+
+		cg.emit(opcode.JUMP, 0)
+		endJumps = append(endJumps, len(cg.mainBytecode))
+		cg.patchAddress(bodyStart-2, len(cg.mainBytecode))
+	}
+	if node.Else != nil {
+		cg.generateExpression(node.Else, st)
+	}
+
+	for _, jumpEnd := range endJumps {
+		cg.patchAddress(jumpEnd-2, len(cg.mainBytecode))
+	}
+	cg.emit(opcode.END_SCOPE)
+	cg.variables = cg.variables[:varsBeforeScope]
+	cg.variablesMap = savedVariablesMap
+	cg.scopeDepth--
+}
@@ -11,6 +11,9 @@ import (
 // - CompilerErrorWithPosition: Use for multi-line construct errors (if/for/while blocks, etc.)
 // - CompilerErrorEOF: Use when unexpectedly reaching end of input
 // - CompilerErrorSimple: Use when no source location is available
+// - CompilerErrorWithFix: Use for errors that come with a suggested fix
+//
+// CompilerWarning formats problems that do not stop compilation the same way.
 
 // CompilerError creates a formatted error message with source code context
 // This is the most common error function - use it for single-position errors
@@ -20,57 +23,77 @@ func CompilerError(pos Position, message string, sourceLines []string) error {
 	// Error header
 	sb.WriteString(fmt.Sprintf("\n\033[1;31mCompiler Error:\033[0m %s\n", message))
 	sb.WriteString(fmt.Sprintf("\033[36mAt line %d, column %d\033[0m\n\n", pos.Line, pos.Column))
+	sb.WriteString(SourceExcerpt(pos, sourceLines))
 
-	// Show the source line if available
-	if pos.Line > 0 && pos.Line <= len(sourceLines) {
-		lineNum := pos.Line
+	return fmt.Errorf("%s", sb.String())
+}
 
-		// Calculate the maximum line number width for alignment
-		contextLines := 2 // lines before and after
-		startLine := lineNum - contextLines
-		if startLine < 1 {
-			startLine = 1
-		}
-		endLine := lineNum + contextLines
-		if endLine > len(sourceLines) {
-			endLine = len(sourceLines)
-		}
+// CompilerWarning formats a warning with source code context, like
+// CompilerError
+func CompilerWarning(pos Position, message string, sourceLines []string) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("\n\033[1;33mWarning:\033[0m %s\n", message))
+	sb.WriteString(fmt.Sprintf("\033[36mAt line %d, column %d\033[0m\n\n", pos.Line, pos.Column))
+	sb.WriteString(SourceExcerpt(pos, sourceLines))
+	return sb.String()
+}
 
-		maxLineNumWidth := len(fmt.Sprintf("%d", endLine))
+// SourceExcerpt renders the source line at pos between the lines around it,
+// with a pointer under the span from pos.Column to pos.EndColumn. It is empty
+// when the line is not in sourceLines.
+func SourceExcerpt(pos Position, sourceLines []string) string {
+	if pos.Line <= 0 || pos.Line > len(sourceLines) {
+		return ""
+	}
 
-		// Show context lines before
-		for i := startLine; i < lineNum; i++ {
-			sb.WriteString(fmt.Sprintf("  %*d | %s\n", maxLineNumWidth, i, sourceLines[i-1]))
-		}
+	var sb strings.Builder
+	lineNum := pos.Line
 
-		// Show the error line
-		line := sourceLines[lineNum-1]
-		sb.WriteString(fmt.Sprintf("  %*d | %s\n", maxLineNumWidth, lineNum, line))
+	// Calculate the maximum line number width for alignment
+	contextLines := 2 // lines before and after
+	startLine := lineNum - contextLines
+	if startLine < 1 {
+		startLine = 1
+	}
+	endLine := lineNum + contextLines
+	if endLine > len(sourceLines) {
+		endLine = len(sourceLines)
+	}
 
-		// Show the pointer line
-		sb.WriteString(fmt.Sprintf("  %s | ", strings.Repeat(" ", maxLineNumWidth)))
+	maxLineNumWidth := len(fmt.Sprintf("%d", endLine))
 
-		// Add spacing before the pointer
-		if pos.Column > 0 {
-			sb.WriteString(strings.Repeat(" ", pos.Column))
-		}
+	// Show context lines before
+	for i := startLine; i < lineNum; i++ {
+		sb.WriteString(fmt.Sprintf("  %*d | %s\n", maxLineNumWidth, i, sourceLines[i-1]))
+	}
 
-		// Add the pointer
-		pointerLength := pos.EndColumn - pos.Column
-		if pointerLength < 1 {
-			pointerLength = 1
-		}
-		sb.WriteString("\033[1;31m")
-		sb.WriteString(strings.Repeat("^", pointerLength))
-		sb.WriteString("\033[0m\n")
+	// Show the error line
+	line := sourceLines[lineNum-1]
+	sb.WriteString(fmt.Sprintf("  %*d | %s\n", maxLineNumWidth, lineNum, line))
 
-		// Show context lines after
-		for i := lineNum + 1; i <= endLine; i++ {
-			sb.WriteString(fmt.Sprintf("  %*d | %s\n", maxLineNumWidth, i, sourceLines[i-1]))
-		}
+	// Show the pointer line
+	sb.WriteString(fmt.Sprintf("  %s | ", strings.Repeat(" ", maxLineNumWidth)))
+
+	// Add spacing before the pointer
+	if pos.Column > 0 {
+		sb.WriteString(strings.Repeat(" ", pos.Column))
 	}
 
-	return fmt.Errorf("%s", sb.String())
+	// Add the pointer
+	pointerLength := pos.EndColumn - pos.Column
+	if pointerLength < 1 {
+		pointerLength = 1
+	}
+	sb.WriteString("\033[1;31m")
+	sb.WriteString(strings.Repeat("^", pointerLength))
+	sb.WriteString("\033[0m\n")
+
+	// Show context lines after
+	for i := lineNum + 1; i <= endLine; i++ {
+		sb.WriteString(fmt.Sprintf("  %*d | %s\n", maxLineNumWidth, i, sourceLines[i-1]))
+	}
+
+	return sb.String()
 }
 
 // CompilerErrorSimple creates a simple error message without source code context
@@ -219,3 +242,42 @@ func CompilerErrorEOF(lastPos Position, message string, sourceLines []string) er
 
 	return fmt.Errorf("%s", sb.String())
 }
+
+// Fix is a suggestion attached to a compiler error. It points at the code to
+// change, which is often somewhere other than the error itself, such as the
+// declaration of the variable an error is about. Insert is the text to add at
+// the fix position, if the fix is an insertion.
+type Fix struct {
+	Position Position
+	Message  string
+	Insert   string
+}
+
+// CompilerErrorWithFix creates a formatted error message like CompilerError,
+// followed by the suggested fix and the source line it applies to
+func CompilerErrorWithFix(pos Position, message string, fix Fix, sourceLines []string) error {
+	var sb strings.Builder
+	sb.WriteString(CompilerError(pos, message, sourceLines).Error())
+	sb.WriteString(fmt.Sprintf("\n\033[36mhelp:\033[0m %s\n", fix.Message))
+
+	lineNum := fix.Position.Line
+	if lineNum <= 0 || lineNum > len(sourceLines) {
+		return fmt.Errorf("%s", sb.String())
+	}
+
+	line := sourceLines[lineNum-1]
+	column := min(max(fix.Position.Column, 0), len(line))
+	lineNumWidth := len(fmt.Sprintf("%d", lineNum))
+
+	if fix.Insert == "" {
+		// Without an insertion the fix underlines the code it refers to
+		sb.WriteString(fmt.Sprintf("  %d | %s\n", lineNum, line))
+		pointerLength := max(fix.Position.EndColumn-fix.Position.Column, 1)
+		sb.WriteString(fmt.Sprintf("  %s | %s\033[36m%s\033[0m\n", strings.Repeat(" ", lineNumWidth), strings.Repeat(" ", column), strings.Repeat("-", pointerLength)))
+		return fmt.Errorf("%s", sb.String())
+	}
+
+	sb.WriteString(fmt.Sprintf("  %d | %s\033[32m%s\033[0m%s\n", lineNum, line[:column], fix.Insert, line[column:]))
+	sb.WriteString(fmt.Sprintf("  %s | %s\033[32m%s\033[0m\n", strings.Repeat(" ", lineNumWidth), strings.Repeat(" ", column), strings.Repeat("+", len(fix.Insert))))
+	return fmt.Errorf("%s", sb.String())
+}
@@ -1,7 +1,9 @@
 package disassembler
 
 import (
+	"alna-lang/internal/codegen"
 	"alna-lang/internal/opcode"
+	"encoding/binary"
 	"fmt"
 	"strings"
 )
@@ -68,7 +70,12 @@ func Disassemble(bytecode []byte) string {
 
 		switch typeID {
 		case 1: // int
-			value = int(bytecode[pos])
+			if pos+8 > len(bytecode) {
+				output.WriteString(fmt.Sprintf("Error: Unexpected end while reading int constant %d\n", i))
+				return output.String()
+			}
+			value = int64(binary.LittleEndian.Uint64(bytecode[pos : pos+8]))
+			pos += 7 // -1 because we'll increment pos again below
 		case 2: // function
 			instructionsCount := int(bytecode[pos])
 			pos++
@@ -79,6 +86,21 @@ func Disassemble(bytecode []byte) string {
 			value = bytecode[pos : pos+instructionsCount]
 			output.WriteString(fmt.Sprintf("Function with %d bytes", instructionsCount))
 			pos += instructionsCount - 1 // -1 because we'll increment pos again below
+		case 3: // bool
+			value = bytecode[pos] != 0
+		case 4: // string
+			if pos+2 > len(bytecode) {
+				output.WriteString(fmt.Sprintf("Error: Unexpected end while reading string constant %d\n", i))
+				return output.String()
+			}
+			length := int(binary.LittleEndian.Uint16(bytecode[pos : pos+2]))
+			pos += 2
+			if pos+length > len(bytecode) {
+				output.WriteString(fmt.Sprintf("Error: Unexpected end while reading string constant %d\n", i))
+				return output.String()
+			}
+			value = fmt.Sprintf("%q", string(bytecode[pos:pos+length]))
+			pos += length - 1 // -1 because we'll increment pos again below
 		default:
 			value = fmt.Sprintf("unknown_type_%d", typeID)
 		}
@@ -87,16 +109,33 @@ func Disassemble(bytecode []byte) string {
 		constants = append(constants, Constant{TypeID: typeID, Value: value})
 
 		typeName := "unknown"
-		if typeID == 1 {
+		switch typeID {
+		case 1:
 			typeName = "int"
-		}
-		if typeID == 2 {
+		case 2:
 			typeName = "function"
+		case 3:
+			typeName = "bool"
+		case 4:
+			typeName = "string"
 		}
 
 		output.WriteString(fmt.Sprintf("  [%d] %s: %v\n", i, typeName, value))
 	}
 
+	functions, lineTable, size, err := codegen.DecodeLineTable(bytecode[pos:])
+	if err != nil {
+		output.WriteString(fmt.Sprintf("Error: %v\n", err))
+		return output.String()
+	}
+	pos += size
+
+	output.WriteString(fmt.Sprintf("\nFunctions (%d entries):\n", len(functions)))
+	for _, fn := range functions {
+		output.WriteString(fmt.Sprintf("  %04d-%04d: %s (%s)\n", fn.Start, fn.End, fn.Name, fn.File))
+	}
+	output.WriteString(fmt.Sprintf("Line table: %d entries\n", len(lineTable)))
+
 	output.WriteString("\nInstructions:\n")
 
 	// Remember where instructions start for proper IP addressing
@@ -111,23 +150,32 @@ func Disassemble(bytecode []byte) string {
 
 		instruction := fmt.Sprintf("  %04d: %s", instructionPos, op.String())
 
-		if op.HasOperand() {
-			if pos >= len(bytecode) {
-				output.WriteString(fmt.Sprintf("%s <missing operand>\n", instruction))
+		missingOperand := false
+		for i, width := range op.OperandWidths() {
+			if pos+width > len(bytecode) {
+				missingOperand = true
 				break
 			}
 
 			operand := int(bytecode[pos])
-			pos++
+			if width == 2 {
+				operand = int(binary.LittleEndian.Uint16(bytecode[pos : pos+2]))
+			}
+			pos += width
 
 			instruction += fmt.Sprintf(" %d", operand)
 
 			// Add comment for constant references
-			if op == opcode.LOAD_CONST && operand < len(constants) {
+			if i == 0 && op == opcode.LOAD_CONST && operand < len(constants) {
 				instruction += fmt.Sprintf("    ; load %v", constants[operand].Value)
 			}
 		}
 
+		if missingOperand {
+			output.WriteString(fmt.Sprintf("%s <missing operand>\n", instruction))
+			break
+		}
+
 		output.WriteString(instruction + "\n")
 	}
 
@@ -5,27 +5,53 @@ import (
 	"bufio"
 	"fmt"
 	"regexp"
+	"strconv"
+	"strings"
 )
 
 type TokenType string
 
 const (
-	BinaryOperador   TokenType = "BinaryOperador"
-	Number           TokenType = "Number"
-	Whitespace       TokenType = "Whitespace"
-	OpenParenthesis  TokenType = "OpenParenthesis"
-	CloseParenthesis TokenType = "CloseParenthesis"
-	Identifier       TokenType = "Identifier"
-	Assignment       TokenType = "Assignment"
-	DataType         TokenType = "DataType"
-	Comma            TokenType = "Comma"
-	IfKeyword        TokenType = "IfKeyword"
-	ElseKeyword      TokenType = "ElseKeyword"
-	ReturnKeyword    TokenType = "ReturnKeyword"
-	BooleanOperator  TokenType = "BooleanOperator"
-	OpenBracket      TokenType = "OpenBracket"
-	CloseBracket     TokenType = "CloseBracket"
-	EOF              TokenType = "EOF"
+	BinaryOperador     TokenType = "BinaryOperador"
+	Number             TokenType = "Number"
+	Whitespace         TokenType = "Whitespace"
+	OpenParenthesis    TokenType = "OpenParenthesis"
+	CloseParenthesis   TokenType = "CloseParenthesis"
+	Identifier         TokenType = "Identifier"
+	Assignment         TokenType = "Assignment"
+	DataType           TokenType = "DataType"
+	Comma              TokenType = "Comma"
+	Semicolon          TokenType = "Semicolon"
+	Colon              TokenType = "Colon"
+	ShortDeclaration   TokenType = "ShortDeclaration"
+	Arrow              TokenType = "Arrow"
+	Question           TokenType = "Question"
+	IfKeyword          TokenType = "IfKeyword"
+	ElseKeyword        TokenType = "ElseKeyword"
+	ReturnKeyword      TokenType = "ReturnKeyword"
+	BooleanOperator    TokenType = "BooleanOperator"
+	OpenBracket        TokenType = "OpenBracket"
+	CloseBracket       TokenType = "CloseBracket"
+	OpenSquare         TokenType = "OpenSquare"
+	CloseSquare        TokenType = "CloseSquare"
+	StringLiteral      TokenType = "StringLiteral"
+	InterpolatedString TokenType = "InterpolatedString"
+	IncludeKeyword     TokenType = "IncludeKeyword"
+	FnKeyword          TokenType = "FnKeyword"
+	ConstKeyword       TokenType = "ConstKeyword"
+	MutKeyword         TokenType = "MutKeyword"
+	DeferKeyword       TokenType = "DeferKeyword"
+	NoneKeyword        TokenType = "NoneKeyword"
+	IsKeyword          TokenType = "IsKeyword"
+	SomeKeyword        TokenType = "SomeKeyword"
+	SpawnKeyword       TokenType = "SpawnKeyword"
+	SelectKeyword      TokenType = "SelectKeyword"
+	CaseKeyword        TokenType = "CaseKeyword"
+	ForKeyword         TokenType = "ForKeyword"
+	InKeyword          TokenType = "InKeyword"
+	YieldKeyword       TokenType = "YieldKeyword"
+	Comment            TokenType = "Comment"
+	EOF                TokenType = "EOF"
 )
 
 type Token struct {
@@ -51,12 +77,35 @@ type Lexer struct {
 	assignmentChars     *regexp.Regexp
 	dataType            *regexp.Regexp
 	comma               *regexp.Regexp
+	semicolon           *regexp.Regexp
+	colon               *regexp.Regexp
+	shortDeclaration    *regexp.Regexp
+	arrow               *regexp.Regexp
+	question            *regexp.Regexp
 	ifKeyword           *regexp.Regexp
 	elseKeyword         *regexp.Regexp
 	returnKeyword       *regexp.Regexp
 	booleanOperator     *regexp.Regexp
 	openBracket         *regexp.Regexp
 	closeBracket        *regexp.Regexp
+	openSquare          *regexp.Regexp
+	closeSquare         *regexp.Regexp
+	stringLiteral       *regexp.Regexp
+	includeKeyword      *regexp.Regexp
+	fnKeyword           *regexp.Regexp
+	constKeyword        *regexp.Regexp
+	mutKeyword          *regexp.Regexp
+	deferKeyword        *regexp.Regexp
+	noneKeyword         *regexp.Regexp
+	isKeyword           *regexp.Regexp
+	someKeyword         *regexp.Regexp
+	spawnKeyword        *regexp.Regexp
+	selectKeyword       *regexp.Regexp
+	caseKeyword         *regexp.Regexp
+	forKeyword          *regexp.Regexp
+	inKeyword           *regexp.Regexp
+	yieldKeyword        *regexp.Regexp
+	comment             *regexp.Regexp
 }
 
 func NewLexer(src bufio.Scanner) *Lexer {
@@ -65,21 +114,44 @@ func NewLexer(src bufio.Scanner) *Lexer {
 		lineNum:             0,
 		colNum:              0,
 		sourceLines:         []string{},
-		binaryOperatorChars: regexp.MustCompile(`^(==|&&|\|\||<=|>=|!=|[+\-*/><])([^=&\|]|$)?`),
+		binaryOperatorChars: regexp.MustCompile(`^(==|&&|\|\||<=|>=|!=|\?\?|[+\-*/%><])([^=&\|]|$)?`),
 		numberChars:         regexp.MustCompile(`^[0-9]+`),
 		whitespaceChars:     regexp.MustCompile(`^[ \t]+`),
 		openParenthesis:     regexp.MustCompile(`^\(`),
 		closeParenthesis:    regexp.MustCompile(`^\)`),
 		identifierChars:     regexp.MustCompile(`^([_A-Za-z][_A-Za-z0-9]*)`),
 		assignmentChars:     regexp.MustCompile(`^=`),
-		dataType:            regexp.MustCompile(`^(int|i8|i16|i32|i64)\b`),
+		dataType:            regexp.MustCompile(`^(int|i8|i16|i32|i64|bool|string|array|map|chan|gen|Result|void)\b`),
 		comma:               regexp.MustCompile(`^,`),
+		semicolon:           regexp.MustCompile(`^;`),
+		colon:               regexp.MustCompile(`^:`),
+		shortDeclaration:    regexp.MustCompile(`^:=`),
+		arrow:               regexp.MustCompile(`^->`),
+		question:            regexp.MustCompile(`^\?`),
 		ifKeyword:           regexp.MustCompile(`^if\b`),
 		elseKeyword:         regexp.MustCompile(`^else\b`),
 		returnKeyword:       regexp.MustCompile(`^return\b`),
 		booleanOperator:     regexp.MustCompile(`^(true|false)\b`),
 		openBracket:         regexp.MustCompile(`^{`),
 		closeBracket:        regexp.MustCompile(`^}`),
+		openSquare:          regexp.MustCompile(`^\[`),
+		closeSquare:         regexp.MustCompile(`^\]`),
+		stringLiteral:       regexp.MustCompile(`^"((?:[^"\\]|\\.)*)"`),
+		includeKeyword:      regexp.MustCompile(`^include\b`),
+		fnKeyword:           regexp.MustCompile(`^fn\b`),
+		constKeyword:        regexp.MustCompile(`^const\b`),
+		mutKeyword:          regexp.MustCompile(`^mut\b`),
+		deferKeyword:        regexp.MustCompile(`^defer\b`),
+		noneKeyword:         regexp.MustCompile(`^none\b`),
+		isKeyword:           regexp.MustCompile(`^is\b`),
+		someKeyword:         regexp.MustCompile(`^some\b`),
+		spawnKeyword:        regexp.MustCompile(`^spawn\b`),
+		selectKeyword:       regexp.MustCompile(`^select\b`),
+		caseKeyword:         regexp.MustCompile(`^case\b`),
+		forKeyword:          regexp.MustCompile(`^for\b`),
+		inKeyword:           regexp.MustCompile(`^in\b`),
+		yieldKeyword:        regexp.MustCompile(`^yield\b`),
+		comment:             regexp.MustCompile(`^//.*`),
 	}
 }
 
@@ -120,7 +192,7 @@ func (l *Lexer) consumeLine() (*[]Token, error) {
 		if err != nil {
 			return &tokens, err
 		}
-		if token.Type == Whitespace {
+		if token.Type == Whitespace || token.Type == Comment {
 			continue
 		}
 		tokens = append(tokens, token)
@@ -143,8 +215,30 @@ func (l *Lexer) getNextToken() (Token, error) {
 
 	var tokenType TokenType
 	var value string
+	tokenSize := -1
 
 	switch {
+	case l.comment.MatchString(nextSubstr):
+		value = getStringMatch(l.comment, nextSubstr)
+		tokenType = Comment
+	case l.stringLiteral.MatchString(nextSubstr):
+		raw := l.stringLiteral.FindString(nextSubstr)
+		unquoted, err := strconv.Unquote(raw)
+		if err != nil {
+			return Token{}, fmt.Errorf("invalid string literal: %s at line %d, column %d", raw, l.lineNum, l.colNum)
+		}
+		value = unquoted
+		tokenType = StringLiteral
+		// Strings with {expression} parts keep the source between the
+		// quotes, so the parser can point at the expressions in them
+		if strings.ContainsAny(unquoted, "{}") {
+			value = raw[1 : len(raw)-1]
+			tokenType = InterpolatedString
+		}
+		tokenSize = len(raw)
+	case l.arrow.MatchString(nextSubstr):
+		value = getStringMatch(l.arrow, nextSubstr)
+		tokenType = Arrow
 	case l.binaryOperatorChars.MatchString(nextSubstr):
 		value = getStringMatch(l.binaryOperatorChars, nextSubstr)
 		tokenType = BinaryOperador
@@ -163,9 +257,27 @@ func (l *Lexer) getNextToken() (Token, error) {
 	case l.closeBracket.MatchString(nextSubstr):
 		value = getStringMatch(l.closeBracket, nextSubstr)
 		tokenType = CloseBracket
+	case l.openSquare.MatchString(nextSubstr):
+		value = getStringMatch(l.openSquare, nextSubstr)
+		tokenType = OpenSquare
+	case l.closeSquare.MatchString(nextSubstr):
+		value = getStringMatch(l.closeSquare, nextSubstr)
+		tokenType = CloseSquare
 	case l.comma.MatchString(nextSubstr):
 		value = getStringMatch(l.comma, nextSubstr)
 		tokenType = Comma
+	case l.semicolon.MatchString(nextSubstr):
+		value = getStringMatch(l.semicolon, nextSubstr)
+		tokenType = Semicolon
+	case l.shortDeclaration.MatchString(nextSubstr):
+		value = getStringMatch(l.shortDeclaration, nextSubstr)
+		tokenType = ShortDeclaration
+	case l.colon.MatchString(nextSubstr):
+		value = getStringMatch(l.colon, nextSubstr)
+		tokenType = Colon
+	case l.question.MatchString(nextSubstr):
+		value = getStringMatch(l.question, nextSubstr)
+		tokenType = Question
 	case l.assignmentChars.MatchString(nextSubstr):
 		value = getStringMatch(l.assignmentChars, nextSubstr)
 		tokenType = Assignment
@@ -175,6 +287,48 @@ func (l *Lexer) getNextToken() (Token, error) {
 	case l.elseKeyword.MatchString(nextSubstr):
 		value = getStringMatch(l.elseKeyword, nextSubstr)
 		tokenType = ElseKeyword
+	case l.includeKeyword.MatchString(nextSubstr):
+		value = getStringMatch(l.includeKeyword, nextSubstr)
+		tokenType = IncludeKeyword
+	case l.fnKeyword.MatchString(nextSubstr):
+		value = getStringMatch(l.fnKeyword, nextSubstr)
+		tokenType = FnKeyword
+	case l.constKeyword.MatchString(nextSubstr):
+		value = getStringMatch(l.constKeyword, nextSubstr)
+		tokenType = ConstKeyword
+	case l.mutKeyword.MatchString(nextSubstr):
+		value = getStringMatch(l.mutKeyword, nextSubstr)
+		tokenType = MutKeyword
+	case l.deferKeyword.MatchString(nextSubstr):
+		value = getStringMatch(l.deferKeyword, nextSubstr)
+		tokenType = DeferKeyword
+	case l.noneKeyword.MatchString(nextSubstr):
+		value = getStringMatch(l.noneKeyword, nextSubstr)
+		tokenType = NoneKeyword
+	case l.isKeyword.MatchString(nextSubstr):
+		value = getStringMatch(l.isKeyword, nextSubstr)
+		tokenType = IsKeyword
+	case l.someKeyword.MatchString(nextSubstr):
+		value = getStringMatch(l.someKeyword, nextSubstr)
+		tokenType = SomeKeyword
+	case l.spawnKeyword.MatchString(nextSubstr):
+		value = getStringMatch(l.spawnKeyword, nextSubstr)
+		tokenType = SpawnKeyword
+	case l.selectKeyword.MatchString(nextSubstr):
+		value = getStringMatch(l.selectKeyword, nextSubstr)
+		tokenType = SelectKeyword
+	case l.caseKeyword.MatchString(nextSubstr):
+		value = getStringMatch(l.caseKeyword, nextSubstr)
+		tokenType = CaseKeyword
+	case l.forKeyword.MatchString(nextSubstr):
+		value = getStringMatch(l.forKeyword, nextSubstr)
+		tokenType = ForKeyword
+	case l.inKeyword.MatchString(nextSubstr):
+		value = getStringMatch(l.inKeyword, nextSubstr)
+		tokenType = InKeyword
+	case l.yieldKeyword.MatchString(nextSubstr):
+		value = getStringMatch(l.yieldKeyword, nextSubstr)
+		tokenType = YieldKeyword
 	case l.returnKeyword.MatchString(nextSubstr):
 		value = getStringMatch(l.returnKeyword, nextSubstr)
 		tokenType = ReturnKeyword
@@ -194,7 +348,9 @@ func (l *Lexer) getNextToken() (Token, error) {
 		return Token{}, fmt.Errorf("unknown symbol: '%s' at line %d, column %d", nextSubstr, l.lineNum, l.colNum)
 	}
 
-	tokenSize := len(value)
+	if tokenSize < 0 {
+		tokenSize = len(value)
+	}
 	token := Token{Type: tokenType, Value: value, Line: l.lineNum, StartColumn: l.colNum, EndColumn: l.colNum + tokenSize}
 
 	l.colNum += tokenSize
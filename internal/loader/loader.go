@@ -0,0 +1,169 @@
+package loader
+
+import (
+	"alna-lang/internal/ast"
+	"alna-lang/internal/lexer"
+	"alna-lang/internal/logger"
+	"alna-lang/internal/parser"
+	"alna-lang/internal/stdlib"
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Loader expands include statements into the declarations of the included
+// modules. A module is either a standard library module, referenced by name
+// (include "strings"), or a source file or folder referenced by a path
+// relative to the including file.
+type Loader struct {
+	logger        *logger.Logger
+	included      map[string]bool
+	functionFiles map[string]string
+}
+
+func NewLoader(lgr *logger.Logger) *Loader {
+	return &Loader{logger: lgr, included: make(map[string]bool), functionFiles: make(map[string]string)}
+}
+
+// FunctionFiles maps the functions declared by included modules to the file
+// they come from. Standard library modules are named std/<module>.alna.
+func (l *Loader) FunctionFiles() map[string]string {
+	return l.functionFiles
+}
+
+// Resolve implicitly includes the prelude and replaces the include statements
+// of tree with the declarations of the modules they reference. Included
+// declarations are placed before the program's own code, and every module is
+// included at most once.
+func (l *Loader) Resolve(tree *ast.RootNode, sourceFile string) error {
+	if absPath, err := filepath.Abs(sourceFile); err == nil {
+		l.included[absPath] = true
+	}
+
+	var children []ast.Node
+	for _, name := range stdlib.Prelude {
+		declarations, err := l.include(name, "")
+		if err != nil {
+			return err
+		}
+		children = append(children, declarations...)
+	}
+
+	program, err := l.expand(tree.Children, filepath.Dir(sourceFile))
+	if err != nil {
+		return err
+	}
+
+	tree.Children = append(children, program...)
+	return nil
+}
+
+func (l *Loader) expand(nodes []ast.Node, dir string) ([]ast.Node, error) {
+	var modules []ast.Node
+	var program []ast.Node
+
+	for _, node := range nodes {
+		include, ok := node.(ast.IncludeNode)
+		if !ok {
+			program = append(program, node)
+			continue
+		}
+
+		declarations, err := l.include(include.Path, dir)
+		if err != nil {
+			return nil, err
+		}
+		modules = append(modules, declarations...)
+	}
+
+	return append(modules, program...), nil
+}
+
+func (l *Loader) include(path string, dir string) ([]ast.Node, error) {
+	if src, ok := stdlib.Source(path); ok {
+		return l.includeSource("std:"+path, src, "")
+	}
+
+	fullPath := filepath.Join(dir, path)
+	info, err := os.Stat(fullPath)
+	if err != nil && filepath.Ext(fullPath) == "" {
+		fullPath += ".alna"
+		info, err = os.Stat(fullPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot include '%s': no standard library module or file with that name", path)
+	}
+
+	if !info.IsDir() {
+		src, err := os.ReadFile(fullPath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot include '%s': %w", path, err)
+		}
+		return l.includeSource(fullPath, src, filepath.Dir(fullPath))
+	}
+
+	// A module folder includes every source file it contains
+	files, err := filepath.Glob(filepath.Join(fullPath, "*.alna"))
+	if err != nil {
+		return nil, fmt.Errorf("cannot include '%s': %w", path, err)
+	}
+	sort.Strings(files)
+
+	var declarations []ast.Node
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("cannot include '%s': %w", file, err)
+		}
+		fileDeclarations, err := l.includeSource(file, src, fullPath)
+		if err != nil {
+			return nil, err
+		}
+		declarations = append(declarations, fileDeclarations...)
+	}
+	return declarations, nil
+}
+
+func (l *Loader) includeSource(key string, src []byte, dir string) ([]ast.Node, error) {
+	file := key
+	if name, isStd := strings.CutPrefix(key, "std:"); isStd {
+		file = "std/" + name + ".alna"
+	}
+
+	if absPath, err := filepath.Abs(key); err == nil && !strings.HasPrefix(key, "std:") {
+		key = absPath
+	}
+	if l.included[key] {
+		return nil, nil
+	}
+	l.included[key] = true
+	l.logger.Debug("Including module %s", key)
+
+	tree, err := Parse(src, l.logger)
+	if err != nil {
+		return nil, fmt.Errorf("in module '%s': %w", strings.TrimPrefix(key, "std:"), err)
+	}
+
+	for _, node := range tree.Children {
+		if fn, ok := node.(ast.FunctionDeclarationNode); ok {
+			l.functionFiles[fn.Name] = file
+		}
+	}
+
+	return l.expand(tree.Children, dir)
+}
+
+// Parse lexes and parses a single module without resolving its includes
+func Parse(src []byte, lgr *logger.Logger) (ast.RootNode, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	tokens, sourceLines, err := lexer.NewLexer(*scanner).Analyze()
+	if err != nil {
+		return ast.RootNode{}, err
+	}
+
+	return parser.NewParser(tokens, sourceLines, lgr).Parse()
+}
@@ -0,0 +1,42 @@
+package loader
+
+import (
+	"alna-lang/internal/analyzer"
+	"alna-lang/internal/ast"
+	"alna-lang/internal/logger"
+	"alna-lang/internal/stdlib"
+	"testing"
+)
+
+// TestStdlibModulesCompile checks that every embedded module, together with
+// the modules it includes, passes semantic analysis
+func TestStdlibModulesCompile(t *testing.T) {
+	lgr := logger.New(logger.LevelInfo, false)
+
+	for _, module := range stdlib.Modules() {
+		t.Run(module, func(t *testing.T) {
+			tree := ast.RootNode{Children: []ast.Node{ast.IncludeNode{Path: module}}}
+
+			if err := NewLoader(lgr).Resolve(&tree, "main.alna"); err != nil {
+				t.Fatalf("Failed to resolve module %s: %v", module, err)
+			}
+
+			if len(tree.Children) == 0 {
+				t.Fatalf("Module %s has no declarations", module)
+			}
+
+			if err := analyzer.NewAnalyzer(&tree, nil, lgr).Analyze(); err != nil {
+				t.Fatalf("Module %s failed analysis: %v", module, err)
+			}
+		})
+	}
+}
+
+func TestIncludeUnknownModule(t *testing.T) {
+	lgr := logger.New(logger.LevelInfo, false)
+	tree := ast.RootNode{Children: []ast.Node{ast.IncludeNode{Path: "does_not_exist"}}}
+
+	if err := NewLoader(lgr).Resolve(&tree, "main.alna"); err == nil {
+		t.Fatal("Expected an error when including an unknown module")
+	}
+}
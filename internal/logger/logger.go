@@ -110,6 +110,12 @@ func (l *Logger) SetLevel(level LogLevel) {
 	l.level = level
 }
 
+// DebugEnabled returns whether debug messages are written anywhere, so that
+// callers can skip building messages that would be discarded
+func (l *Logger) DebugEnabled() bool {
+	return l.level <= LevelDebug && l.IsVerbose()
+}
+
 // IsVerbose returns whether verbose output is enabled
 func (l *Logger) IsVerbose() bool {
 	return l.verboseOut != io.Discard
@@ -0,0 +1,87 @@
+// Package migrate rewrites Alna source written in older forms of the
+// language into the forms of the language definition.
+package migrate
+
+import (
+	"alna-lang/internal/ast"
+	"sort"
+	"strings"
+)
+
+type edit struct {
+	line        int
+	start, end  int
+	replacement string
+}
+
+// Parameters rewrites the parameters of function declarations and function
+// literals written as Type name into name: Type. It returns the rewritten
+// source lines and the number of parameters it changed. Parameters already
+// written as name: Type are left as they are.
+func Parameters(tree ast.RootNode, sourceLines []string) ([]string, int) {
+	var edits []edit
+	collect := func(parameters []ast.FunctionParam) {
+		for _, param := range parameters {
+			if e, ok := parameterEdit(param, sourceLines); ok {
+				edits = append(edits, e)
+			}
+		}
+	}
+
+	ast.Walk(tree, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case ast.FunctionDeclarationNode:
+			collect(n.Parameters)
+		case ast.FunctionLiteralNode:
+			collect(n.Parameters)
+		}
+		return true
+	})
+
+	// Edits are applied from the end of each line, so the columns of the
+	// ones before them stay valid
+	sort.Slice(edits, func(i, j int) bool {
+		if edits[i].line != edits[j].line {
+			return edits[i].line < edits[j].line
+		}
+		return edits[i].start > edits[j].start
+	})
+
+	migrated := append([]string(nil), sourceLines...)
+	for _, e := range edits {
+		line := migrated[e.line]
+		migrated[e.line] = line[:e.start] + e.replacement + line[e.end:]
+	}
+	return migrated, len(edits)
+}
+
+// parameterEdit returns the edit turning param from Type name into
+// name: Type, or false if it is not written as Type name on a single line
+func parameterEdit(param ast.FunctionParam, sourceLines []string) (edit, bool) {
+	pos := param.Position
+	if pos.Line != pos.EndLine || pos.Line < 1 || pos.Line > len(sourceLines) {
+		return edit{}, false
+	}
+
+	line := sourceLines[pos.Line-1]
+	if pos.Column < 0 || pos.EndColumn > len(line) {
+		return edit{}, false
+	}
+
+	text := line[pos.Column:pos.EndColumn]
+	if rest, isNamedFirst := strings.CutPrefix(text, param.Name); isNamedFirst && strings.HasPrefix(strings.TrimSpace(rest), ":") {
+		return edit{}, false
+	}
+
+	typeText, isTypeFirst := strings.CutSuffix(text, param.Name)
+	if !isTypeFirst {
+		return edit{}, false
+	}
+
+	return edit{
+		line:        pos.Line - 1,
+		start:       pos.Column,
+		end:         pos.EndColumn,
+		replacement: param.Name + ": " + strings.TrimSpace(typeText),
+	}, true
+}
@@ -0,0 +1,59 @@
+package migrate
+
+import (
+	"alna-lang/internal/ast"
+	"alna-lang/internal/lexer"
+	"alna-lang/internal/logger"
+	"alna-lang/internal/parser"
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestParameters(t *testing.T) {
+	source := `int add(int a, map<string, int> counts, int b = 2) {
+  fn(int) int twice = fn(int x) int { return x * 2 }
+  return a + b
+}
+
+int mixed(x: int, string label) {
+  return x
+}`
+
+	expected := `int add(a: int, counts: map<string, int>, b: int = 2) {
+  fn(int) int twice = fn(x: int) int { return x * 2 }
+  return a + b
+}
+
+int mixed(x: int, label: string) {
+  return x
+}`
+
+	tree, sourceLines := parse(t, source)
+	migrated, count := Parameters(tree, sourceLines)
+	if got := strings.Join(migrated, "\n"); got != expected {
+		t.Errorf("Migrated source mismatch\nExpected:\n%s\nGot:\n%s", expected, got)
+	}
+	if count != 5 {
+		t.Errorf("Expected 5 migrated parameters, got %d", count)
+	}
+
+	// Migrated source is left unchanged by a second migration
+	tree, sourceLines = parse(t, strings.Join(migrated, "\n"))
+	if _, count := Parameters(tree, sourceLines); count != 0 {
+		t.Errorf("Expected no parameters to migrate twice, got %d", count)
+	}
+}
+
+func parse(t *testing.T, source string) (ast.RootNode, []string) {
+	t.Helper()
+	tokens, sourceLines, err := lexer.NewLexer(*bufio.NewScanner(strings.NewReader(source))).Analyze()
+	if err != nil {
+		t.Fatalf("Failed to lex source: %v", err)
+	}
+	tree, err := parser.NewParser(tokens, sourceLines, logger.New(logger.LevelInfo, false)).Parse()
+	if err != nil {
+		t.Fatalf("Failed to parse source: %v", err)
+	}
+	return tree, sourceLines
+}
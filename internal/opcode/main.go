@@ -23,6 +23,61 @@ const (
 	CALL_BUILTIN
 	CALL
 	RETURN
+	NEQ
+	LE
+	GE
+	AND
+	OR
+	MAKE_ARRAY
+	INDEX
+	POP
+	LOAD_NIL
+	BOX
+	LOAD_CELL
+	STORE_CELL
+	LOAD_UPVALUE
+	STORE_UPVALUE
+	CAPTURE_UPVALUE
+	MAKE_CLOSURE
+	CALL_VALUE
+	TRY
+	LOAD_GLOBAL
+	STORE_GLOBAL
+	DEFER
+	DEFER_BUILTIN
+	RUN_DEFERRED
+	LOAD_NONE
+	JUMP_IF_NONE
+	JUMP_IF_SOME
+	// Superinstructions apply a binary operator to a local variable and a
+	// constant, replacing LOAD_VAR, LOAD_CONST and the operator
+	ADD_VAR_CONST
+	SUB_VAR_CONST
+	MUL_VAR_CONST
+	DIV_VAR_CONST
+	EQ_VAR_CONST
+	NEQ_VAR_CONST
+	LT_VAR_CONST
+	LE_VAR_CONST
+	GT_VAR_CONST
+	GE_VAR_CONST
+	MOD
+	MOD_VAR_CONST
+	// TAIL_CALL calls a function in place of the one executing it, reusing
+	// its frame
+	TAIL_CALL
+	// SPAWN starts a task running a function value, and SELECT waits for
+	// one of several channel operations
+	SPAWN
+	SELECT
+	// GENERATOR suspends the function executing it into a generator, which
+	// it returns, and YIELD suspends a running generator again. ITER turns
+	// an array into an iterator, and NEXT resumes an iterator or jumps once
+	// it is exhausted.
+	GENERATOR
+	YIELD
+	ITER
+	NEXT
 )
 
 // String returns the mnemonic name of the opcode
@@ -64,18 +119,133 @@ func (op Opcode) String() string {
 		return "CALL"
 	case RETURN:
 		return "RETURN"
+	case NEQ:
+		return "NEQ"
+	case LE:
+		return "LE"
+	case GE:
+		return "GE"
+	case AND:
+		return "AND"
+	case OR:
+		return "OR"
+	case MAKE_ARRAY:
+		return "MAKE_ARRAY"
+	case INDEX:
+		return "INDEX"
+	case POP:
+		return "POP"
+	case LOAD_NIL:
+		return "LOAD_NIL"
+	case BOX:
+		return "BOX"
+	case LOAD_CELL:
+		return "LOAD_CELL"
+	case STORE_CELL:
+		return "STORE_CELL"
+	case LOAD_UPVALUE:
+		return "LOAD_UPVALUE"
+	case STORE_UPVALUE:
+		return "STORE_UPVALUE"
+	case CAPTURE_UPVALUE:
+		return "CAPTURE_UPVALUE"
+	case MAKE_CLOSURE:
+		return "MAKE_CLOSURE"
+	case CALL_VALUE:
+		return "CALL_VALUE"
+	case TRY:
+		return "TRY"
+	case LOAD_GLOBAL:
+		return "LOAD_GLOBAL"
+	case STORE_GLOBAL:
+		return "STORE_GLOBAL"
+	case DEFER:
+		return "DEFER"
+	case DEFER_BUILTIN:
+		return "DEFER_BUILTIN"
+	case RUN_DEFERRED:
+		return "RUN_DEFERRED"
+	case LOAD_NONE:
+		return "LOAD_NONE"
+	case JUMP_IF_NONE:
+		return "JUMP_IF_NONE"
+	case JUMP_IF_SOME:
+		return "JUMP_IF_SOME"
+	case ADD_VAR_CONST:
+		return "ADD_VAR_CONST"
+	case SUB_VAR_CONST:
+		return "SUB_VAR_CONST"
+	case MUL_VAR_CONST:
+		return "MUL_VAR_CONST"
+	case DIV_VAR_CONST:
+		return "DIV_VAR_CONST"
+	case EQ_VAR_CONST:
+		return "EQ_VAR_CONST"
+	case NEQ_VAR_CONST:
+		return "NEQ_VAR_CONST"
+	case LT_VAR_CONST:
+		return "LT_VAR_CONST"
+	case LE_VAR_CONST:
+		return "LE_VAR_CONST"
+	case GT_VAR_CONST:
+		return "GT_VAR_CONST"
+	case GE_VAR_CONST:
+		return "GE_VAR_CONST"
+	case MOD:
+		return "MOD"
+	case MOD_VAR_CONST:
+		return "MOD_VAR_CONST"
+	case TAIL_CALL:
+		return "TAIL_CALL"
+	case SPAWN:
+		return "SPAWN"
+	case SELECT:
+		return "SELECT"
+	case GENERATOR:
+		return "GENERATOR"
+	case YIELD:
+		return "YIELD"
+	case ITER:
+		return "ITER"
+	case NEXT:
+		return "NEXT"
 	default:
 		fmt.Printf("Unknown opcode: %d\n", op)
 		return "UNKNOWN"
 	}
 }
 
-// HasOperand returns true if the opcode takes a 1-byte operand
-func (op Opcode) HasOperand() bool {
+// OperandWidths returns the size in bytes of each operand the opcode takes.
+// Multi-byte operands are encoded little-endian.
+func (op Opcode) OperandWidths() []int {
 	switch op {
-	case LOAD_CONST, LOAD_VAR, STORE_VAR, JUMP_IF_FALSE, JUMP_IF_TRUE, START_SCOPE, CALL, CALL_BUILTIN:
-		return true
+	case LOAD_CONST, LOAD_VAR, STORE_VAR, START_SCOPE, LOAD_CELL, STORE_CELL,
+		LOAD_UPVALUE, STORE_UPVALUE, CAPTURE_UPVALUE, CALL_VALUE, LOAD_GLOBAL, STORE_GLOBAL, RETURN, DEFER, SPAWN:
+		return []int{1}
+	case JUMP_IF_FALSE, JUMP_IF_TRUE, JUMP, MAKE_ARRAY, TRY, JUMP_IF_NONE, JUMP_IF_SOME, GENERATOR, NEXT:
+		return []int{2}
+	case CALL_BUILTIN, DEFER_BUILTIN, ADD_VAR_CONST, SUB_VAR_CONST, MUL_VAR_CONST, DIV_VAR_CONST,
+		EQ_VAR_CONST, NEQ_VAR_CONST, LT_VAR_CONST, LE_VAR_CONST, GT_VAR_CONST, GE_VAR_CONST, MOD_VAR_CONST:
+		return []int{1, 1}
+	case CALL, MAKE_CLOSURE, TAIL_CALL:
+		return []int{2, 1}
+	case SELECT:
+		return []int{1, 2, 1}
 	default:
-		return false
+		return nil
+	}
+}
+
+// HasOperand returns true if the opcode takes at least one operand
+func (op Opcode) HasOperand() bool {
+	return len(op.OperandWidths()) > 0
+}
+
+// Size returns the total size in bytes of the instruction, including the opcode
+func (op Opcode) Size() int {
+	size := 1
+	for _, width := range op.OperandWidths() {
+		size += width
 	}
+	return size
 }
@@ -26,7 +26,7 @@ func (p *Parser) parseAssignment() (ast.Node, error) {
 		return nil, p.unexpectedEOFError()
 	}
 
-	value, err := p.parseExpression()
+	value, err := p.parseBinaryExpression()
 	if err != nil {
 		return nil, err
 	}
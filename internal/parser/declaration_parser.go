@@ -4,16 +4,19 @@ import (
 	"alna-lang/internal/ast"
 	"alna-lang/internal/common"
 	"alna-lang/internal/lexer"
+	"alna-lang/internal/types"
+	"fmt"
+	"strings"
 )
 
 func (p *Parser) parseVariableDeclaration() (ast.Node, error) {
-	token := p.currentToken()
-	if token.Type != lexer.DataType {
-		return nil, p.expectedGotError(token, "data type")
+	typeToken := p.currentToken()
+	dataType, err := p.parseType("data type")
+	if err != nil {
+		return nil, err
 	}
 
-	dataType := token.Value
-	identifier := p.advance()
+	identifier := p.currentToken()
 
 	if identifier.Type == lexer.EOF {
 		return nil, p.unexpectedEOFError()
@@ -23,11 +26,11 @@ func (p *Parser) parseVariableDeclaration() (ast.Node, error) {
 		return nil, p.expectedGotError(identifier, "identifier")
 	}
 
-	token = p.advance()
+	token := p.advance()
 	if variableInitialization(token) {
 		p.advance()
 
-		initializer, err := p.parseExpression()
+		initializer, err := p.parseBinaryExpression()
 		if err != nil {
 			return nil, err
 		}
@@ -37,8 +40,8 @@ func (p *Parser) parseVariableDeclaration() (ast.Node, error) {
 			Name:        identifier.Value,
 			Initializer: initializer,
 			Position: common.Position{
-				Line:      token.Line,
-				Column:    token.StartColumn,
+				Line:      typeToken.Line,
+				Column:    typeToken.StartColumn,
 				EndLine:   initializer.Pos().EndLine,
 				EndColumn: initializer.Pos().EndColumn,
 			},
@@ -49,26 +52,83 @@ func (p *Parser) parseVariableDeclaration() (ast.Node, error) {
 		Type: dataType,
 		Name: identifier.Value,
 		Position: common.Position{
-			Line:      token.Line,
-			Column:    token.StartColumn,
+			Line:      typeToken.Line,
+			Column:    typeToken.StartColumn,
 			EndLine:   identifier.Line,
 			EndColumn: identifier.EndColumn,
 		},
 	}, nil
 }
 
+// parseConstDeclaration parses a constant such as const int limit = 10,
+// which is a variable declaration that must be initialized
+func (p *Parser) parseConstDeclaration() (ast.Node, error) {
+	constToken := p.currentToken()
+	if constToken.Type != lexer.ConstKeyword {
+		return nil, p.expectedGotError(constToken, "const")
+	}
+	p.advance()
+
+	declaration, err := p.parseVariableDeclaration()
+	if err != nil {
+		return nil, err
+	}
+
+	constant := declaration.(ast.VariableDeclarationNode)
+	if constant.Initializer == nil {
+		token := p.currentToken()
+		if token.Type == lexer.EOF {
+			return nil, p.unexpectedEOFError()
+		}
+		return nil, p.expectedGotError(token, "=")
+	}
+
+	constant.Constant = true
+	constant.Position.Line = constToken.Line
+	constant.Position.Column = constToken.StartColumn
+	return constant, nil
+}
+
+// parseMutDeclaration parses a mutable variable such as mut int count = 0.
+// Variables declared without mut cannot be assigned to.
+func (p *Parser) parseMutDeclaration() (ast.Node, error) {
+	mutToken := p.currentToken()
+	if mutToken.Type != lexer.MutKeyword {
+		return nil, p.expectedGotError(mutToken, "mut")
+	}
+	p.advance()
+
+	declaration, err := p.parseVariableDeclaration()
+	if err != nil {
+		return nil, err
+	}
+
+	variable := declaration.(ast.VariableDeclarationNode)
+	variable.Mutable = true
+	variable.Position.Line = mutToken.Line
+	variable.Position.Column = mutToken.StartColumn
+	return variable, nil
+}
+
 func variableInitialization(token lexer.Token) bool {
 	return token.Type == lexer.Assignment
 }
 
+// parseFunctionDeclaration parses a function declaration. The return type is
+// written before the name, as in int add(a: int, b: int), or after the
+// parameters, as in add(a: int, b: int) -> int. Functions without either
+// return void.
 func (p *Parser) parseFunctionDeclaration() (ast.Node, error) {
-	token := p.currentToken()
-	if token.Type != lexer.DataType {
-		return nil, p.expectedGotError(token, "return data type")
+	returnType := ""
+	if !p.isSignatureStart() {
+		var err error
+		returnType, err = p.parseType("return data type")
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	returnType := token.Value
-	identifier := p.advance()
+	identifier := p.currentToken()
 
 	if identifier.Type == lexer.EOF {
 		return nil, p.unexpectedEOFError()
@@ -78,7 +138,13 @@ func (p *Parser) parseFunctionDeclaration() (ast.Node, error) {
 		return nil, p.expectedGotError(identifier, "function name identifier")
 	}
 
-	token = p.advance()
+	p.advance()
+	typeParameters, err := p.parseTypeParameters()
+	if err != nil {
+		return nil, err
+	}
+
+	token := p.currentToken()
 	if token.Type != lexer.OpenParenthesis {
 		return nil, p.expectedGotError(token, "opening parenthesis")
 	}
@@ -93,17 +159,31 @@ func (p *Parser) parseFunctionDeclaration() (ast.Node, error) {
 		return nil, p.expectedGotError(token, "closing parenthesis")
 	}
 
-	p.advance()
+	if arrow := p.advance(); arrow.Type == lexer.Arrow {
+		if returnType != "" {
+			return nil, common.CompilerError(tokenToPosition(arrow), fmt.Sprintf("Function '%s' already has the return type %s", identifier.Value, returnType), p.sourceLines)
+		}
+		p.advance()
+		returnType, err = p.parseType("return data type")
+		if err != nil {
+			return nil, err
+		}
+	}
+	if returnType == "" {
+		returnType = "void"
+	}
+
 	body, err := p.parseBlock()
 	if err != nil {
 		return nil, err
 	}
 
 	return ast.FunctionDeclarationNode{
-		Name:       identifier.Value,
-		ReturnType: returnType,
-		Parameters: parameters,
-		Body:       body,
+		Name:           identifier.Value,
+		TypeParameters: typeParameters,
+		ReturnType:     returnType,
+		Parameters:     parameters,
+		Body:           body,
 		Position: common.Position{
 			Line:      token.Line,
 			Column:    token.StartColumn,
@@ -113,35 +193,114 @@ func (p *Parser) parseFunctionDeclaration() (ast.Node, error) {
 	}, nil
 }
 
-func (p *Parser) parseFunctionParametersDeclaration() ([]ast.FunctionParam, error) {
-	parameters := []ast.FunctionParam{}
+// parseTypeParameters parses the optional type parameter list of a generic
+// function, as in T first<T>(array<T> xs)
+func (p *Parser) parseTypeParameters() ([]string, error) {
 	token := p.currentToken()
+	if token.Type != lexer.BinaryOperador || token.Value != "<" {
+		return nil, nil
+	}
 
-	for token.Type != lexer.CloseParenthesis {
-		if token.Type == lexer.EOF {
+	var typeParameters []string
+	for {
+		name := p.advance()
+		if name.Type == lexer.EOF {
 			return nil, p.unexpectedEOFError()
 		}
 
-		parameterType := token
-		if parameterType.Type != lexer.DataType {
-			return nil, p.expectedGotError(parameterType, "parameter data type")
+		if name.Type != lexer.Identifier {
+			return nil, p.expectedGotError(name, "type parameter name")
+		}
+		typeParameters = append(typeParameters, name.Value)
+
+		next := p.advance()
+		if next.Type == lexer.Comma {
+			continue
 		}
 
-		parameterName := p.advance()
-		if parameterName.Type == lexer.EOF {
+		if next.Type != lexer.BinaryOperador || next.Value != ">" {
+			return nil, p.expectedGotError(next, ">")
+		}
+		p.advance()
+
+		return typeParameters, nil
+	}
+}
+
+// parseFunctionLiteral parses an anonymous function such as
+// fn(int x) int { return x * 2 }. A literal without a return type is void.
+func (p *Parser) parseFunctionLiteral() (ast.Node, error) {
+	fnToken := p.currentToken()
+	if fnToken.Type != lexer.FnKeyword {
+		return nil, p.expectedGotError(fnToken, "fn")
+	}
+
+	token := p.advance()
+	if token.Type != lexer.OpenParenthesis {
+		return nil, p.expectedGotError(token, "opening parenthesis")
+	}
+
+	p.advance()
+	parameters, err := p.parseFunctionParametersDeclaration()
+	if err != nil {
+		return nil, err
+	}
+	p.advance()
+
+	returnType := "void"
+	if p.currentToken().Type == lexer.Arrow {
+		p.advance()
+	}
+	if p.currentToken().Type != lexer.OpenBracket {
+		returnType, err = p.parseType("return data type")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	body, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.FunctionLiteralNode{
+		Parameters: parameters,
+		ReturnType: returnType,
+		Body:       body,
+		Position: common.Position{
+			Line:      fnToken.Line,
+			Column:    fnToken.StartColumn,
+			EndLine:   body.Pos().EndLine,
+			EndColumn: body.Pos().EndColumn,
+		},
+	}, nil
+}
+
+func (p *Parser) parseFunctionParametersDeclaration() ([]ast.FunctionParam, error) {
+	parameters := []ast.FunctionParam{}
+	token := p.currentToken()
+
+	for token.Type != lexer.CloseParenthesis {
+		if token.Type == lexer.EOF {
 			return nil, p.unexpectedEOFError()
 		}
 
-		if parameterName.Type != lexer.Identifier {
-			return nil, p.expectedGotError(parameterName, "parameter name")
+		parameter, err := p.parseParameter()
+		if err != nil {
+			return nil, err
 		}
 
-		parameters = append(parameters, ast.FunctionParam{
-			Type: parameterType.Value,
-			Name: parameterName.Value,
-		})
+		token = p.currentToken()
+		if token.Type == lexer.Assignment {
+			p.advance()
+			parameter.Default, err = p.parseBinaryExpression()
+			if err != nil {
+				return nil, err
+			}
+			token = p.currentToken()
+		}
+		parameters = append(parameters, parameter)
 
-		token = p.advance()
 		if token.Type == lexer.Comma {
 			token = p.advance()
 		}
@@ -149,3 +308,307 @@ func (p *Parser) parseFunctionParametersDeclaration() ([]ast.FunctionParam, erro
 
 	return parameters, nil
 }
+
+// parseParameter parses a parameter written as name: Type, or as Type name
+func (p *Parser) parseParameter() (ast.FunctionParam, error) {
+	start := p.currentToken()
+	if start.Type == lexer.Identifier && p.nextToken().Type == lexer.Colon {
+		p.advance()
+		p.advance()
+		parameterType, err := p.parseType("parameter data type")
+		if err != nil {
+			return ast.FunctionParam{}, err
+		}
+
+		end := p.previousToken()
+		return ast.FunctionParam{
+			Type: parameterType,
+			Name: start.Value,
+			Position: common.Position{
+				Line:      start.Line,
+				Column:    start.StartColumn,
+				EndLine:   end.Line,
+				EndColumn: end.EndColumn,
+			},
+		}, nil
+	}
+
+	parameterType, err := p.parseType("parameter data type")
+	if err != nil {
+		return ast.FunctionParam{}, err
+	}
+
+	parameterName := p.currentToken()
+	if parameterName.Type == lexer.EOF {
+		return ast.FunctionParam{}, p.unexpectedEOFError()
+	}
+
+	if parameterName.Type != lexer.Identifier {
+		return ast.FunctionParam{}, p.expectedGotError(parameterName, "parameter name")
+	}
+	p.advance()
+
+	return ast.FunctionParam{
+		Type: parameterType,
+		Name: parameterName.Value,
+		Position: common.Position{
+			Line:      start.Line,
+			Column:    start.StartColumn,
+			EndLine:   parameterName.Line,
+			EndColumn: parameterName.EndColumn,
+		},
+	}, nil
+}
+
+// isSignatureStart reports whether the tokens ahead are the name of a
+// function declared without a leading return type: a name, optional type
+// parameters and a parameter list followed by -> or the body
+func (p *Parser) isSignatureStart() bool {
+	if p.currentToken().Type != lexer.Identifier {
+		return false
+	}
+
+	i := p.position + 1
+	at := func(i int) lexer.Token {
+		if i >= len(p.tokens) {
+			return lexer.Token{Type: lexer.EOF}
+		}
+		return p.tokens[i]
+	}
+
+	if token := at(i); token.Type == lexer.BinaryOperador && token.Value == "<" {
+		for i++; at(i).Type == lexer.Identifier || at(i).Type == lexer.Comma; i++ {
+		}
+		if token := at(i); token.Type != lexer.BinaryOperador || token.Value != ">" {
+			return false
+		}
+		i++
+	}
+
+	if at(i).Type != lexer.OpenParenthesis {
+		return false
+	}
+	for depth := 0; ; i++ {
+		switch at(i).Type {
+		case lexer.OpenParenthesis:
+			depth++
+		case lexer.CloseParenthesis:
+			depth--
+		case lexer.EOF:
+			return false
+		}
+		if depth == 0 {
+			break
+		}
+	}
+
+	next := at(i + 1).Type
+	return next == lexer.Arrow || next == lexer.OpenBracket
+}
+
+// isOptionalDeclarationStart reports whether the tokens ahead declare a
+// variable or function of an optional type parameter, as in T? x
+func (p *Parser) isOptionalDeclarationStart() bool {
+	if p.position+2 >= len(p.tokens) {
+		return false
+	}
+
+	name, question, declared := p.tokens[p.position], p.tokens[p.position+1], p.tokens[p.position+2]
+	return question.Type == lexer.Question && declared.Type == lexer.Identifier && declared.Line == name.Line
+}
+
+// isTupleDeclarationStart reports whether the tokens ahead are the return
+// types of a function returning several values, as in (int, bool) divmod(
+// or (int, bool) pair<T>(
+func (p *Parser) isTupleDeclarationStart() bool {
+	if p.currentToken().Type != lexer.OpenParenthesis {
+		return false
+	}
+
+	at := func(i int) lexer.Token {
+		if i >= len(p.tokens) {
+			return lexer.Token{Type: lexer.EOF}
+		}
+		return p.tokens[i]
+	}
+
+	i := p.position
+	for depth := 0; ; i++ {
+		switch at(i).Type {
+		case lexer.OpenParenthesis:
+			depth++
+		case lexer.CloseParenthesis:
+			depth--
+		case lexer.EOF:
+			return false
+		}
+		if depth == 0 {
+			break
+		}
+	}
+
+	// The name is on the line of the types, so an expression in parentheses
+	// followed by a call on the next line is not mistaken for a declaration
+	name := at(i + 1)
+	if name.Type != lexer.Identifier || name.Line != at(i).Line {
+		return false
+	}
+	next := at(i + 2)
+	return next.Type == lexer.OpenParenthesis || (next.Type == lexer.BinaryOperador && next.Value == "<")
+}
+
+// parseType parses a data type, including the type arguments of container
+// types such as array<int> or map<string, int> and the ? of optional types,
+// and returns its canonical spelling
+func (p *Parser) parseType(expected string) (string, error) {
+	dataType, err := p.parseBaseType(expected)
+	if err != nil {
+		return "", err
+	}
+
+	if p.currentToken().Type != lexer.Question {
+		return dataType, nil
+	}
+	p.advance()
+
+	return types.NewOptional(dataType), nil
+}
+
+func (p *Parser) parseBaseType(expected string) (string, error) {
+	token := p.currentToken()
+	if token.Type == lexer.EOF {
+		return "", p.unexpectedEOFError()
+	}
+
+	if token.Type == lexer.FnKeyword {
+		return p.parseFunctionType()
+	}
+
+	if token.Type == lexer.OpenParenthesis {
+		return p.parseTupleType()
+	}
+
+	// Names other than the builtin data types refer to type parameters
+	if token.Type != lexer.DataType && token.Type != lexer.Identifier {
+		return "", p.expectedGotError(token, expected)
+	}
+
+	next := p.advance()
+	if next.Type != lexer.BinaryOperador || next.Value != "<" {
+		return token.Value, nil
+	}
+	p.advance()
+
+	p.typeNesting++
+	defer func() { p.typeNesting-- }()
+
+	var arguments []string
+	for {
+		argument, err := p.parseType("type argument")
+		if err != nil {
+			return "", err
+		}
+		arguments = append(arguments, argument)
+
+		next = p.currentToken()
+		if next.Type == lexer.Comma {
+			p.advance()
+			continue
+		}
+
+		if next.Type == lexer.EOF {
+			return "", p.unexpectedEOFError()
+		}
+
+		if next.Type != lexer.BinaryOperador || next.Value != ">" {
+			return "", p.expectedGotError(next, ">")
+		}
+		p.advance()
+
+		return fmt.Sprintf("%s<%s>", token.Value, strings.Join(arguments, ", ")), nil
+	}
+}
+
+// parseTupleType parses the types of the values a function returns together,
+// as in (int, bool)
+func (p *Parser) parseTupleType() (string, error) {
+	p.advance()
+
+	p.typeNesting++
+	defer func() { p.typeNesting-- }()
+
+	var elems []string
+	for {
+		elem, err := p.parseType("data type")
+		if err != nil {
+			return "", err
+		}
+		elems = append(elems, elem)
+
+		next := p.currentToken()
+		if next.Type == lexer.Comma {
+			p.advance()
+			continue
+		}
+
+		if next.Type == lexer.EOF {
+			return "", p.unexpectedEOFError()
+		}
+
+		if next.Type != lexer.CloseParenthesis {
+			return "", p.expectedGotError(next, ")")
+		}
+
+		if len(elems) < 2 {
+			return "", p.expectedGotError(next, ",")
+		}
+		p.advance()
+
+		return types.NewTuple(elems), nil
+	}
+}
+
+// parseFunctionType parses a function type such as fn(int, string) bool. A
+// function type without a return type is void.
+func (p *Parser) parseFunctionType() (string, error) {
+	token := p.advance()
+	if token.Type != lexer.OpenParenthesis {
+		return "", p.expectedGotError(token, "opening parenthesis")
+	}
+	p.advance()
+
+	p.typeNesting++
+	var params []string
+	for p.currentToken().Type != lexer.CloseParenthesis {
+		if p.currentToken().Type == lexer.EOF {
+			return "", p.unexpectedEOFError()
+		}
+
+		param, err := p.parseType("parameter data type")
+		if err != nil {
+			return "", err
+		}
+		params = append(params, param)
+
+		if p.currentToken().Type == lexer.Comma {
+			p.advance()
+		}
+	}
+
+	p.typeNesting--
+
+	// Outside of type lists a name after the parameters is the name being
+	// declared, unless another name follows it
+	next := p.advance()
+	namedReturnType := next.Type == lexer.Identifier && (p.typeNesting > 0 || p.nextToken().Type == lexer.Identifier)
+	returnType := "void"
+	if next.Type == lexer.DataType || next.Type == lexer.FnKeyword || namedReturnType {
+		var err error
+		returnType, err = p.parseType("return data type")
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return types.NewFunction(params, returnType), nil
+}
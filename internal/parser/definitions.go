@@ -10,6 +10,9 @@ type Parser struct {
 	position    int
 	sourceLines []string
 	logger      *logger.Logger
+	// typeNesting counts the type argument and parameter lists being parsed,
+	// where a type is never followed by a name
+	typeNesting int
 }
 
 func (p *Parser) StoppedAt() lexer.Token {
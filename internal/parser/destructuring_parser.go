@@ -0,0 +1,131 @@
+package parser
+
+import (
+	"alna-lang/internal/ast"
+	"alna-lang/internal/common"
+	"alna-lang/internal/lexer"
+)
+
+// isDestructuringStart reports whether the tokens from start on are the
+// names of a destructuring assignment: names separated by commas followed by
+// = or :=, or a single name followed by :=
+func (p *Parser) isDestructuringStart(start int) bool {
+	at := func(i int) lexer.Token {
+		if i >= len(p.tokens) {
+			return lexer.Token{Type: lexer.EOF}
+		}
+		return p.tokens[i]
+	}
+
+	i := start
+	for at(i).Type == lexer.Identifier && at(i+1).Type == lexer.Comma {
+		i += 2
+	}
+	if at(i).Type != lexer.Identifier {
+		return false
+	}
+	names := (i-start)/2 + 1
+
+	switch at(i + 1).Type {
+	case lexer.ShortDeclaration:
+		return names > 0
+	case lexer.Assignment:
+		return names > 1
+	default:
+		return false
+	}
+}
+
+// parseDestructuring parses an assignment of several values at once, as in
+// q, r := divmod(7, 2) or a, b = b, a. The names are declared by := and
+// assigned to by =, and a leading mut makes the declared variables mutable.
+func (p *Parser) parseDestructuring() (ast.Node, error) {
+	start := p.currentToken()
+	mutable := start.Type == lexer.MutKeyword
+	if mutable {
+		p.advance()
+	}
+
+	var targets []ast.IdentifierNode
+	for {
+		name := p.currentToken()
+		if name.Type == lexer.EOF {
+			return nil, p.unexpectedEOFError()
+		}
+		if name.Type != lexer.Identifier {
+			return nil, p.expectedGotError(name, "identifier")
+		}
+		targets = append(targets, ast.IdentifierNode{Name: name.Value, Position: tokenToPosition(name)})
+
+		if p.advance().Type != lexer.Comma {
+			break
+		}
+		p.advance()
+	}
+
+	operator := p.currentToken()
+	if operator.Type == lexer.EOF {
+		return nil, p.unexpectedEOFError()
+	}
+	declare := operator.Type == lexer.ShortDeclaration
+	if !declare && (mutable || operator.Type != lexer.Assignment) {
+		return nil, p.expectedGotError(operator, ":=")
+	}
+
+	p.advance()
+	if p.currentToken().Type == lexer.EOF {
+		return nil, p.unexpectedEOFError()
+	}
+
+	value, err := p.parseValueList()
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.DestructuringNode{
+		Targets: targets,
+		Value:   value,
+		Declare: declare,
+		Mutable: mutable,
+		Position: common.Position{
+			Line:      start.Line,
+			Column:    start.StartColumn,
+			EndLine:   value.Pos().EndLine,
+			EndColumn: value.Pos().EndColumn,
+		},
+	}, nil
+}
+
+// parseValueList parses one or more expressions separated by commas. A single
+// expression is returned as it is.
+func (p *Parser) parseValueList() (ast.Node, error) {
+	first, err := p.parseBinaryExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	values := []ast.Node{first}
+	for p.currentToken().Type == lexer.Comma {
+		p.advance()
+		value, err := p.parseBinaryExpression()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	if len(values) == 1 {
+		return first, nil
+	}
+
+	last := values[len(values)-1]
+	return ast.ValueListNode{
+		Values: values,
+		Position: common.Position{
+			Line:      first.Pos().Line,
+			Column:    first.Pos().Column,
+			EndLine:   last.Pos().EndLine,
+			EndColumn: last.Pos().EndColumn,
+		},
+	}, nil
+}
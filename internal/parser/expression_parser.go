@@ -6,21 +6,37 @@ import (
 	"alna-lang/internal/lexer"
 )
 
-func (p *Parser) parseLowerPrecedence() (ast.Node, error) {
-	left, err := p.parseHigherPrecedence()
+// binaryPrecedence is the binding power of each binary operator. Operators
+// with a higher precedence bind tighter, and operators of equal precedence
+// associate to the left.
+var binaryPrecedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3,
+	"!=": 3,
+	"<":  4,
+	"<=": 4,
+	">":  4,
+	">=": 4,
+	"??": 5,
+	"+":  6,
+	"-":  6,
+	"*":  7,
+	"/":  7,
+	"%":  7,
+}
+
+func (p *Parser) parseBinaryOperation(minPrecedence int) (ast.Node, error) {
+	left, err := p.parsePostfix()
 	if err != nil {
 		return nil, err
 	}
 
 	operator := p.currentToken()
-	if operator.Type == lexer.EOF {
-		return left, nil
-	}
-
-	for isLowPrecedenceOperator(operator) {
+	for isBinaryOperator(operator) && binaryPrecedence[operator.Value] >= minPrecedence {
 		p.advance()
 
-		right, err := p.parseHigherPrecedence()
+		right, err := p.parseBinaryOperation(binaryPrecedence[operator.Value] + 1)
 		if err != nil {
 			return nil, err
 		}
@@ -43,57 +59,92 @@ func (p *Parser) parseLowerPrecedence() (ast.Node, error) {
 	return left, nil
 }
 
-func (p *Parser) parseHigherPrecedence() (ast.Node, error) {
-	token := p.currentToken()
-	if token.Type == lexer.EOF {
-		return nil, p.unexpectedEOFError()
-	}
-
-	var left ast.Node
-	var err error
-
-	switch token.Type {
-	case lexer.OpenParenthesis:
-		left, err = p.parseParenthised()
-	case lexer.Number:
-		left, err = p.parseNumber()
-	case lexer.BooleanOperator:
-		left, err = p.parseBoolean()
-	case lexer.Identifier:
-		left, err = p.parseIdentifier()
-	default:
-		return nil, p.unexpectedTokenError(token)
-	}
-
+func (p *Parser) parsePostfix() (ast.Node, error) {
+	expression, err := p.parsePrimary()
 	if err != nil {
 		return nil, err
 	}
 
-	operator := p.currentToken()
-	for isHighPrecedenceOperator(operator) {
+	for p.currentToken().Type == lexer.OpenSquare || p.currentToken().Type == lexer.Question {
+		if question := p.currentToken(); question.Type == lexer.Question {
+			p.advance()
+			expression = ast.TryNode{
+				Value: expression,
+				Position: common.Position{
+					Line:      expression.Pos().Line,
+					Column:    expression.Pos().Column,
+					EndLine:   question.Line,
+					EndColumn: question.EndColumn,
+				},
+			}
+			continue
+		}
+
 		p.advance()
 
-		right, err := p.parseHigherPrecedence()
+		index, err := p.parseBinaryExpression()
 		if err != nil {
 			return nil, err
 		}
 
-		left = ast.BinaryOpNode{
-			Left:     left,
-			Operator: operator,
-			Right:    right,
+		closeSquare := p.currentToken()
+		if closeSquare.Type == lexer.EOF {
+			return nil, p.unexpectedEOFError()
+		}
+
+		if closeSquare.Type != lexer.CloseSquare {
+			return nil, p.expectedGotError(closeSquare, "]")
+		}
+		p.advance()
+
+		expression = ast.IndexNode{
+			Target: expression,
+			Index:  index,
 			Position: common.Position{
-				Line:      left.Pos().Line,
-				Column:    left.Pos().Column,
-				EndLine:   right.Pos().EndLine,
-				EndColumn: right.Pos().EndColumn,
+				Line:      expression.Pos().Line,
+				Column:    expression.Pos().Column,
+				EndLine:   closeSquare.Line,
+				EndColumn: closeSquare.EndColumn,
 			},
 		}
+	}
 
-		operator = p.currentToken()
+	return expression, nil
+}
+
+func (p *Parser) parsePrimary() (ast.Node, error) {
+	token := p.currentToken()
+	if token.Type == lexer.EOF {
+		return nil, p.unexpectedEOFError()
 	}
 
-	return left, nil
+	switch token.Type {
+	case lexer.OpenParenthesis:
+		return p.parseParenthised()
+	case lexer.Number:
+		return p.parseNumber()
+	case lexer.BooleanOperator:
+		return p.parseBoolean()
+	case lexer.NoneKeyword:
+		return p.parseNone()
+	case lexer.StringLiteral:
+		return p.parseString()
+	case lexer.InterpolatedString:
+		return p.parseInterpolatedString()
+	case lexer.OpenSquare:
+		return p.parseArrayLiteral()
+	case lexer.IfKeyword:
+		return p.parseIfExpression()
+	case lexer.FnKeyword:
+		return p.parseFunctionLiteral()
+	case lexer.Identifier:
+		if p.nextToken().Type == lexer.OpenParenthesis {
+			return p.parseFunctionCall()
+		}
+		return p.parseIdentifier()
+	default:
+		return nil, p.unexpectedTokenError(token)
+	}
 }
 
 func (p *Parser) parseParenthised() (ast.Node, error) {
@@ -169,6 +220,86 @@ func (p *Parser) parseBoolean() (ast.Node, error) {
 	}, nil
 }
 
+func (p *Parser) parseNone() (ast.Node, error) {
+	token := p.currentToken()
+	if token.Type != lexer.NoneKeyword {
+		return nil, p.expectedGotError(token, "none")
+	}
+
+	p.advance()
+
+	return ast.NoneNode{
+		Position: common.Position{
+			Line:      token.Line,
+			Column:    token.StartColumn,
+			EndLine:   token.Line,
+			EndColumn: token.EndColumn,
+		},
+	}, nil
+}
+
+func (p *Parser) parseString() (ast.Node, error) {
+	token := p.currentToken()
+	if token.Type == lexer.EOF {
+		return nil, p.unexpectedEOFError()
+	}
+
+	if token.Type != lexer.StringLiteral {
+		return nil, p.expectedGotError(token, "string")
+	}
+
+	p.advance()
+
+	return ast.StringNode{
+		Value: token.Value,
+		Position: common.Position{
+			Line:      token.Line,
+			Column:    token.StartColumn,
+			EndLine:   token.Line,
+			EndColumn: token.EndColumn,
+		},
+	}, nil
+}
+
+func (p *Parser) parseArrayLiteral() (ast.Node, error) {
+	openSquare := p.currentToken()
+	if openSquare.Type != lexer.OpenSquare {
+		return nil, p.expectedGotError(openSquare, "[")
+	}
+	p.advance()
+
+	var elements []ast.Node
+	for p.currentToken().Type != lexer.CloseSquare {
+		if p.currentToken().Type == lexer.EOF {
+			return nil, p.unexpectedEOFError()
+		}
+
+		element, err := p.parseBinaryExpression()
+		if err != nil {
+			return nil, err
+		}
+
+		elements = append(elements, element)
+
+		if p.currentToken().Type == lexer.Comma {
+			p.advance()
+		}
+	}
+
+	closeSquare := p.currentToken()
+	p.advance()
+
+	return ast.ArrayLiteralNode{
+		Elements: elements,
+		Position: common.Position{
+			Line:      openSquare.Line,
+			Column:    openSquare.StartColumn,
+			EndLine:   closeSquare.Line,
+			EndColumn: closeSquare.EndColumn,
+		},
+	}, nil
+}
+
 func (p *Parser) parseIdentifier() (ast.Node, error) {
 	token := p.currentToken()
 	if token.Type == lexer.EOF {
@@ -192,10 +323,7 @@ func (p *Parser) parseIdentifier() (ast.Node, error) {
 	}, nil
 }
 
-func isHighPrecedenceOperator(op lexer.Token) bool {
-	return op.Value == "*" || op.Value == "/"
-}
-
-func isLowPrecedenceOperator(op lexer.Token) bool {
-	return !isHighPrecedenceOperator(op) && op.Type == lexer.BinaryOperador
+func isBinaryOperator(op lexer.Token) bool {
+	_, known := binaryPrecedence[op.Value]
+	return op.Type == lexer.BinaryOperador && known
 }
@@ -0,0 +1,175 @@
+package parser
+
+import (
+	"alna-lang/internal/ast"
+	"alna-lang/internal/common"
+	"alna-lang/internal/lexer"
+	"bufio"
+	"strconv"
+	"strings"
+)
+
+// parseInterpolatedString turns a string with {expression} parts into the
+// concatenation of its text and the formatted values of its expressions.
+// "x = {x:5}" becomes "x = " + format(x, "5"), where the text after a colon
+// is the format spec. Braces are written as {{ and }} in the text.
+func (p *Parser) parseInterpolatedString() (ast.Node, error) {
+	token := p.currentToken()
+	if token.Type != lexer.InterpolatedString {
+		return nil, p.expectedGotError(token, "string")
+	}
+	p.advance()
+
+	raw := token.Value
+	// Columns of the source between the quotes
+	start := token.StartColumn + 1
+	position := func(from, to int) common.Position {
+		return common.Position{Line: token.Line, Column: start + from, EndLine: token.Line, EndColumn: start + to}
+	}
+
+	var parts []ast.Node
+	var text strings.Builder
+	textStart := 0
+	flushText := func(end int) error {
+		if text.Len() == 0 {
+			return nil
+		}
+		value, err := strconv.Unquote(`"` + text.String() + `"`)
+		if err != nil {
+			return common.CompilerError(position(textStart, end), "Invalid string literal", p.sourceLines)
+		}
+		parts = append(parts, ast.StringNode{Value: value, Position: position(textStart, end)})
+		text.Reset()
+		return nil
+	}
+
+	for i := 0; i < len(raw); {
+		switch {
+		case raw[i] == '\\' && i+1 < len(raw):
+			text.WriteString(raw[i : i+2])
+			i += 2
+		case strings.HasPrefix(raw[i:], "{{"), strings.HasPrefix(raw[i:], "}}"):
+			text.WriteByte(raw[i])
+			i += 2
+		case raw[i] == '}':
+			return nil, common.CompilerError(position(i, i+1), "Unmatched '}' in string, write '}}' for a brace", p.sourceLines)
+		case raw[i] == '{':
+			if err := flushText(i); err != nil {
+				return nil, err
+			}
+
+			end := closingBrace(raw, i)
+			if end < 0 {
+				return nil, common.CompilerError(position(i, len(raw)), "Unterminated '{' in string, write '{{' for a brace", p.sourceLines)
+			}
+
+			part, err := p.parseInterpolation(raw[i+1:end], start+i+1, token.Line, position(i, end+1))
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, part)
+
+			i = end + 1
+			textStart = i
+		default:
+			text.WriteByte(raw[i])
+			i++
+		}
+	}
+	if err := flushText(len(raw)); err != nil {
+		return nil, err
+	}
+
+	result := parts[0]
+	for _, part := range parts[1:] {
+		result = ast.BinaryOpNode{
+			Left:     result,
+			Operator: lexer.Token{Type: lexer.BinaryOperador, Value: "+", Line: token.Line, StartColumn: part.Pos().Column, EndColumn: part.Pos().Column},
+			Right:    part,
+			Position: common.Position{
+				Line:      token.Line,
+				Column:    result.Pos().Column,
+				EndLine:   token.Line,
+				EndColumn: part.Pos().EndColumn,
+			},
+		}
+	}
+	return result, nil
+}
+
+// closingBrace returns the index of the brace closing the one at open, or -1
+// if it is never closed. Expressions may contain braces of their own.
+func closingBrace(raw string, open int) int {
+	depth := 0
+	for i := open; i < len(raw); i++ {
+		switch raw[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// parseInterpolation parses the source of an {expression:spec} part, which
+// starts at column of line, into a call to format
+func (p *Parser) parseInterpolation(source string, column, line int, position common.Position) (ast.Node, error) {
+	spec := ""
+	if colon := specSeparator(source); colon >= 0 {
+		source, spec = source[:colon], source[colon+1:]
+	}
+
+	if strings.TrimSpace(source) == "" {
+		return nil, common.CompilerError(position, "Expected an expression inside '{}' in string", p.sourceLines)
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(source))
+	tokens, _, err := lexer.NewLexer(*scanner).Analyze()
+	if err != nil {
+		return nil, common.CompilerError(position, "Invalid expression inside '{}' in string", p.sourceLines)
+	}
+	for i := range tokens {
+		tokens[i].Line = line
+		tokens[i].StartColumn += column
+		tokens[i].EndColumn += column
+	}
+
+	inner := NewParser(tokens, p.sourceLines, p.logger)
+	value, err := inner.parseBinaryExpression()
+	if err != nil {
+		return nil, err
+	}
+	if inner.position < len(inner.tokens) {
+		return nil, inner.unexpectedTokenError(inner.currentToken())
+	}
+
+	return ast.FunctionCallNode{
+		Name:      "format",
+		Arguments: []ast.Node{value, ast.StringNode{Value: spec, Position: position}},
+		Resolved:  new([]ast.Node),
+		Position:  position,
+	}, nil
+}
+
+// specSeparator returns the index of the colon that starts the format spec of
+// an interpolation, or -1 if it has none
+func specSeparator(source string) int {
+	depth := 0
+	for i, char := range source {
+		switch char {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case ':':
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
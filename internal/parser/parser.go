@@ -20,6 +20,10 @@ func (p *Parser) Parse() (ast.RootNode, error) {
 	}
 
 	for p.position < len(p.tokens) {
+		if p.skipSemicolons() {
+			continue
+		}
+
 		expression, err := p.parseExpression()
 		program.Children = append(program.Children, expression)
 
@@ -45,19 +49,65 @@ func (p *Parser) parseExpression() (ast.Node, error) {
 	switch token.Type {
 	case lexer.IfKeyword:
 		return p.parseIfExpression()
-	case lexer.DataType:
+	case lexer.ForKeyword:
+		return p.parseFor()
+	case lexer.DataType, lexer.FnKeyword:
 		return p.parseDeclaration()
+	case lexer.ConstKeyword:
+		return p.parseConstDeclaration()
+	case lexer.MutKeyword:
+		if p.nextToken().Type == lexer.Identifier && p.isDestructuringStart(p.position+1) {
+			return p.parseDestructuring()
+		}
+		return p.parseMutDeclaration()
 	case lexer.Identifier:
+		// A name followed by another name on the same line declares a
+		// variable or function whose type is a type parameter, as in T x
+		if next := p.nextToken(); next.Type == lexer.Identifier && next.Line == token.Line {
+			return p.parseDeclaration()
+		}
+		if p.isOptionalDeclarationStart() {
+			return p.parseDeclaration()
+		}
+		if p.isSignatureStart() {
+			return p.parseFunctionDeclaration()
+		}
 		return p.parseIdentifierUsage()
-	case lexer.OpenParenthesis, lexer.Number, lexer.BooleanOperator:
+	case lexer.OpenParenthesis:
+		if p.isTupleDeclarationStart() {
+			return p.parseFunctionDeclaration()
+		}
+		return p.parseBinaryExpression()
+	case lexer.Number, lexer.BooleanOperator, lexer.NoneKeyword, lexer.StringLiteral, lexer.InterpolatedString, lexer.OpenSquare:
 		return p.parseBinaryExpression()
 	case lexer.ReturnKeyword:
 		return p.parseReturn()
+	case lexer.YieldKeyword:
+		return p.parseYield()
+	case lexer.DeferKeyword:
+		return p.parseDefer()
+	case lexer.SpawnKeyword:
+		return p.parseSpawn()
+	case lexer.SelectKeyword:
+		return p.parseSelect()
+	case lexer.IncludeKeyword:
+		return p.parseInclude()
 	default:
 		return nil, p.unexpectedTokenError(token)
 	}
 }
 
+// skipSemicolons consumes the optional semicolons that separate statements
+// and reports whether any were found
+func (p *Parser) skipSemicolons() bool {
+	skipped := false
+	for p.currentToken().Type == lexer.Semicolon {
+		p.advance()
+		skipped = true
+	}
+	return skipped
+}
+
 func (p *Parser) parseIfExpression() (ast.Node, error) {
 	ifToken := p.currentToken()
 	if ifToken.Type != lexer.IfKeyword {
@@ -70,6 +120,11 @@ func (p *Parser) parseIfExpression() (ast.Node, error) {
 		return nil, err
 	}
 
+	binding, err := p.parseIsSome()
+	if err != nil {
+		return nil, err
+	}
+
 	thenBranch, err := p.parseConditionedBlock()
 	if err != nil {
 		return nil, err
@@ -92,6 +147,7 @@ func (p *Parser) parseIfExpression() (ast.Node, error) {
 
 	return ast.IfExpressionNode{
 		Condition:  condition,
+		Binding:    binding,
 		ThenBranch: thenBranch,
 		ElseBranch: elseBranch,
 		Position: common.Position{
@@ -103,6 +159,81 @@ func (p *Parser) parseIfExpression() (ast.Node, error) {
 	}, nil
 }
 
+// parseIsSome parses the is some name that follows the condition of an if
+// unwrapping an optional, and returns nil when the condition has none
+func (p *Parser) parseIsSome() (*ast.IdentifierNode, error) {
+	if p.currentToken().Type != lexer.IsKeyword {
+		return nil, nil
+	}
+
+	some := p.advance()
+	if some.Type == lexer.EOF {
+		return nil, p.unexpectedEOFError()
+	}
+	if some.Type != lexer.SomeKeyword {
+		return nil, p.expectedGotError(some, "some")
+	}
+
+	name := p.advance()
+	if name.Type == lexer.EOF {
+		return nil, p.unexpectedEOFError()
+	}
+	if name.Type != lexer.Identifier {
+		return nil, p.expectedGotError(name, "identifier")
+	}
+	p.advance()
+
+	return &ast.IdentifierNode{Name: name.Value, Position: tokenToPosition(name)}, nil
+}
+
+// parseFor parses a for-in loop: the name of the values, in, the array or
+// generator they come from and the block run for each of them
+func (p *Parser) parseFor() (ast.Node, error) {
+	forToken := p.currentToken()
+	if forToken.Type != lexer.ForKeyword {
+		return nil, p.expectedGotError(forToken, "for")
+	}
+
+	name := p.advance()
+	if name.Type == lexer.EOF {
+		return nil, p.unexpectedEOFError()
+	}
+	if name.Type != lexer.Identifier {
+		return nil, p.expectedGotError(name, "identifier")
+	}
+
+	in := p.advance()
+	if in.Type == lexer.EOF {
+		return nil, p.unexpectedEOFError()
+	}
+	if in.Type != lexer.InKeyword {
+		return nil, p.expectedGotError(in, "in")
+	}
+	p.advance()
+
+	iterable, err := p.parseBinaryExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := p.parseConditionedBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.ForNode{
+		Binding:  ast.IdentifierNode{Name: name.Value, Position: tokenToPosition(name)},
+		Iterable: iterable,
+		Body:     body,
+		Position: common.Position{
+			Line:      forToken.Line,
+			Column:    forToken.StartColumn,
+			EndLine:   body.Pos().EndLine,
+			EndColumn: body.Pos().EndColumn,
+		},
+	}, nil
+}
+
 func (p *Parser) parseConditionedBlock() (ast.BlockNode, error) {
 	block, err := p.parseBlock()
 	if err != nil {
@@ -129,6 +260,10 @@ func (p *Parser) parseBlock() (ast.BlockNode, error) {
 			return ast.BlockNode{}, p.unexpectedEOFError()
 		}
 
+		if p.skipSemicolons() {
+			continue
+		}
+
 		expression, err := p.parseExpression()
 		if err != nil {
 			return ast.BlockNode{}, err
@@ -154,18 +289,21 @@ func (p *Parser) parseBlock() (ast.BlockNode, error) {
 }
 
 func (p *Parser) parseDeclaration() (ast.Node, error) {
-	token := p.currentToken()
-	if token.Type != lexer.DataType {
-		return nil, p.expectedGotError(token, "data type")
+	start := p.position
+	if _, err := p.parseType("data type"); err != nil {
+		return nil, err
 	}
 
-	nextToken := p.nextToken()
-	if nextToken.Type != lexer.Identifier {
-		return nil, p.expectedGotError(nextToken, "identifier")
+	identifier := p.currentToken()
+	if identifier.Type != lexer.Identifier {
+		return nil, p.expectedGotError(identifier, "identifier")
 	}
 
-	afterNextToken := p.tokens[p.position+2]
-	if afterNextToken.Type == lexer.OpenParenthesis {
+	next := p.nextToken()
+	isFunction := next.Type == lexer.OpenParenthesis || (next.Type == lexer.BinaryOperador && next.Value == "<")
+	p.position = start
+
+	if isFunction {
 		return p.parseFunctionDeclaration()
 	}
 
@@ -178,13 +316,12 @@ func (p *Parser) parseIdentifierUsage() (ast.Node, error) {
 		return nil, p.expectedGotError(token, "identifier")
 	}
 
-	if p.nextToken().Type == lexer.OpenParenthesis {
-		return p.parseFunctionCall()
-	}
-
 	if p.nextToken().Type == lexer.Assignment {
 		return p.parseAssignment()
 	}
+	if p.isDestructuringStart(p.position) {
+		return p.parseDestructuring()
+	}
 	return p.parseBinaryExpression()
 }
 
@@ -193,7 +330,7 @@ func (p *Parser) parseBinaryExpression() (ast.Node, error) {
 		return nil, p.unexpectedEOFError()
 	}
 
-	return p.parseLowerPrecedence()
+	return p.parseBinaryOperation(1)
 }
 
 func (p *Parser) parseReturn() (ast.Node, error) {
@@ -203,13 +340,147 @@ func (p *Parser) parseReturn() (ast.Node, error) {
 	}
 	p.advance()
 
+	position := tokenToPosition(token)
+
+	// A return value has to start on the same line as the return keyword
+	var value ast.Node
+	next := p.currentToken()
+	if next.Line == token.Line && next.Type != lexer.CloseBracket && next.Type != lexer.Semicolon && next.Type != lexer.EOF {
+		var err error
+		value, err = p.parseValueList()
+		if err != nil {
+			return nil, err
+		}
+
+		position.EndLine = value.Pos().EndLine
+		position.EndColumn = value.Pos().EndColumn
+	}
+
 	return ast.ReturnNode{
-		Value: nil,
+		Value:    value,
+		Position: position,
+	}, nil
+}
+
+// parseYield parses a yield statement, whose value has to start on the same
+// line as the yield keyword
+func (p *Parser) parseYield() (ast.Node, error) {
+	token := p.currentToken()
+	if token.Type != lexer.YieldKeyword {
+		return nil, p.expectedGotError(token, "yield")
+	}
+	p.advance()
+
+	next := p.currentToken()
+	if next.Line != token.Line || next.Type == lexer.CloseBracket || next.Type == lexer.Semicolon || next.Type == lexer.EOF {
+		return nil, common.CompilerError(tokenToPosition(token), "yield expects a value", p.sourceLines)
+	}
+
+	value, err := p.parseBinaryExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.YieldNode{
+		Value: value,
+		Position: common.Position{
+			Line:      token.Line,
+			Column:    token.StartColumn,
+			EndLine:   value.Pos().EndLine,
+			EndColumn: value.Pos().EndColumn,
+		},
+	}, nil
+}
+
+// parseDefer parses a defer statement, which takes a function call
+func (p *Parser) parseDefer() (ast.Node, error) {
+	token := p.currentToken()
+	if token.Type != lexer.DeferKeyword {
+		return nil, p.expectedGotError(token, "defer")
+	}
+
+	next := p.advance()
+	if next.Type == lexer.EOF {
+		return nil, p.unexpectedEOFError()
+	}
+
+	value, err := p.parseBinaryExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	call, isCall := value.(ast.FunctionCallNode)
+	if !isCall {
+		return nil, common.CompilerError(value.Pos(), "defer expects a function call", p.sourceLines)
+	}
+
+	return ast.DeferNode{
+		Call: call,
+		Position: common.Position{
+			Line:      token.Line,
+			Column:    token.StartColumn,
+			EndLine:   call.Pos().EndLine,
+			EndColumn: call.Pos().EndColumn,
+		},
+	}, nil
+}
+
+// parseSpawn parses a spawn statement, which takes a function call
+func (p *Parser) parseSpawn() (ast.Node, error) {
+	token := p.currentToken()
+	if token.Type != lexer.SpawnKeyword {
+		return nil, p.expectedGotError(token, "spawn")
+	}
+
+	next := p.advance()
+	if next.Type == lexer.EOF {
+		return nil, p.unexpectedEOFError()
+	}
+
+	value, err := p.parseBinaryExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	call, isCall := value.(ast.FunctionCallNode)
+	if !isCall {
+		return nil, common.CompilerError(value.Pos(), "spawn expects a function call", p.sourceLines)
+	}
+
+	return ast.SpawnNode{
+		Call: call,
+		Position: common.Position{
+			Line:      token.Line,
+			Column:    token.StartColumn,
+			EndLine:   call.Pos().EndLine,
+			EndColumn: call.Pos().EndColumn,
+		},
+	}, nil
+}
+
+func (p *Parser) parseInclude() (ast.Node, error) {
+	token := p.currentToken()
+	if token.Type != lexer.IncludeKeyword {
+		return nil, p.expectedGotError(token, "include")
+	}
+
+	path := p.advance()
+	if path.Type == lexer.EOF {
+		return nil, p.unexpectedEOFError()
+	}
+
+	if path.Type != lexer.StringLiteral {
+		return nil, p.expectedGotError(path, "module path string")
+	}
+	p.advance()
+
+	return ast.IncludeNode{
+		Path: path.Value,
 		Position: common.Position{
 			Line:      token.Line,
 			Column:    token.StartColumn,
-			EndLine:   token.Line,
-			EndColumn: token.EndColumn,
+			EndLine:   path.Line,
+			EndColumn: path.EndColumn,
 		},
 	}, nil
 }
@@ -241,6 +512,7 @@ func (p *Parser) parseFunctionCall() (ast.Node, error) {
 	return ast.FunctionCallNode{
 		Name:      identifier.Value,
 		Arguments: arguments,
+		Resolved:  new([]ast.Node),
 		Position: common.Position{
 			Line:      identifier.Line,
 			Column:    identifier.StartColumn,
@@ -258,7 +530,7 @@ func (p *Parser) parseFunctionArguments() ([]ast.Node, error) {
 			return nil, p.unexpectedEOFError()
 		}
 
-		arg, err := p.parseBinaryExpression()
+		arg, err := p.parseArgument()
 		if err != nil {
 			return nil, err
 		}
@@ -272,3 +544,30 @@ func (p *Parser) parseFunctionArguments() ([]ast.Node, error) {
 
 	return arguments, nil
 }
+
+// parseArgument parses an argument of a call, which is either an expression
+// or a name followed by a colon and an expression
+func (p *Parser) parseArgument() (ast.Node, error) {
+	name := p.currentToken()
+	if name.Type != lexer.Identifier || p.nextToken().Type != lexer.Colon {
+		return p.parseBinaryExpression()
+	}
+	p.advance()
+	p.advance()
+
+	value, err := p.parseBinaryExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.NamedArgumentNode{
+		Name:  name.Value,
+		Value: value,
+		Position: common.Position{
+			Line:      name.Line,
+			Column:    name.StartColumn,
+			EndLine:   value.Pos().EndLine,
+			EndColumn: value.Pos().EndColumn,
+		},
+	}, nil
+}
@@ -0,0 +1,114 @@
+package parser
+
+import (
+	"alna-lang/internal/ast"
+	"alna-lang/internal/common"
+	"alna-lang/internal/lexer"
+)
+
+// parseSelect parses a select statement: cases made of a send or receive
+// call, which can declare a name for the value received, each followed by
+// its block, and an optional else block after the last case
+//
+//	select {
+//	  case job := receive(jobs) { ... }
+//	  case send(results, total) { ... }
+//	  else { ... }
+//	}
+func (p *Parser) parseSelect() (ast.Node, error) {
+	selectToken := p.currentToken()
+	if selectToken.Type != lexer.SelectKeyword {
+		return nil, p.expectedGotError(selectToken, "select")
+	}
+
+	open := p.advance()
+	if open.Type == lexer.EOF {
+		return nil, p.unexpectedEOFError()
+	}
+	if open.Type != lexer.OpenBracket {
+		return nil, p.expectedGotError(open, "{")
+	}
+	p.advance()
+
+	node := ast.SelectNode{}
+	for p.currentToken().Type != lexer.CloseBracket {
+		if p.skipSemicolons() {
+			continue
+		}
+
+		token := p.currentToken()
+		switch {
+		case token.Type == lexer.EOF:
+			return nil, p.unexpectedEOFError()
+		case node.Else != nil:
+			return nil, common.CompilerError(tokenToPosition(token), "the else block must be the last one of a select", p.sourceLines)
+		case token.Type == lexer.CaseKeyword:
+			selectCase, err := p.parseSelectCase()
+			if err != nil {
+				return nil, err
+			}
+			node.Cases = append(node.Cases, selectCase)
+		case token.Type == lexer.ElseKeyword:
+			p.advance()
+			block, err := p.parseConditionedBlock()
+			if err != nil {
+				return nil, err
+			}
+			node.Else = &block
+		default:
+			return nil, p.expectedGotError(token, "case")
+		}
+	}
+	closeBracket := p.currentToken()
+	p.advance()
+
+	if len(node.Cases) == 0 {
+		return nil, common.CompilerError(tokenToPosition(selectToken), "select needs at least one case", p.sourceLines)
+	}
+
+	node.Position = common.Position{
+		Line:      selectToken.Line,
+		Column:    selectToken.StartColumn,
+		EndLine:   closeBracket.Line,
+		EndColumn: closeBracket.EndColumn,
+	}
+	return node, nil
+}
+
+func (p *Parser) parseSelectCase() (ast.SelectCase, error) {
+	caseToken := p.currentToken()
+	p.advance()
+
+	var binding *ast.IdentifierNode
+	if name := p.currentToken(); name.Type == lexer.Identifier && p.nextToken().Type == lexer.ShortDeclaration {
+		binding = &ast.IdentifierNode{Name: name.Value, Position: tokenToPosition(name)}
+		p.advance()
+		p.advance()
+	}
+
+	value, err := p.parseBinaryExpression()
+	if err != nil {
+		return ast.SelectCase{}, err
+	}
+	operation, isCall := value.(ast.FunctionCallNode)
+	if !isCall {
+		return ast.SelectCase{}, common.CompilerError(value.Pos(), "a select case expects a call to send or receive", p.sourceLines)
+	}
+
+	body, err := p.parseConditionedBlock()
+	if err != nil {
+		return ast.SelectCase{}, err
+	}
+
+	return ast.SelectCase{
+		Binding:   binding,
+		Operation: operation,
+		Body:      body,
+		Position: common.Position{
+			Line:      caseToken.Line,
+			Column:    caseToken.StartColumn,
+			EndLine:   body.Pos().EndLine,
+			EndColumn: body.Pos().EndColumn,
+		},
+	}, nil
+}
@@ -0,0 +1,38 @@
+package stdlib
+
+import (
+	"embed"
+	"sort"
+	"strings"
+)
+
+//go:embed *.alna
+var files embed.FS
+
+// Prelude lists the modules that are implicitly included in every program
+var Prelude = []string{"io", "results"}
+
+// Source returns the source code of the standard library module with the
+// given name, e.g. "strings" for strings.alna
+func Source(name string) ([]byte, bool) {
+	src, err := files.ReadFile(name + ".alna")
+	if err != nil {
+		return nil, false
+	}
+	return src, true
+}
+
+// Modules returns the names of all standard library modules
+func Modules() []string {
+	entries, err := files.ReadDir(".")
+	if err != nil {
+		return nil
+	}
+
+	var modules []string
+	for _, entry := range entries {
+		modules = append(modules, strings.TrimSuffix(entry.Name(), ".alna"))
+	}
+	sort.Strings(modules)
+	return modules
+}
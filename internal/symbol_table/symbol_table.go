@@ -1,11 +1,20 @@
 package symboltable
 
-import "fmt"
+import (
+	"alna-lang/internal/common"
+	"fmt"
+)
 
+// VariableInfo describes a declared name. Only Mutable variables can be
+// assigned to, and Position is where the name was declared.
 type VariableInfo struct {
-	Name  string
-	Type  string
-	Index int
+	Name      string
+	Type      string
+	Index     int
+	Constant  bool
+	Mutable   bool
+	Parameter bool
+	Position  common.Position
 }
 
 type SymbolTable struct {
@@ -23,7 +32,6 @@ func (st *SymbolTable) Lookup(name string) (VariableInfo, bool) {
 		return info, true
 	}
 
-	fmt.Println("Looking up in parent symbol table")
 	if st.Parent != nil {
 		return st.Parent.Lookup(name)
 	}
@@ -31,11 +39,17 @@ func (st *SymbolTable) Lookup(name string) (VariableInfo, bool) {
 }
 
 func (st *SymbolTable) Insert(name string, varType string) error {
-	if _, exists := st.symbols[name]; exists {
+	return st.Declare(VariableInfo{Name: name, Type: varType})
+}
+
+// Declare adds a name described by info to the table
+func (st *SymbolTable) Declare(info VariableInfo) error {
+	if _, exists := st.symbols[info.Name]; exists {
 
-		return fmt.Errorf("variable '%s' already declared in this scope", name)
+		return fmt.Errorf("variable '%s' already declared in this scope", info.Name)
 	}
-	st.symbols[name] = VariableInfo{Name: name, Type: varType, Index: len(st.symbols)}
+	info.Index = len(st.symbols)
+	st.symbols[info.Name] = info
 	return nil
 }
 
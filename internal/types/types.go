@@ -0,0 +1,538 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Any is the type used by builtin signatures that accept or return values of
+// any type. It is never written in Alna source code.
+const Any = "any"
+
+// Void is the return type of functions that do not produce a value. It is
+// only valid as a return type.
+const Void = "void"
+
+// Function is the name of function types. A function type is spelled
+// "fn(int, string) bool", and its Args hold the parameter types followed by
+// the return type.
+const Function = "fn"
+
+// Result is the name of result types. Result<T, E> holds either a value of
+// type T or an error of type E.
+const Result = "Result"
+
+// Tuple is the name of the types of the values a function with multiple
+// return values returns together. A tuple type is spelled "(int, bool)", and
+// its Args hold the type of each value.
+const Tuple = "tuple"
+
+// Optional is the name of optional types. An optional type is spelled "int?",
+// and holds either a value of its only Arg or none.
+const Optional = "optional"
+
+// None is the type of the none literal. It can be stored in any optional type.
+const None = "none"
+
+// Type is the structured form of a type name such as "int" or
+// "map<string, array<int>>".
+type Type struct {
+	Name string
+	Args []*Type
+}
+
+// NewFunction builds the function type with the given parameter and return
+// types
+func NewFunction(params []string, returnType string) string {
+	return fmt.Sprintf("%s(%s) %s", Function, strings.Join(params, ", "), returnType)
+}
+
+// NewTuple builds the tuple type of the given value types
+func NewTuple(elems []string) string {
+	return fmt.Sprintf("(%s)", strings.Join(elems, ", "))
+}
+
+// NewOptional builds the optional type of the given type
+func NewOptional(name string) string {
+	return name + "?"
+}
+
+// OptionalType returns the type held by an optional type
+func OptionalType(name string) (string, bool) {
+	t, err := Parse(name)
+	if err != nil || t.Name != Optional {
+		return "", false
+	}
+	return t.Args[0].String(), true
+}
+
+// TupleTypes returns the value types of a tuple type
+func TupleTypes(name string) ([]string, bool) {
+	t, err := Parse(name)
+	if err != nil || t.Name != Tuple {
+		return nil, false
+	}
+
+	elems := make([]string, len(t.Args))
+	for i, elem := range t.Args {
+		elems[i] = elem.String()
+	}
+	return elems, true
+}
+
+// IsFunction reports whether the type name is a function type
+func IsFunction(name string) bool {
+	t, err := Parse(name)
+	return err == nil && t.Name == Function
+}
+
+// ResultTypes returns the value and error types of a result type
+func ResultTypes(name string) (string, string, bool) {
+	t, err := Parse(name)
+	if err != nil || t.Name != Result || len(t.Args) != 2 {
+		return "", "", false
+	}
+	return t.Args[0].String(), t.Args[1].String(), true
+}
+
+// Signature returns the parameter and return types of a function type
+func Signature(name string) ([]string, string, bool) {
+	t, err := Parse(name)
+	if err != nil || t.Name != Function {
+		return nil, "", false
+	}
+
+	params := make([]string, len(t.Args)-1)
+	for i, param := range t.Args[:len(t.Args)-1] {
+		params[i] = param.String()
+	}
+	return params, t.Args[len(t.Args)-1].String(), true
+}
+
+// Parse converts a canonical type name, as produced by the parser, into a Type
+func Parse(name string) (*Type, error) {
+	t, rest, err := parse(strings.TrimSpace(name))
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("unexpected '%s' in type '%s'", rest, name)
+	}
+	return t, nil
+}
+
+// parse parses a type and the ? that makes it optional
+func parse(s string) (*Type, string, error) {
+	t, rest, err := parseBase(s)
+	if err != nil {
+		return nil, rest, err
+	}
+
+	rest = strings.TrimSpace(rest)
+	if !strings.HasPrefix(rest, "?") {
+		return t, rest, nil
+	}
+	return &Type{Name: Optional, Args: []*Type{t}}, strings.TrimSpace(rest[1:]), nil
+}
+
+func parseBase(s string) (*Type, string, error) {
+	if strings.HasPrefix(s, Function+"(") {
+		return parseFunction(s)
+	}
+	if strings.HasPrefix(s, "(") {
+		return parseTuple(s)
+	}
+
+	end := strings.IndexAny(s, "<>,()? ")
+	if end < 0 {
+		end = len(s)
+	}
+
+	name := strings.TrimSpace(s[:end])
+	if name == "" {
+		return nil, s, fmt.Errorf("missing type name in '%s'", s)
+	}
+
+	t := &Type{Name: name}
+	rest := strings.TrimSpace(s[end:])
+	if !strings.HasPrefix(rest, "<") {
+		return t, rest, nil
+	}
+
+	rest = rest[1:]
+	for {
+		arg, r, err := parse(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, r, err
+		}
+		t.Args = append(t.Args, arg)
+
+		r = strings.TrimSpace(r)
+		switch {
+		case strings.HasPrefix(r, ","):
+			rest = r[1:]
+		case strings.HasPrefix(r, ">"):
+			return t, strings.TrimSpace(r[1:]), nil
+		default:
+			return nil, r, fmt.Errorf("unterminated type arguments in '%s'", s)
+		}
+	}
+}
+
+func parseFunction(s string) (*Type, string, error) {
+	t := &Type{Name: Function}
+	rest := strings.TrimSpace(s[len(Function)+1:])
+
+	for !strings.HasPrefix(rest, ")") {
+		param, r, err := parse(rest)
+		if err != nil {
+			return nil, r, err
+		}
+		t.Args = append(t.Args, param)
+
+		rest = strings.TrimSpace(r)
+		switch {
+		case strings.HasPrefix(rest, ","):
+			rest = strings.TrimSpace(rest[1:])
+		case !strings.HasPrefix(rest, ")"):
+			return nil, rest, fmt.Errorf("unterminated parameter types in '%s'", s)
+		}
+	}
+
+	returnType, rest, err := parse(strings.TrimSpace(rest[1:]))
+	if err != nil {
+		return nil, rest, err
+	}
+	t.Args = append(t.Args, returnType)
+	return t, rest, nil
+}
+
+func parseTuple(s string) (*Type, string, error) {
+	t := &Type{Name: Tuple}
+	rest := strings.TrimSpace(s[1:])
+
+	for {
+		elem, r, err := parse(rest)
+		if err != nil {
+			return nil, r, err
+		}
+		t.Args = append(t.Args, elem)
+
+		rest = strings.TrimSpace(r)
+		switch {
+		case strings.HasPrefix(rest, ","):
+			rest = strings.TrimSpace(rest[1:])
+		case strings.HasPrefix(rest, ")"):
+			return t, strings.TrimSpace(rest[1:]), nil
+		default:
+			return nil, rest, fmt.Errorf("unterminated tuple type in '%s'", s)
+		}
+	}
+}
+
+// String returns the canonical spelling of the type
+func (t *Type) String() string {
+	if t.Name == Function {
+		params := make([]string, len(t.Args)-1)
+		for i, param := range t.Args[:len(t.Args)-1] {
+			params[i] = param.String()
+		}
+		return NewFunction(params, t.Args[len(t.Args)-1].String())
+	}
+
+	if t.Name == Optional {
+		return NewOptional(t.Args[0].String())
+	}
+
+	if t.Name == Tuple {
+		elems := make([]string, len(t.Args))
+		for i, elem := range t.Args {
+			elems[i] = elem.String()
+		}
+		return NewTuple(elems)
+	}
+
+	if len(t.Args) == 0 {
+		return t.Name
+	}
+
+	args := make([]string, len(t.Args))
+	for i, arg := range t.Args {
+		args[i] = arg.String()
+	}
+	return fmt.Sprintf("%s<%s>", t.Name, strings.Join(args, ", "))
+}
+
+// IsInteger reports whether the type name is one of the integer types
+func IsInteger(name string) bool {
+	switch name {
+	case "int", "i8", "i16", "i32", "i64":
+		return true
+	default:
+		return false
+	}
+}
+
+// Assignable reports whether a value of type from can be stored where a
+// value of type to is expected. Integer types are interchangeable because the
+// VM has a single integer representation. An optional type also accepts none
+// and values of the type it holds, but its values are not assignable to that
+// type without unwrapping them.
+func Assignable(to, from string) bool {
+	toType, err := Parse(to)
+	if err != nil {
+		return false
+	}
+	fromType, err := Parse(from)
+	if err != nil {
+		return false
+	}
+	return assignable(toType, fromType)
+}
+
+func assignable(to, from *Type) bool {
+	if to.Name == Any || from.Name == Any {
+		return true
+	}
+	if IsInteger(to.Name) && IsInteger(from.Name) {
+		return true
+	}
+	if to.Name == Optional && from.Name == None {
+		return true
+	}
+	if to.Name == Optional && from.Name != Optional {
+		return assignable(to.Args[0], from)
+	}
+	if to.Name != from.Name || len(to.Args) != len(from.Args) {
+		return false
+	}
+	for i := range to.Args {
+		if !assignable(to.Args[i], from.Args[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Unify returns the type that values of both a and b can be stored in, such as
+// the type of an if expression whose branches produce a and b. Where one side
+// is any, the other side's more specific type wins. None unifies with any type
+// into its optional type, and so does an optional type with the type it holds.
+func Unify(a, b string) (string, bool) {
+	aType, err := Parse(a)
+	if err != nil {
+		return "", false
+	}
+	bType, err := Parse(b)
+	if err != nil {
+		return "", false
+	}
+
+	unified, ok := unify(aType, bType)
+	if !ok {
+		return "", false
+	}
+	return unified.String(), true
+}
+
+func unify(a, b *Type) (*Type, bool) {
+	switch {
+	case a.Name == Any:
+		return b, true
+	case b.Name == Any:
+		return a, true
+	case a.Name == None && b.Name == None:
+		return a, true
+	case a.Name == None:
+		return optional(b), true
+	case b.Name == None:
+		return optional(a), true
+	case a.Name == Optional && b.Name != Optional:
+		return unifyOptional(a.Args[0], b)
+	case b.Name == Optional && a.Name != Optional:
+		return unifyOptional(b.Args[0], a)
+	case IsInteger(a.Name) && IsInteger(b.Name):
+		if a.Name == b.Name {
+			return a, true
+		}
+		return &Type{Name: "int"}, true
+	case a.Name != b.Name || len(a.Args) != len(b.Args):
+		return nil, false
+	}
+
+	unified := &Type{Name: a.Name}
+	for i := range a.Args {
+		arg, ok := unify(a.Args[i], b.Args[i])
+		if !ok {
+			return nil, false
+		}
+		unified.Args = append(unified.Args, arg)
+	}
+	return unified, true
+}
+
+// unifyOptional unifies the type held by an optional type with a type that is
+// not optional, into an optional type
+func unifyOptional(held, b *Type) (*Type, bool) {
+	unified, ok := unify(held, b)
+	if !ok {
+		return nil, false
+	}
+	return optional(unified), true
+}
+
+func optional(t *Type) *Type {
+	if t.Name == Optional {
+		return t
+	}
+	return &Type{Name: Optional, Args: []*Type{t}}
+}
+
+// Infer matches the type of an argument against the declared type of a
+// generic function's parameter, binding the type parameters that param
+// mentions in bindings. A type parameter that is already bound is unified
+// with the new type. It reports the type parameter that could not be unified
+// when the types do not match.
+func Infer(param, arg string, typeParams []string, bindings map[string]string) (string, bool) {
+	paramType, err := Parse(param)
+	if err != nil {
+		return "", false
+	}
+	argType, err := Parse(arg)
+	if err != nil {
+		return "", false
+	}
+	return infer(paramType, argType, typeParams, bindings)
+}
+
+func infer(param, arg *Type, typeParams []string, bindings map[string]string) (string, bool) {
+	if isTypeParam(param, typeParams) {
+		bound, isBound := bindings[param.Name]
+		if !isBound {
+			bindings[param.Name] = arg.String()
+			return "", true
+		}
+
+		unified, ok := Unify(bound, arg.String())
+		if !ok {
+			return param.Name, false
+		}
+		bindings[param.Name] = unified
+		return "", true
+	}
+
+	switch {
+	case arg.Name == Any:
+		return "", true
+	case param.Name == Optional && arg.Name == None:
+		return "", true
+	case param.Name == Optional && arg.Name != Optional:
+		return infer(param.Args[0], arg, typeParams, bindings)
+	case IsInteger(param.Name) && IsInteger(arg.Name):
+		return "", true
+	case param.Name != arg.Name || len(param.Args) != len(arg.Args):
+		return "", false
+	}
+
+	for i := range param.Args {
+		if name, ok := infer(param.Args[i], arg.Args[i], typeParams, bindings); !ok {
+			return name, false
+		}
+	}
+	return "", true
+}
+
+// Substitute replaces the type parameters in name with the types bound to
+// them
+func Substitute(name string, bindings map[string]string) string {
+	t, err := Parse(name)
+	if err != nil {
+		return name
+	}
+	return substitute(t, bindings).String()
+}
+
+func substitute(t *Type, bindings map[string]string) *Type {
+	if bound, isBound := bindings[t.Name]; isBound && len(t.Args) == 0 {
+		if boundType, err := Parse(bound); err == nil {
+			return boundType
+		}
+	}
+
+	substituted := &Type{Name: t.Name}
+	for _, arg := range t.Args {
+		substituted.Args = append(substituted.Args, substitute(arg, bindings))
+	}
+	return substituted
+}
+
+func isTypeParam(t *Type, typeParams []string) bool {
+	if len(t.Args) > 0 {
+		return false
+	}
+	for _, name := range typeParams {
+		if t.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Elem returns the element type of an array or the value type of a map
+func Elem(name string) (string, bool) {
+	t, err := Parse(name)
+	if err != nil {
+		return "", false
+	}
+	switch {
+	case t.Name == "array" && len(t.Args) == 1:
+		return t.Args[0].String(), true
+	case t.Name == "map" && len(t.Args) == 2:
+		return t.Args[1].String(), true
+	case t.Name == Any:
+		return Any, true
+	default:
+		return "", false
+	}
+}
+
+// Key returns the type used to index into a container type
+func Key(name string) (string, bool) {
+	t, err := Parse(name)
+	if err != nil {
+		return "", false
+	}
+	switch {
+	case t.Name == "array" && len(t.Args) == 1:
+		return "int", true
+	case t.Name == "map" && len(t.Args) == 2:
+		return t.Args[0].String(), true
+	case t.Name == Any:
+		return Any, true
+	default:
+		return "", false
+	}
+}
+
+// Generated returns the type of the values produced by a generator type,
+// gen<T>
+func Generated(name string) (string, bool) {
+	t, err := Parse(name)
+	if err != nil || t.Name != "gen" || len(t.Args) != 1 {
+		return "", false
+	}
+	return t.Args[0].String(), true
+}
+
+// Iterated returns the type of the values a for-in loop gets from an array
+// or a generator
+func Iterated(name string) (string, bool) {
+	if generated, isGenerator := Generated(name); isGenerator {
+		return generated, true
+	}
+	t, err := Parse(name)
+	if err != nil || t.Name != "array" || len(t.Args) != 1 {
+		return "", false
+	}
+	return t.Args[0].String(), true
+}
@@ -0,0 +1,75 @@
+package vm
+
+import (
+	"alna-lang/internal/builtins"
+	"math"
+	"strconv"
+)
+
+// Int arithmetic wraps around on overflow unless CheckOverflow is set.
+// Division truncates toward zero and the remainder has the sign of the
+// dividend, and both trap when dividing by zero.
+
+func add(vm *VM, op byte, left, right builtins.Value) builtins.Value {
+	if left.Kind == builtins.KindString && right.Kind == builtins.KindString {
+		vm.reserve(len(left.AsString())+len(right.AsString()), left, right)
+		concatenated := builtins.StringValue(left.AsString() + right.AsString())
+		vm.track(concatenated)
+		return concatenated
+	}
+	a, b := vm.asInt(left, op), vm.asInt(right, op)
+	sum := a + b
+	if vm.CheckOverflow && (a^sum)&(b^sum) < 0 {
+		vm.overflow(a, "+", b)
+	}
+	return builtins.IntValue(sum)
+}
+
+func sub(vm *VM, op byte, left, right builtins.Value) builtins.Value {
+	a, b := vm.asInt(left, op), vm.asInt(right, op)
+	difference := a - b
+	if vm.CheckOverflow && (a^b)&(a^difference) < 0 {
+		vm.overflow(a, "-", b)
+	}
+	return builtins.IntValue(difference)
+}
+
+func mul(vm *VM, op byte, left, right builtins.Value) builtins.Value {
+	a, b := vm.asInt(left, op), vm.asInt(right, op)
+	product := a * b
+	if vm.CheckOverflow && a != 0 && (product/a != b || (a == -1 && b == math.MinInt)) {
+		vm.overflow(a, "*", b)
+	}
+	return builtins.IntValue(product)
+}
+
+func div(vm *VM, op byte, left, right builtins.Value) builtins.Value {
+	a, b := vm.asInt(left, op), vm.asInt(right, op)
+	if b == 0 {
+		vm.raise(TrapDivisionByZero, "division by zero: %d / 0", a)
+	}
+	if vm.CheckOverflow && a == math.MinInt && b == -1 {
+		vm.overflow(a, "/", b)
+	}
+	return builtins.IntValue(a / b)
+}
+
+func mod(vm *VM, op byte, left, right builtins.Value) builtins.Value {
+	a, b := vm.asInt(left, op), vm.asInt(right, op)
+	if b == 0 {
+		vm.raise(TrapDivisionByZero, "division by zero: %d %% 0", a)
+	}
+	return builtins.IntValue(a % b)
+}
+
+func (vm *VM) overflow(a int, operator string, b int) {
+	vm.raise(TrapOverflow, "int overflow: %d %s %d", a, operator, b)
+}
+
+// quoted formats a value for an error message, quoting strings
+func quoted(value builtins.Value) string {
+	if value.Kind == builtins.KindString {
+		return strconv.Quote(value.AsString())
+	}
+	return value.String()
+}
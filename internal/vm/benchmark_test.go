@@ -0,0 +1,159 @@
+package vm
+
+import (
+	"alna-lang/internal/analyzer"
+	"alna-lang/internal/codegen"
+	"alna-lang/internal/lexer"
+	"alna-lang/internal/loader"
+	"alna-lang/internal/logger"
+	"alna-lang/internal/parser"
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The benchmark programs are arithmetic-heavy and print nothing, so they
+// measure the cost of executing instructions. Alna has no loops, so they
+// repeat their work through recursion.
+
+const fibProgram = `
+int fib(int n) {
+  if n < 2 {
+    return n
+  }
+  return fib(n - 1) + fib(n - 2)
+}
+
+int main() {
+  return fib(20)
+}
+`
+
+const arithmeticProgram = `
+int step(int n, int acc) {
+  if n == 0 {
+    return acc
+  }
+  int scaled = (acc / 7 + n * 3 - n / 2) * 2 - acc / 5
+  return step(n - 1, scaled)
+}
+
+int main() {
+  return step(2000, 1) + step(2000, 2) + step(2000, 3)
+}
+`
+
+const stringProgram = `
+include "strings"
+
+string pad(int n, string s) {
+  if n == 0 {
+    return s
+  }
+  string next = if stringLength(s) > 40 { "" } else { s + "ab" }
+  return pad(n - 1, next)
+}
+
+int main() {
+  string s = pad(3000, "")
+  return stringLength(s)
+}
+`
+
+func BenchmarkFib(b *testing.B) {
+	benchmarkProgram(b, fibProgram)
+}
+
+func BenchmarkArithmetic(b *testing.B) {
+	benchmarkProgram(b, arithmeticProgram)
+}
+
+func BenchmarkStrings(b *testing.B) {
+	benchmarkProgram(b, stringProgram)
+}
+
+// BenchmarkExamples runs every example program that compiles, with its
+// output discarded
+func BenchmarkExamples(b *testing.B) {
+	paths, err := filepath.Glob("../../examples/*.alna")
+	if err != nil {
+		b.Fatalf("Failed to list examples: %v", err)
+	}
+
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		b.Fatalf("Failed to open %s: %v", os.DevNull, err)
+	}
+	defer devNull.Close()
+	stdout := os.Stdout
+	os.Stdout = devNull
+	defer func() { os.Stdout = stdout }()
+
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			b.Fatalf("Failed to read %s: %v", path, err)
+		}
+		bytecode, sourceLines, err := compile(string(source), path)
+		if err != nil {
+			// Examples of compile errors have nothing to run
+			continue
+		}
+		b.Run(strings.TrimSuffix(filepath.Base(path), ".alna"), func(b *testing.B) {
+			runProgram(b, bytecode, sourceLines)
+		})
+	}
+}
+
+func benchmarkProgram(b *testing.B, source string) {
+	bytecode, sourceLines, err := compile(source, "bench.alna")
+	if err != nil {
+		b.Fatalf("Failed to compile program: %v", err)
+	}
+	runProgram(b, bytecode, sourceLines)
+}
+
+func runProgram(b *testing.B, bytecode []byte, sourceLines []string) {
+	lgr := logger.New(logger.LevelInfo, false)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		machine := NewVM(bytecode, sourceLines, false, lgr)
+		if err := machine.CheckHeader(); err != nil {
+			b.Fatalf("Invalid bytecode: %v", err)
+		}
+		// Examples may end in a runtime error on purpose, which is part of
+		// what they run
+		_ = machine.Run()
+	}
+}
+
+// compile turns an Alna program into bytecode the way the compiler does
+func compile(source string, path string) ([]byte, []string, error) {
+	lgr := logger.New(logger.LevelInfo, false)
+
+	tokens, sourceLines, err := lexer.NewLexer(*bufio.NewScanner(strings.NewReader(source))).Analyze()
+	if err != nil {
+		return nil, nil, err
+	}
+	tree, err := parser.NewParser(tokens, sourceLines, lgr).Parse()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	moduleLoader := loader.NewLoader(lgr)
+	if err := moduleLoader.Resolve(&tree, path); err != nil {
+		return nil, nil, err
+	}
+	semantic := analyzer.NewAnalyzer(&tree, sourceLines, lgr)
+	if err := semantic.Analyze(); err != nil {
+		return nil, nil, err
+	}
+
+	generator := codegen.NewCodeGenerator(tree, sourceLines, semantic.SymbolTable, lgr)
+	generator.SetSourceFiles(path, moduleLoader.FunctionFiles())
+	generator.Generate()
+	return generator.Bytecode, sourceLines, nil
+}
@@ -2,17 +2,25 @@ package vm
 
 import "alna-lang/internal/builtins"
 
-func (vm *VM) registerBuiltins() (map[string]builtins.Function, []FunctionDefinition) {
-	builtinFn := builtins.GetBuiltins()
+// registerBuiltins adds the builtins to the functions of the VM. Those
+// without an implementation of their own are the ones working on channels,
+// which the VM implements.
+func (vm *VM) registerBuiltins() []FunctionDefinition {
+	provided := vm.channelBuiltins()
 	var builtinList []FunctionDefinition
-	for name, fn := range builtinFn {
+	for _, builtin := range builtins.GetBuiltins() {
+		implementation := builtin.Implementation
+		if implementation == nil {
+			implementation = provided[builtin.Name]
+		}
 		builtinList = append(builtinList, FunctionDefinition{
-			Name:           name,
-			Implementation: fn,
+			Name:           builtin.Name,
+			Implementation: implementation,
+			Allocates:      builtin.Allocates,
 			Type:           FunctionTypeBuiltin,
 		})
 	}
 
 	vm.Functions = append(vm.Functions, builtinList...)
-	return builtinFn, builtinList
+	return builtinList
 }
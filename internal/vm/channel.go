@@ -0,0 +1,253 @@
+package vm
+
+import (
+	"alna-lang/internal/builtins"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// errClosedChannel is wrapped by the errors of sending on or closing a closed
+// channel
+var errClosedChannel = errors.New("closed channel")
+
+// Channel is the runtime representation of chan<T> values. Up to Capacity
+// values sent on it wait in its buffer until they are received, and sends
+// beyond that wait for a receiver. senders and receivers hold the tasks
+// blocked on the channel, in the order they blocked.
+type Channel struct {
+	Capacity  int
+	buffer    []builtins.Value
+	closed    bool
+	senders   []*waiter
+	receivers []*waiter
+}
+
+func (c *Channel) String() string {
+	return "<chan>"
+}
+
+// waiter is a send or receive a blocked task waits on. index is the case of
+// the select it belongs to, or -1 for calls to send and receive.
+type waiter struct {
+	task    *task
+	channel *Channel
+	value   builtins.Value
+	send    bool
+	index   int
+}
+
+func (c *Channel) enqueue(w *waiter) {
+	if w.send {
+		c.senders = append(c.senders, w)
+	} else {
+		c.receivers = append(c.receivers, w)
+	}
+}
+
+// cancel removes a waiter whose task no longer waits on the channel, as when
+// another case of its select completed
+func (c *Channel) cancel(w *waiter) {
+	c.senders = slices.DeleteFunc(c.senders, func(other *waiter) bool { return other == w })
+	c.receivers = slices.DeleteFunc(c.receivers, func(other *waiter) bool { return other == w })
+}
+
+// canSend reports whether a send would complete without waiting. Sends on a
+// closed channel complete by failing.
+func (c *Channel) canSend() bool {
+	return c.closed || len(c.receivers) > 0 || len(c.buffer) < c.Capacity
+}
+
+// canReceive reports whether a receive would complete without waiting
+func (c *Channel) canReceive() bool {
+	return c.closed || len(c.buffer) > 0 || len(c.senders) > 0
+}
+
+// send sends value on c, handing it to a waiting receiver or buffering it,
+// and reports whether it could do so without waiting
+func (vm *VM) send(c *Channel, value builtins.Value) (bool, error) {
+	switch {
+	case c.closed:
+		return false, fmt.Errorf("cannot send on a %w", errClosedChannel)
+	case len(c.receivers) > 0:
+		receiver := c.receivers[0]
+		c.receivers = c.receivers[1:]
+		vm.wake(receiver, value)
+	case len(c.buffer) < c.Capacity:
+		c.buffer = append(c.buffer, value)
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// receive receives a value from c, taking it from its buffer or a waiting
+// sender, and reports whether it could do so without waiting. A closed
+// channel whose buffer is empty gives none.
+func (vm *VM) receive(c *Channel) (builtins.Value, bool) {
+	switch {
+	case len(c.buffer) > 0:
+		value := c.buffer[0]
+		c.buffer = c.buffer[1:]
+		// A sender waiting for room takes the place freed in the buffer
+		if len(c.senders) > 0 {
+			sender := c.senders[0]
+			c.senders = c.senders[1:]
+			c.buffer = append(c.buffer, sender.value)
+			vm.wake(sender, builtins.Nil)
+		}
+		return value, true
+	case len(c.senders) > 0:
+		sender := c.senders[0]
+		c.senders = c.senders[1:]
+		vm.wake(sender, builtins.Nil)
+		return sender.value, true
+	case c.closed:
+		return builtins.None, true
+	default:
+		return builtins.Nil, false
+	}
+}
+
+// close closes c. Its waiting receivers get none, and its waiting senders
+// fail once they resume.
+func (vm *VM) close(c *Channel) error {
+	if c.closed {
+		return fmt.Errorf("cannot close a %w", errClosedChannel)
+	}
+	c.closed = true
+	for _, receiver := range c.receivers {
+		vm.wake(receiver, builtins.None)
+	}
+	for _, sender := range c.senders {
+		sender.task.failure = &trapError{trap: TrapClosedChannel, message: "cannot send on a closed channel"}
+		vm.wake(sender, builtins.Nil)
+	}
+	c.receivers, c.senders = nil, nil
+	return nil
+}
+
+// wake completes the operation w of a blocked task, pushing its result onto
+// the task's stack, and makes the task ready. A receive results in the value
+// received and a send in nil, while a select results in the value, none for
+// a send, and the index of the case.
+func (vm *VM) wake(w *waiter, value builtins.Value) {
+	t := w.task
+	for _, other := range t.waits {
+		if other != w {
+			other.channel.cancel(other)
+		}
+	}
+	t.waits = nil
+
+	if w.index >= 0 {
+		if value.Kind == builtins.KindNil {
+			value = builtins.None
+		}
+		t.stack = append(t.stack, value, builtins.IntValue(w.index))
+	} else {
+		t.stack = append(t.stack, value)
+	}
+	vm.ready = append(vm.ready, t)
+}
+
+// blockedError is returned by the builtins implemented by the VM when the
+// task calling them has to wait. CALL_BUILTIN blocks the task instead of
+// failing, so it only surfaces from calls that cannot wait.
+type blockedError struct {
+	waits []*waiter
+}
+
+func (e blockedError) Error() string {
+	return "cannot wait on a channel in a deferred call"
+}
+
+// channelBuiltins returns the implementations of the builtins working on
+// channels, which need the task calling them
+func (vm *VM) channelBuiltins() map[string]builtins.Function {
+	return map[string]builtins.Function{
+		"channel": func(args ...builtins.Value) (builtins.Value, error) {
+			capacity := args[0].AsInt()
+			if capacity < 0 {
+				return builtins.Nil, fmt.Errorf("channel capacity cannot be negative, got %d", capacity)
+			}
+			return builtins.ObjectValue(&Channel{Capacity: capacity}), nil
+		},
+		"send": func(args ...builtins.Value) (builtins.Value, error) {
+			c := asChannel(args[0])
+			sent, err := vm.send(c, args[1])
+			if err != nil || sent {
+				return builtins.Nil, err
+			}
+			return builtins.Nil, blockedError{waits: []*waiter{{task: vm.current, channel: c, value: args[1], send: true, index: -1}}}
+		},
+		"receive": func(args ...builtins.Value) (builtins.Value, error) {
+			c := asChannel(args[0])
+			if value, received := vm.receive(c); received {
+				return value, nil
+			}
+			return builtins.Nil, blockedError{waits: []*waiter{{task: vm.current, channel: c, index: -1}}}
+		},
+		"close": func(args ...builtins.Value) (builtins.Value, error) {
+			return builtins.Nil, vm.close(asChannel(args[0]))
+		},
+	}
+}
+
+func asChannel(value builtins.Value) *Channel {
+	c, _ := value.Object().(*Channel)
+	return c
+}
+
+// selectCases executes a SELECT of count cases, whose channels, followed by
+// the value to send for the cases set in sends, are on the stack. The first
+// case that can complete does, or a random one of them when Seed is set, and
+// its result and index are pushed. Without one, a select with an else
+// pushes none and count, and one without blocks on all of its cases.
+func (vm *VM) selectCases(count int, sends int, hasElse bool) {
+	waits := make([]*waiter, count)
+	for i := count - 1; i >= 0; i-- {
+		w := &waiter{task: vm.current, index: i, send: sends&(1<<i) != 0}
+		if w.send {
+			w.value = vm.popValue()
+		}
+		c, isChannel := vm.popValue().Object().(*Channel)
+		if !isChannel {
+			vm.trap("SELECT expects channels")
+		}
+		w.channel = c
+		waits[i] = w
+	}
+
+	var ready []*waiter
+	for _, w := range waits {
+		if (w.send && w.channel.canSend()) || (!w.send && w.channel.canReceive()) {
+			ready = append(ready, w)
+		}
+	}
+
+	if len(ready) == 0 {
+		if hasElse {
+			vm.pushStack(builtins.None)
+			vm.pushStack(builtins.IntValue(count))
+			return
+		}
+		vm.block(waits)
+		return
+	}
+
+	chosen := ready[0]
+	if vm.random != nil {
+		chosen = ready[vm.random.IntN(len(ready))]
+	}
+	value := builtins.None
+	if chosen.send {
+		if _, err := vm.send(chosen.channel, chosen.value); err != nil {
+			vm.raise(TrapClosedChannel, "%v", err)
+		}
+	} else {
+		value, _ = vm.receive(chosen.channel)
+	}
+	vm.pushStack(value)
+	vm.pushStack(builtins.IntValue(chosen.index))
+}
@@ -0,0 +1,24 @@
+package vm
+
+import (
+	"alna-lang/internal/builtins"
+	"fmt"
+)
+
+// Cell holds a variable captured by a closure. The declaring function and
+// every closure capturing the variable share the cell, so assignments are
+// visible to all of them and the variable outlives the declaring scope.
+type Cell struct {
+	Value builtins.Value
+}
+
+// Closure is the runtime representation of function values: the address of
+// the function's code and the cells of the variables it captured
+type Closure struct {
+	Address  int
+	Upvalues []*Cell
+}
+
+func (c *Closure) String() string {
+	return fmt.Sprintf("<fn@%04d>", c.Address)
+}
@@ -0,0 +1,27 @@
+package vm
+
+import "testing"
+
+// TestReusedSlotIsNotCaptured declares variables in the slots freed by a
+// block whose variable was captured, which must hold plain values again
+func TestReusedSlotIsNotCaptured(t *testing.T) {
+	source := `
+int main() {
+  if true {
+    int a = 5
+    fn() int f = fn() int { return a }
+    print(f())
+  }
+  int b = 7
+  int c = 8
+  print(b + c)
+  return 0
+}`
+	bytecode, sourceLines, err := compile(source, "test.alna")
+	if err != nil {
+		t.Fatalf("Failed to compile program: %v", err)
+	}
+	if output := captureOutput(t, bytecode, sourceLines, nil); output != "5\n15\n" {
+		t.Errorf("Expected output:\n5\n15\ngot:\n%s", output)
+	}
+}
@@ -0,0 +1,91 @@
+package vm
+
+import "alna-lang/internal/builtins"
+
+// deferredCall is a call made by a defer statement when its function
+// returns. Its function and arguments were evaluated by the statement. A call
+// to a builtin has no closure.
+type deferredCall struct {
+	closure *Closure
+	builtin *FunctionDefinition
+	args    []builtins.Value
+	// running is set once RUN_DEFERRED has entered the call, and
+	// stackHeight is the height the stack returns to when it is done
+	running     bool
+	stackHeight int
+}
+
+// runNextDeferred executes a RUN_DEFERRED instruction. Deferred calls are made
+// last first, one at a time: each call returns to the instruction, which
+// discards the values it returned and makes the next one. The instruction
+// falls through to the RETURN after it once none are left.
+func (vm *VM) runNextDeferred() error {
+	if last := len(vm.frame.deferred) - 1; last >= 0 && vm.frame.deferred[last].running {
+		vm.stack = vm.stack[:vm.frame.deferred[last].stackHeight]
+		vm.frame.deferred = vm.frame.deferred[:last]
+	}
+
+	for len(vm.frame.deferred) > 0 {
+		last := len(vm.frame.deferred) - 1
+		call := vm.frame.deferred[last]
+		if call.builtin == nil {
+			vm.frame.deferred[last].running = true
+			vm.frame.deferred[last].stackHeight = len(vm.stack)
+			vm.stack = append(vm.stack, call.args...)
+			vm.Pc = vm.instructionPc
+			vm.enterFunction(call.closure.Address+vm.PcOffset, call.closure, len(call.args))
+			vm.logger.Debug("RUN_DEFERRED calling %s", call.closure)
+			return nil
+		}
+
+		vm.frame.deferred = vm.frame.deferred[:last]
+		vm.logger.Debug("RUN_DEFERRED calling %s", call.builtin.Name)
+		if _, err := call.builtin.Implementation(call.args...); err != nil {
+			return vm.builtinError(err)
+		}
+	}
+	return nil
+}
+
+// unwind leaves the active frames after a runtime error until depth frames
+// remain, making the deferred calls of each frame it leaves
+func (vm *VM) unwind(depth int) {
+	for len(vm.frames) > depth {
+		vm.runDeferredCalls()
+		vm.stack = vm.stack[:vm.frame.StackBase]
+		vm.leaveFrame()
+	}
+}
+
+// runDeferredCalls makes the deferred calls of the current frame that have
+// not been made yet, running each to completion. A call that fails is
+// abandoned, unwinding the frames it entered, and the others are still made.
+func (vm *VM) runDeferredCalls() {
+	for len(vm.frame.deferred) > 0 {
+		last := len(vm.frame.deferred) - 1
+		call := vm.frame.deferred[last]
+		vm.frame.deferred = vm.frame.deferred[:last]
+
+		// A call that was running failed, which is what is being unwound
+		if call.running {
+			continue
+		}
+
+		if call.builtin != nil {
+			call.builtin.Implementation(call.args...)
+			continue
+		}
+
+		height, depth := len(vm.stack), len(vm.frames)
+		vm.stack = append(vm.stack, call.args...)
+		vm.enterFunction(call.closure.Address+vm.PcOffset, call.closure, len(call.args))
+		for len(vm.frames) > depth {
+			if err := vm.Step(); err != nil {
+				vm.logger.Debug("Deferred call %s failed: %v", call.closure, err)
+				vm.unwind(depth)
+				break
+			}
+		}
+		vm.stack = vm.stack[:height]
+	}
+}
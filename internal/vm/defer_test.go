@@ -0,0 +1,149 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+)
+
+const deferLog = `
+void log(string message) {
+  printString(message)
+}
+
+int boom(int x) {
+  return 10 / x
+}
+`
+
+func TestDeferredCalls(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{"last first", `
+int main() {
+  defer log("one")
+  defer log("two")
+  defer log("three")
+  log("body")
+  return 0
+}`, "body\nthree\ntwo\none\n"},
+		{"early return", `
+int check(n: int) {
+  defer log("checked {n}")
+  if n > 2 {
+    defer log("big")
+    return 1
+  }
+  log("small")
+  return 0
+}
+
+int main() {
+  print(check(5))
+  print(check(1))
+  return 0
+}`, "big\nchecked 5\n1\nsmall\nchecked 1\n0\n"},
+		{"arguments are evaluated at the defer", `
+int main() {
+  mut int steps = 1
+  defer print(steps)
+  steps = 3
+  print(steps)
+  return 0
+}`, "3\n1\n"},
+		{"in a loop", `
+void visit(i: int) {
+  defer log("left {i}")
+  log("entered {i}")
+}
+
+int main() {
+  for i in range(0, 2) {
+    visit(i)
+  }
+  return 0
+}`, "entered 0\nleft 0\nentered 1\nleft 1\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bytecode, sourceLines, err := compile(deferLog+tt.source, "test.alna")
+			if err != nil {
+				t.Fatalf("Failed to compile program: %v", err)
+			}
+
+			output := captureOutput(t, bytecode, sourceLines, nil)
+			if output != tt.expected {
+				t.Errorf("Expected output:\n%s\ngot:\n%s", tt.expected, output)
+			}
+		})
+	}
+}
+
+// TestDeferredCallsOnRuntimeError checks that a runtime error runs the
+// deferred calls of every active function before the program stops, also
+// when the error is raised by a deferred call
+func TestDeferredCallsOnRuntimeError(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		output  string
+		message string
+		trace   []string
+	}{
+		{"unwinding", `
+int inner() {
+  defer log("inner")
+  return boom(0)
+}
+
+int main() {
+  defer log("main")
+  print(inner())
+  return 0
+}`, "inner\nmain\n", "division by zero: 10 / 0", []string{"boom", "inner", "main"}},
+		{"failing deferred call", `
+int inner() {
+  defer log("inner")
+  defer boom(0)
+  defer log("before")
+  return 1
+}
+
+int main() {
+  defer log("main")
+  print(inner())
+  return 0
+}`, "before\ninner\nmain\n", "division by zero: 10 / 0", []string{"boom", "inner", "main"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bytecode, sourceLines, err := compile(deferLog+tt.source, "test.alna")
+			if err != nil {
+				t.Fatalf("Failed to compile program: %v", err)
+			}
+
+			output := captureOutput(t, bytecode, sourceLines, nil)
+			if !strings.HasPrefix(output, tt.output) {
+				t.Errorf("Expected the deferred calls to print:\n%s\ngot:\n%s", tt.output, output)
+			}
+
+			failure := strings.TrimPrefix(output, tt.output)
+			if !strings.Contains(failure, tt.message) {
+				t.Errorf("Expected the error %q, got:\n%s", tt.message, failure)
+			}
+			// The trace goes from the failing call out to main
+			for _, function := range tt.trace {
+				_, rest, found := strings.Cut(failure, "  at "+function+" (")
+				if !found {
+					t.Errorf("Expected the trace %v, got:\n%s", tt.trace, output)
+					break
+				}
+				failure = rest
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package vm
+
+import "slices"
+
+// Frame is a function call being executed. The first frame of the main task
+// runs the top-level code of the program and is never left, while that of
+// another task runs the function it was spawned with. Addresses are
+// positions in the program, like Pc.
+type Frame struct {
+	// Function is the address of the called function's code
+	Function int
+	// ReturnPc is the address execution continues at when the call returns.
+	// The first frame returns to the end of the program.
+	ReturnPc int
+	// BasePointer is the index of the frame's first variable, and StackBase
+	// that of its first operand, which are its arguments when it starts
+	BasePointer int
+	StackBase   int
+	ArgCount    int
+	// ScopeMarks holds, for every scope open in the frame, the number of
+	// variables to keep when it ends. It is filled in by Frames: while the
+	// frame runs, its marks are the ones of the VM from scopeBase on.
+	ScopeMarks []int
+	scopeBase  int
+	// closure is the closure being called, if the function is one, and
+	// deferred the calls deferred by the frame, in the order they were made
+	closure  *Closure
+	deferred []deferredCall
+	// generator is the generator the frame runs, when NEXT resumed one, and
+	// exhaustedPc the address the loop continues at once it returns
+	generator   *Generator
+	exhaustedPc int
+	// tailCallPc is the address of the tail call that last replaced the
+	// frame's function, when tailCalled is set
+	tailCalled bool
+	tailCallPc int
+}
+
+// Frames returns the active calls, from the top-level code to the function
+// being executed
+func (vm *VM) Frames() []Frame {
+	frames := slices.Clone(vm.frames)
+	for i := range frames {
+		end := len(vm.scopeMarks)
+		if i+1 < len(frames) {
+			end = frames[i+1].scopeBase
+		}
+		frames[i].ScopeMarks = slices.Clone(vm.scopeMarks[frames[i].scopeBase:end])
+	}
+	return frames
+}
+
+// enterFirstFrame starts the frame the top-level code runs in
+func (vm *VM) enterFirstFrame() {
+	vm.frames = append(vm.frames[:0], Frame{Function: vm.Pc, ReturnPc: len(vm.program)})
+	vm.scopeMarks = vm.scopeMarks[:0]
+	vm.frame = &vm.frames[0]
+}
+
+// enterFunction calls the function at address, which is a closure's code
+// when closure is set. The argCount arguments on top of the stack are the
+// first operands of the new frame.
+func (vm *VM) enterFunction(address int, closure *Closure, argCount int) {
+	vm.checkCallDepth()
+	vm.frames = append(vm.frames, Frame{
+		Function:    address,
+		ReturnPc:    vm.Pc,
+		BasePointer: len(vm.Variables),
+		StackBase:   len(vm.stack) - argCount,
+		ArgCount:    argCount,
+		scopeBase:   len(vm.scopeMarks),
+		closure:     closure,
+	})
+	vm.frame = &vm.frames[len(vm.frames)-1]
+	vm.Pc = address
+}
+
+// replaceFunction calls the function at address in place of the current
+// one, which the compiler only does when nothing is left for it to do but
+// return the callee's values. The frame is reused: the current function's
+// variables, scopes and operands are dropped, and the argCount arguments on
+// top of the stack become the first operands of the callee.
+func (vm *VM) replaceFunction(address int, argCount int) {
+	frame := vm.frame
+	args := vm.stack[len(vm.stack)-argCount:]
+	vm.stack = append(vm.stack[:frame.StackBase], args...)
+	vm.Variables = vm.Variables[:frame.BasePointer]
+	vm.scopeMarks = vm.scopeMarks[:frame.scopeBase]
+	frame.Function = address
+	frame.ArgCount = argCount
+	frame.closure = nil
+	frame.tailCalled, frame.tailCallPc = true, vm.instructionPc
+	vm.Pc = address
+}
+
+// leaveFrame drops the current frame and continues at its return address.
+// The values returned, if any, are left on the stack by the caller of
+// leaveFrame.
+func (vm *VM) leaveFrame() {
+	vm.Variables = vm.Variables[:vm.frame.BasePointer]
+	vm.scopeMarks = vm.scopeMarks[:vm.frame.scopeBase]
+	vm.Pc = vm.frame.ReturnPc
+	vm.frames = vm.frames[:len(vm.frames)-1]
+	vm.frame = &vm.frames[len(vm.frames)-1]
+}
+
+// openScope records the variables to keep when the scope being opened ends
+func (vm *VM) openScope(variables int) {
+	vm.scopeMarks = append(vm.scopeMarks, variables)
+}
+
+// closeScope drops the variables declared in the innermost open scope
+func (vm *VM) closeScope() {
+	last := len(vm.scopeMarks) - 1
+	if last < vm.frame.scopeBase {
+		vm.trap("END_SCOPE without an open scope")
+	}
+	vm.Variables = vm.Variables[:vm.scopeMarks[last]]
+	vm.scopeMarks = vm.scopeMarks[:last]
+}
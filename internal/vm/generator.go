@@ -0,0 +1,124 @@
+package vm
+
+import (
+	"alna-lang/internal/builtins"
+	"slices"
+)
+
+// Generator is the runtime representation of the gen<T> values made by
+// calling a function that yields. While it is suspended, it holds the state
+// of the function's frame: the address it continues at, its variables, the
+// marks of its open scopes relative to its first variable, its operands and
+// its deferred calls. NEXT gives them back to a new frame to resume it.
+type Generator struct {
+	function   int
+	pc         int
+	closure    *Closure
+	variables  []builtins.Value
+	scopeMarks []int
+	stack      []builtins.Value
+	deferred   []deferredCall
+	// running is set while a frame runs the generator, and done once its
+	// function has returned
+	running bool
+	done    bool
+}
+
+func (g *Generator) String() string {
+	return "<gen>"
+}
+
+// arrayIterator is the iterator ITER makes for a loop over an array, which
+// is at the element of index next
+type arrayIterator struct {
+	array *builtins.Array
+	next  int
+}
+
+// suspend stores the state of the current frame into g, which continues at
+// pc once it is resumed, and drops the operands of the frame. Its variables
+// and scopes are dropped by the frame's return.
+func (vm *VM) suspend(g *Generator, pc int) {
+	frame := vm.frame
+	g.function, g.pc, g.closure = frame.Function, pc, frame.closure
+	g.variables = slices.Clone(vm.Variables[frame.BasePointer:])
+	g.scopeMarks = make([]int, 0, len(vm.scopeMarks)-frame.scopeBase)
+	for _, mark := range vm.scopeMarks[frame.scopeBase:] {
+		g.scopeMarks = append(g.scopeMarks, mark-frame.BasePointer)
+	}
+	g.stack = slices.Clone(vm.stack[frame.StackBase:])
+	g.deferred, frame.deferred = frame.deferred, nil
+	g.running = false
+	vm.stack = vm.stack[:frame.StackBase]
+}
+
+// resumeGenerator continues g in a new frame, which returns to the
+// instruction after the NEXT resuming it when g yields, and to exhausted
+// when its function returns
+func (vm *VM) resumeGenerator(g *Generator, exhausted int) {
+	if g.running {
+		vm.raise(TrapGeneratorRunning, "cannot resume a generator from its own body")
+	}
+	vm.checkCallDepth()
+	vm.frames = append(vm.frames, Frame{
+		Function:    g.function,
+		ReturnPc:    vm.Pc,
+		BasePointer: len(vm.Variables),
+		StackBase:   len(vm.stack),
+		scopeBase:   len(vm.scopeMarks),
+		closure:     g.closure,
+		deferred:    g.deferred,
+		generator:   g,
+		exhaustedPc: exhausted,
+	})
+	vm.frame = &vm.frames[len(vm.frames)-1]
+	vm.Variables = append(vm.Variables, g.variables...)
+	for _, mark := range g.scopeMarks {
+		vm.scopeMarks = append(vm.scopeMarks, vm.frame.BasePointer+mark)
+	}
+	vm.stack = append(vm.stack, g.stack...)
+	vm.Pc = g.pc
+
+	g.running = true
+	g.variables, g.scopeMarks, g.stack, g.deferred = nil, nil, nil, nil
+}
+
+// finishGenerator leaves the frame of g, whose function has returned, for
+// the address its loop continues at. The values returned are dropped.
+func (vm *VM) finishGenerator(g *Generator) {
+	g.running, g.done = false, true
+	exhausted := vm.frame.exhaustedPc
+	vm.stack = vm.stack[:vm.frame.StackBase]
+	vm.leaveFrame()
+	vm.Pc = exhausted
+}
+
+// nextValue pushes the next value of an iterator, or jumps to exhausted
+// when it has none left. A generator is resumed to produce its value, so
+// the instructions after NEXT run once it yields.
+func (vm *VM) nextValue(iterator builtins.Value, exhausted int) {
+	switch it := iterator.Object().(type) {
+	case *Generator:
+		if it.done {
+			vm.Pc = exhausted
+			return
+		}
+		vm.resumeGenerator(it, exhausted)
+	case *builtins.Range:
+		if it.Next >= it.End {
+			vm.Pc = exhausted
+			return
+		}
+		vm.pushStack(builtins.IntValue(it.Next))
+		it.Next++
+	case *arrayIterator:
+		if it.next >= len(it.array.Elements) {
+			vm.Pc = exhausted
+			return
+		}
+		vm.pushStack(it.array.Elements[it.next])
+		it.next++
+	default:
+		vm.trap("NEXT expects an iterator, got %v", iterator)
+	}
+}
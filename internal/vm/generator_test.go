@@ -0,0 +1,170 @@
+package vm
+
+import "testing"
+
+func TestGenerators(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{"countdown", `
+gen<int> countdown(n: int) {
+  if n > 0 {
+    yield n
+    for rest in countdown(n - 1) {
+      yield rest
+    }
+  }
+}
+
+int main() {
+  for n in countdown(3) {
+    print(n)
+  }
+  return 0
+}`, "3\n2\n1\n"},
+		{"range and arrays", `
+int main() {
+  for i in range(1, 4) {
+    print(i)
+  }
+  for word in ["a", "b"] {
+    printString(word)
+  }
+  return 0
+}`, "1\n2\n3\na\nb\n"},
+		{"composition", `
+gen<int> squares(xs: gen<int>) {
+  for x in xs {
+    yield x * x
+  }
+}
+
+gen<T> take<T>(xs: gen<T>, n: int) {
+  mut int left = n
+  for x in xs {
+    if left == 0 {
+      return
+    }
+    left = left - 1
+    yield x
+  }
+}
+
+int main() {
+  for n in take(squares(range(1, 1000000)), 3) {
+    print(n)
+  }
+  return 0
+}`, "1\n4\n9\n"},
+		{"shared generator", `
+int main() {
+  gen<int> numbers = range(0, 4)
+  for a in numbers {
+    for b in numbers {
+      printString("{a} {b}")
+    }
+  }
+  return 0
+}`, "0 1\n0 2\n0 3\n"},
+		{"closure", `
+int main() {
+  mut int calls = 0
+  counter := fn() -> gen<int> {
+    calls = calls + 1
+    yield calls
+    yield calls * 10
+  }
+  for n in counter() {
+    print(n)
+  }
+  print(calls)
+  return 0
+}`, "1\n10\n1\n"},
+		{"defer", `
+gen<string> lines() {
+  defer printString("closed")
+  yield "first"
+  yield "second"
+}
+
+int main() {
+  for line in lines() {
+    printString(line)
+  }
+  return 0
+}`, "first\nsecond\nclosed\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bytecode, sourceLines, err := compile(tt.source, "test.alna")
+			if err != nil {
+				t.Fatalf("Failed to compile program: %v", err)
+			}
+			if output := captureOutput(t, bytecode, sourceLines, nil); output != tt.expected {
+				t.Errorf("Expected output:\n%s\ngot:\n%s", tt.expected, output)
+			}
+			stressed := captureOutput(t, bytecode, sourceLines, func(vm *VM) { vm.GCStress = true })
+			if stressed != tt.expected {
+				t.Errorf("Expected output under GC stress:\n%s\ngot:\n%s", tt.expected, stressed)
+			}
+		})
+	}
+}
+
+func TestGeneratorTraps(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		trap    Trap
+		message string
+	}{
+		{"resumed from its own body", `
+mut gen<int> numbers = range(0, 0)
+
+gen<int> again() {
+  for n in numbers {
+    yield n
+  }
+  yield 1
+}
+
+int main() {
+  numbers = again()
+  for n in numbers {
+    print(n)
+  }
+  return 0
+}`, TrapGeneratorRunning, "cannot resume a generator from its own body"},
+		{"error in generator", `
+gen<int> ratios(xs: array<int>) {
+  for x in xs {
+    yield 100 / x
+  }
+}
+
+int main() {
+  for r in ratios([5, 0]) {
+    print(r)
+  }
+  return 0
+}`, TrapDivisionByZero, "division by zero: 100 / 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runtimeErr := runFailing(t, tt.source, nil)
+			if runtimeErr.Trap != tt.trap {
+				t.Errorf("Expected a %s trap, got %s", tt.trap, runtimeErr.Trap)
+			}
+			if runtimeErr.Message != tt.message {
+				t.Errorf("Expected message %q, got %q", tt.message, runtimeErr.Message)
+			}
+			if len(runtimeErr.Trace) < 2 || runtimeErr.Trace[len(runtimeErr.Trace)-1].Function != "main" {
+				t.Errorf("Expected the trace to run from the generator back to main, got %v", runtimeErr.Trace)
+			}
+		})
+	}
+}
@@ -0,0 +1,345 @@
+package vm
+
+import (
+	"alna-lang/internal/builtins"
+	"fmt"
+	"unsafe"
+)
+
+// minCollectBytes is the size the heap grows to before it is first collected
+const minCollectBytes = 256 << 10
+
+// valueSize is the size of a Value held in an array, a map or a cell
+const valueSize = int(unsafe.Sizeof(builtins.Value{}))
+
+// heap tracks the strings and objects a program allocates, so that its
+// memory use can be measured and bounded. Go's collector owns the memory
+// itself: collecting the heap marks what the program can still reach from
+// its roots and stops tracking the rest, which Go then frees once nothing
+// else refers to it. Objects are tracked by identity, and strings by their
+// bytes.
+type heap struct {
+	sizes map[any]int
+	// bytes is the size of the tracked objects, and nextCollect the size at
+	// which the heap is collected next
+	bytes       int
+	nextCollect int
+	allocated   int
+	collections int
+}
+
+// HeapStats describes the heap of a program. Objects and Bytes count the
+// strings and objects alive after the last collection and allocated since,
+// while Allocated and Freed count all of them since the program started.
+type HeapStats struct {
+	Objects     int
+	Bytes       int
+	Allocated   int
+	Freed       int
+	Collections int
+}
+
+func (s HeapStats) String() string {
+	return fmt.Sprintf("%d objects (%s) live, %d allocated, %d freed, %d collections",
+		s.Objects, formatBytes(s.Bytes), s.Allocated, s.Freed, s.Collections)
+}
+
+// HeapStats returns the statistics of the program's heap
+func (vm *VM) HeapStats() HeapStats {
+	return HeapStats{
+		Objects:     len(vm.heap.sizes),
+		Bytes:       vm.heap.bytes,
+		Allocated:   vm.heap.allocated,
+		Freed:       vm.heap.allocated - len(vm.heap.sizes),
+		Collections: vm.heap.collections,
+	}
+}
+
+// track starts tracking a string or object allocated by an instruction
+func (vm *VM) track(value builtins.Value) {
+	if vm.register(value) {
+		vm.allocated(value)
+	}
+}
+
+// trackCall accounts for the result of a builtin and for the arguments it
+// may have grown in place, as arrayPush and mapSet do
+func (vm *VM) trackCall(args []builtins.Value, result builtins.Value) {
+	grown := false
+	for _, arg := range args {
+		if arg.Kind == builtins.KindObject && vm.remeasure(arg) {
+			grown = true
+		}
+	}
+	if vm.register(result) || grown {
+		vm.allocated(append(args, result)...)
+	}
+}
+
+// register starts tracking a string or object, and reports whether it was
+// not tracked yet. Values that hold nothing on the heap are ignored.
+func (vm *VM) register(value builtins.Value) bool {
+	key := heapKey(value)
+	if key == nil {
+		return false
+	}
+	if _, tracked := vm.heap.sizes[key]; tracked {
+		return false
+	}
+	if vm.heap.sizes == nil {
+		vm.heap.sizes = make(map[any]int)
+		vm.heap.nextCollect = minCollectBytes
+	}
+	size := sizeOf(value)
+	vm.heap.sizes[key] = size
+	vm.heap.bytes += size
+	vm.heap.allocated++
+	return true
+}
+
+// remeasure updates the size of a tracked object, and reports whether it
+// grew
+func (vm *VM) remeasure(value builtins.Value) bool {
+	key := heapKey(value)
+	size, tracked := vm.heap.sizes[key]
+	if !tracked {
+		return false
+	}
+	newSize := sizeOf(value)
+	vm.heap.sizes[key] = newSize
+	vm.heap.bytes += newSize - size
+	return newSize > size
+}
+
+// allocated collects the heap once it has grown enough, or on every
+// allocation in stress mode, and then enforces the heap limit. pinned holds
+// what was just allocated, which may not be reachable from the roots yet.
+func (vm *VM) allocated(pinned ...builtins.Value) {
+	max := vm.Limits.MaxHeapBytes
+	if vm.GCStress || vm.heap.bytes >= vm.heap.nextCollect || (max > 0 && vm.heap.bytes > max) {
+		vm.collect(pinned...)
+	}
+	if max > 0 && vm.heap.bytes > max {
+		vm.raise(TrapHeapLimit, "heap limit of %d bytes exceeded", max)
+	}
+}
+
+// reserve enforces the heap limit on size bytes about to be allocated,
+// before they are: a program cannot get around the limit with a single
+// allocation much larger than it. The heap is collected first when they
+// would exceed it. pinned holds values in use that may not be reachable
+// from the roots, such as the operands of the allocation.
+func (vm *VM) reserve(size int, pinned ...builtins.Value) {
+	max := vm.Limits.MaxHeapBytes
+	if max <= 0 || vm.heap.bytes+size <= max {
+		return
+	}
+	vm.collect(pinned...)
+	if vm.heap.bytes+size > max {
+		vm.raise(TrapHeapLimit, "heap limit of %d bytes exceeded", max)
+	}
+}
+
+// collect stops tracking the strings and objects that cannot be reached
+// from the roots: the operand stack, the variables, the globals and the
+// closures, deferred calls and generators of every frame, of the task
+// running and of those waiting, along with the values blocked tasks are
+// sending. pinned values are reached as well.
+func (vm *VM) collect(pinned ...builtins.Value) {
+	m := marker{marked: make(map[any]bool, len(vm.heap.sizes))}
+	m.markAll(vm.stack)
+	m.markAll(vm.Variables)
+	m.markAll(vm.Globals)
+	m.markAll(vm.constants)
+	m.markAll(pinned)
+	m.markFrames(vm.frames)
+	for _, t := range vm.tasks {
+		if t == vm.current {
+			continue
+		}
+		m.markAll(t.stack)
+		m.markAll(t.variables)
+		m.markFrames(t.frames)
+		for _, w := range t.waits {
+			m.mark(w.value)
+		}
+	}
+	m.drain()
+
+	for key, size := range vm.heap.sizes {
+		if m.marked[key] {
+			continue
+		}
+		delete(vm.heap.sizes, key)
+		vm.heap.bytes -= size
+		// The trace of an err result is only needed while it can be returned
+		if result, isResult := key.(*builtins.Result); isResult {
+			delete(vm.errorTraces, result)
+		}
+	}
+
+	vm.heap.collections++
+	vm.heap.nextCollect = max(2*vm.heap.bytes, minCollectBytes)
+	if vm.tracing {
+		vm.logger.Debug("GC: %s", vm.HeapStats())
+	}
+}
+
+// marker marks the strings and objects reachable from the roots. Objects
+// are marked when they are found and traced later, from pending, so that
+// long chains of objects do not recurse deeply.
+type marker struct {
+	marked  map[any]bool
+	pending []any
+}
+
+func (m *marker) markAll(values []builtins.Value) {
+	for _, value := range values {
+		m.mark(value)
+	}
+}
+
+func (m *marker) mark(value builtins.Value) {
+	switch value.Kind {
+	case builtins.KindString:
+		if key := heapKey(value); key != nil {
+			m.marked[key] = true
+		}
+	case builtins.KindObject:
+		m.markObject(value.Object())
+	}
+}
+
+func (m *marker) markObject(object any) {
+	switch object := object.(type) {
+	case *Closure:
+		// Frames calling declared functions have no closure
+		if object == nil {
+			return
+		}
+	case nil:
+		return
+	}
+	if m.marked[object] {
+		return
+	}
+	m.marked[object] = true
+	m.pending = append(m.pending, object)
+}
+
+func (m *marker) markFrames(frames []Frame) {
+	for _, frame := range frames {
+		m.markObject(frame.closure)
+		m.markDeferred(frame.deferred)
+		if frame.generator != nil {
+			m.markObject(frame.generator)
+		}
+	}
+}
+
+func (m *marker) markDeferred(calls []deferredCall) {
+	for _, call := range calls {
+		if call.closure != nil {
+			m.markObject(call.closure)
+		}
+		m.markAll(call.args)
+	}
+}
+
+// drain traces the objects marked but not traced yet
+func (m *marker) drain() {
+	for len(m.pending) > 0 {
+		object := m.pending[len(m.pending)-1]
+		m.pending = m.pending[:len(m.pending)-1]
+		switch object := object.(type) {
+		case *builtins.Array:
+			m.markAll(object.Elements)
+		case *builtins.Map:
+			m.markAll(object.Keys)
+			for _, value := range object.Entries {
+				m.mark(value)
+			}
+		case *builtins.Result:
+			m.mark(object.Value)
+		case *Closure:
+			for _, cell := range object.Upvalues {
+				m.markObject(cell)
+			}
+		case *Cell:
+			m.mark(object.Value)
+		case *Channel:
+			m.markAll(object.buffer)
+			for _, sender := range object.senders {
+				m.mark(sender.value)
+			}
+		case *Generator:
+			m.markObject(object.closure)
+			m.markAll(object.variables)
+			m.markAll(object.stack)
+			m.markDeferred(object.deferred)
+		case *arrayIterator:
+			m.markObject(object.array)
+		}
+	}
+}
+
+// heapKey is the identity a string or object is tracked by, or nil for
+// values that hold nothing on the heap
+func heapKey(value builtins.Value) any {
+	switch value.Kind {
+	case builtins.KindString:
+		if s := value.AsString(); len(s) > 0 {
+			return unsafe.StringData(s)
+		}
+	case builtins.KindObject:
+		return value.Object()
+	}
+	return nil
+}
+
+// sizeOf estimates the bytes held by a value that lives on the heap. Values
+// held by other values are not counted, as they were allocated on their own.
+func sizeOf(value builtins.Value) int {
+	switch value.Kind {
+	case builtins.KindString:
+		return len(value.AsString())
+	case builtins.KindObject:
+		switch object := value.Object().(type) {
+		case *builtins.Array:
+			return int(unsafe.Sizeof(*object)) + cap(object.Elements)*valueSize
+		case *builtins.Map:
+			return int(unsafe.Sizeof(*object)) + len(object.Keys)*3*valueSize
+		case *builtins.Result:
+			return int(unsafe.Sizeof(*object))
+		case *Closure:
+			return int(unsafe.Sizeof(*object)) + len(object.Upvalues)*int(unsafe.Sizeof(object))
+		case *Cell:
+			return int(unsafe.Sizeof(*object))
+		case *Channel:
+			return int(unsafe.Sizeof(*object)) + cap(object.buffer)*valueSize
+		case *Generator:
+			return int(unsafe.Sizeof(*object)) + (cap(object.variables)+cap(object.stack))*valueSize
+		case *arrayIterator:
+			return int(unsafe.Sizeof(*object))
+		case *builtins.Range:
+			return int(unsafe.Sizeof(*object))
+		}
+	}
+	return 0
+}
+
+// formatBytes formats a size in bytes with a binary unit
+func formatBytes(bytes int) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	value, suffix := float64(bytes)/unit, "KB"
+	for _, next := range []string{"MB", "GB"} {
+		if value < unit {
+			break
+		}
+		value, suffix = value/unit, next
+	}
+	return fmt.Sprintf("%.1f %s", value, suffix)
+}
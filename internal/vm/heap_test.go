@@ -0,0 +1,125 @@
+package vm
+
+import (
+	"alna-lang/internal/logger"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// churnProgram allocates strings, arrays and closures that are garbage as
+// soon as waste returns
+const churnProgram = `
+int waste(int n) {
+  array<int> xs = [n, n, n]
+  string label = "n = {n}"
+  fn() int f = fn() int { return xs[0] }
+  return f()
+}
+
+int churn(int n) {
+  if n == 0 {
+    return 0
+  }
+  waste(n)
+  return churn(n - 1)
+}
+
+int main() {
+  return churn(200)
+}
+`
+
+func TestCollectFreesGarbage(t *testing.T) {
+	machine := runChurn(t, func(vm *VM) { vm.GCStress = true })
+	stats := machine.HeapStats()
+	if stats.Collections < stats.Allocated {
+		t.Errorf("Expected a collection on every allocation, got %v", stats)
+	}
+	if stats.Allocated < 800 || stats.Freed < stats.Allocated-10 {
+		t.Errorf("Expected the garbage of every call to be freed, got %v", stats)
+	}
+}
+
+func TestHeapLimitCountsLiveBytes(t *testing.T) {
+	machine := runChurn(t, func(vm *VM) { vm.Limits.MaxHeapBytes = 4096 })
+	if stats := machine.HeapStats(); stats.Bytes > 4096 {
+		t.Errorf("Expected the heap to stay under its limit, got %v", stats)
+	}
+}
+
+// TestGCStressExamples runs every example collecting on every allocation,
+// which must not change what it prints
+func TestGCStressExamples(t *testing.T) {
+	paths, err := filepath.Glob("../../examples/*.alna")
+	if err != nil {
+		t.Fatalf("Failed to list examples: %v", err)
+	}
+
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", path, err)
+		}
+		bytecode, sourceLines, err := compile(string(source), path)
+		if err != nil {
+			continue
+		}
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			expected := captureOutput(t, bytecode, sourceLines, nil)
+			if output := captureOutput(t, bytecode, sourceLines, func(vm *VM) { vm.GCStress = true }); output != expected {
+				t.Errorf("Output changed under GC stress:\n%s\nexpected:\n%s", output, expected)
+			}
+		})
+	}
+}
+
+func runChurn(t *testing.T, setup func(vm *VM)) *VM {
+	t.Helper()
+	bytecode, sourceLines, err := compile(churnProgram, "churn.alna")
+	if err != nil {
+		t.Fatalf("Failed to compile program: %v", err)
+	}
+	machine := NewVM(bytecode, sourceLines, false, logger.New(logger.LevelInfo, false))
+	setup(machine)
+	if err := machine.CheckHeader(); err != nil {
+		t.Fatalf("Invalid bytecode: %v", err)
+	}
+	if err := machine.Run(); err != nil {
+		t.Fatalf("Program failed: %v", err)
+	}
+	return machine
+}
+
+// captureOutput runs a program and returns what it printed, followed by the
+// runtime error it ended with, if any. setup, when given, configures the VM
+// before it runs.
+func captureOutput(t *testing.T, bytecode []byte, sourceLines []string, setup func(vm *VM)) string {
+	t.Helper()
+	file, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatalf("Failed to create output file: %v", err)
+	}
+	defer file.Close()
+
+	stdout := os.Stdout
+	os.Stdout = file
+	machine := NewVM(bytecode, sourceLines, false, logger.New(logger.LevelInfo, false))
+	if setup != nil {
+		setup(machine)
+	}
+	err = machine.CheckHeader()
+	if err == nil {
+		err = machine.Run()
+	}
+	os.Stdout = stdout
+
+	output, readErr := os.ReadFile(file.Name())
+	if readErr != nil {
+		t.Fatalf("Failed to read output: %v", readErr)
+	}
+	if err != nil {
+		return string(output) + err.Error()
+	}
+	return string(output)
+}
@@ -0,0 +1,45 @@
+package vm
+
+import "testing"
+
+// TestDiscardedIfValues runs if expressions whose value is not used, which
+// must leave nothing on the stack, both as statements and at the end of
+// blocks, many times over
+func TestDiscardedIfValues(t *testing.T) {
+	source := `
+int pick(x: int) {
+  if x > 0 { 1 } else { 2 }
+  return if x > 5 { x } else { 0 - x }
+}
+
+int main() {
+  mut int total = 0
+  for i in range(0, 500) {
+    if i % 2 == 0 { i } else { 0 }
+    if i % 3 == 0 {
+      if i > 10 { "big" } else { "small" }
+    } else {
+      total = total + pick(i)
+    }
+  }
+  print(total)
+  return 0
+}`
+	bytecode, sourceLines, err := compile(source, "test.alna")
+	if err != nil {
+		t.Fatalf("Failed to compile program: %v", err)
+	}
+
+	var machine *VM
+	output := captureOutput(t, bytecode, sourceLines, func(vm *VM) {
+		vm.Limits.MaxStackSize = 64
+		machine = vm
+	})
+	if output != "83143\n" {
+		t.Errorf("Expected output:\n83143\ngot:\n%s", output)
+	}
+	// main's return value is all that is left once it returns
+	if len(machine.stack) != 1 {
+		t.Errorf("Expected 1 value on the stack, got %v", machine.stack)
+	}
+}
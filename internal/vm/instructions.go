@@ -0,0 +1,546 @@
+package vm
+
+import (
+	"alna-lang/internal/builtins"
+	"alna-lang/internal/opcode"
+	"errors"
+)
+
+// handler executes an instruction whose opcode byte, op, has been read.
+// Operands are read from vm.Pc, which is left at the next instruction unless
+// the instruction jumps.
+type handler func(vm *VM, op byte) error
+
+// handlers is the dispatch table of the VM, indexed by opcode. Bytes that are
+// not opcodes dispatch to unknownOpcode.
+var handlers [256]handler
+
+func init() {
+	for i := range handlers {
+		handlers[i] = unknownOpcode
+	}
+
+	handlers[opcode.LOAD_CONST] = loadConst
+	handlers[opcode.LOAD_VAR] = loadVar
+	handlers[opcode.STORE_VAR] = storeVar
+	handlers[opcode.LOAD_GLOBAL] = loadGlobal
+	handlers[opcode.STORE_GLOBAL] = storeGlobal
+	handlers[opcode.LOAD_NIL] = loadNil
+	handlers[opcode.LOAD_NONE] = loadNone
+	handlers[opcode.POP] = pop
+
+	handlers[opcode.ADD] = binaryOp(add)
+	handlers[opcode.SUB] = binaryOp(sub)
+	handlers[opcode.MUL] = binaryOp(mul)
+	handlers[opcode.DIV] = binaryOp(div)
+	handlers[opcode.MOD] = binaryOp(mod)
+	handlers[opcode.EQ] = binaryOp(eq)
+	handlers[opcode.NEQ] = binaryOp(neq)
+	handlers[opcode.LT] = binaryOp(lt)
+	handlers[opcode.LE] = binaryOp(le)
+	handlers[opcode.GT] = binaryOp(gt)
+	handlers[opcode.GE] = binaryOp(ge)
+	handlers[opcode.AND] = binaryOp(and)
+	handlers[opcode.OR] = binaryOp(or)
+
+	handlers[opcode.ADD_VAR_CONST] = varConstOp(add)
+	handlers[opcode.SUB_VAR_CONST] = varConstOp(sub)
+	handlers[opcode.MUL_VAR_CONST] = varConstOp(mul)
+	handlers[opcode.DIV_VAR_CONST] = varConstOp(div)
+	handlers[opcode.MOD_VAR_CONST] = varConstOp(mod)
+	handlers[opcode.EQ_VAR_CONST] = varConstOp(eq)
+	handlers[opcode.NEQ_VAR_CONST] = varConstOp(neq)
+	handlers[opcode.LT_VAR_CONST] = varConstOp(lt)
+	handlers[opcode.LE_VAR_CONST] = varConstOp(le)
+	handlers[opcode.GT_VAR_CONST] = varConstOp(gt)
+	handlers[opcode.GE_VAR_CONST] = varConstOp(ge)
+
+	handlers[opcode.MAKE_ARRAY] = makeArray
+	handlers[opcode.INDEX] = index
+
+	handlers[opcode.BOX] = box
+	handlers[opcode.LOAD_CELL] = loadCell
+	handlers[opcode.STORE_CELL] = storeCell
+	handlers[opcode.LOAD_UPVALUE] = loadUpvalue
+	handlers[opcode.STORE_UPVALUE] = storeUpvalue
+	handlers[opcode.CAPTURE_UPVALUE] = captureUpvalue
+	handlers[opcode.MAKE_CLOSURE] = makeClosure
+
+	handlers[opcode.JUMP] = jump
+	handlers[opcode.JUMP_IF_FALSE] = jumpIfFalse
+	handlers[opcode.JUMP_IF_TRUE] = jumpIfTrue
+	handlers[opcode.JUMP_IF_NONE] = jumpIfNone
+	handlers[opcode.JUMP_IF_SOME] = jumpIfSome
+
+	handlers[opcode.START_SCOPE] = startScope
+	handlers[opcode.END_SCOPE] = endScope
+
+	handlers[opcode.CALL_BUILTIN] = callBuiltin
+	handlers[opcode.CALL] = call
+	handlers[opcode.TAIL_CALL] = tailCall
+	handlers[opcode.CALL_VALUE] = callValue
+	handlers[opcode.DEFER] = deferClosure
+	handlers[opcode.DEFER_BUILTIN] = deferBuiltin
+	handlers[opcode.RUN_DEFERRED] = runDeferred
+	handlers[opcode.TRY] = try
+	handlers[opcode.RETURN] = ret
+
+	handlers[opcode.SPAWN] = spawn
+	handlers[opcode.SELECT] = selectCase
+
+	handlers[opcode.GENERATOR] = makeGenerator
+	handlers[opcode.YIELD] = yieldValue
+	handlers[opcode.ITER] = iter
+	handlers[opcode.NEXT] = next
+}
+
+func unknownOpcode(vm *VM, op byte) error {
+	vm.trap("unknown opcode 0x%02X at pc %d", op, vm.instructionPc-vm.PcOffset)
+	return nil
+}
+
+func loadConst(vm *VM, op byte) error {
+	vm.pushStack(vm.constants[vm.readByte()])
+	return nil
+}
+
+func loadVar(vm *VM, op byte) error {
+	vm.pushStack(vm.getVariable(vm.frame.BasePointer + int(vm.readByte())))
+	return nil
+}
+
+func storeVar(vm *VM, op byte) error {
+	absIndex := vm.frame.BasePointer + int(vm.readByte())
+	value := vm.popValue()
+	for len(vm.Variables) <= absIndex {
+		vm.Variables = append(vm.Variables, builtins.Nil)
+	}
+	vm.Variables[absIndex] = value
+	return nil
+}
+
+func loadGlobal(vm *VM, op byte) error {
+	index := int(vm.readByte())
+	if index >= len(vm.Globals) || vm.Globals[index].Kind == builtins.KindNil {
+		vm.trap("global %d read before it was initialized", index)
+	}
+	vm.pushStack(vm.Globals[index])
+	return nil
+}
+
+func storeGlobal(vm *VM, op byte) error {
+	index := int(vm.readByte())
+	for len(vm.Globals) <= index {
+		vm.Globals = append(vm.Globals, builtins.Nil)
+	}
+	vm.Globals[index] = vm.popValue()
+	return nil
+}
+
+func loadNil(vm *VM, op byte) error {
+	vm.pushStack(builtins.Nil)
+	return nil
+}
+
+func loadNone(vm *VM, op byte) error {
+	vm.pushStack(builtins.None)
+	return nil
+}
+
+func pop(vm *VM, op byte) error {
+	vm.popStack()
+	return nil
+}
+
+// operator computes the result of a binary instruction from its operands
+type operator func(vm *VM, op byte, left, right builtins.Value) builtins.Value
+
+// binaryOp builds the handler of an instruction applying operator to the two
+// values on top of the stack
+func binaryOp(apply operator) handler {
+	return func(vm *VM, op byte) error {
+		right := vm.popStack()
+		left := vm.popStack()
+		vm.pushStack(apply(vm, op, left, right))
+		return nil
+	}
+}
+
+// varConstOp builds the handler of a superinstruction applying operator to a
+// local variable and a constant
+func varConstOp(apply operator) handler {
+	return func(vm *VM, op byte) error {
+		left := vm.getVariable(vm.frame.BasePointer + int(vm.readByte()))
+		right := vm.constants[vm.readByte()]
+		vm.pushStack(apply(vm, op, left, right))
+		return nil
+	}
+}
+
+func eq(vm *VM, op byte, left, right builtins.Value) builtins.Value {
+	return builtins.BoolValue(left == right)
+}
+
+func neq(vm *VM, op byte, left, right builtins.Value) builtins.Value {
+	return builtins.BoolValue(left != right)
+}
+
+func lt(vm *VM, op byte, left, right builtins.Value) builtins.Value {
+	return builtins.BoolValue(vm.asInt(left, op) < vm.asInt(right, op))
+}
+
+func le(vm *VM, op byte, left, right builtins.Value) builtins.Value {
+	return builtins.BoolValue(vm.asInt(left, op) <= vm.asInt(right, op))
+}
+
+func gt(vm *VM, op byte, left, right builtins.Value) builtins.Value {
+	return builtins.BoolValue(vm.asInt(left, op) > vm.asInt(right, op))
+}
+
+func ge(vm *VM, op byte, left, right builtins.Value) builtins.Value {
+	return builtins.BoolValue(vm.asInt(left, op) >= vm.asInt(right, op))
+}
+
+func and(vm *VM, op byte, left, right builtins.Value) builtins.Value {
+	return builtins.BoolValue(vm.asBool(left, op) && vm.asBool(right, op))
+}
+
+func or(vm *VM, op byte, left, right builtins.Value) builtins.Value {
+	return builtins.BoolValue(vm.asBool(left, op) || vm.asBool(right, op))
+}
+
+func makeArray(vm *VM, op byte) error {
+	count := vm.readUint16()
+	elements := make([]builtins.Value, count)
+	for i := count - 1; i >= 0; i-- {
+		elements[i] = vm.popStack()
+	}
+	array := builtins.ObjectValue(&builtins.Array{Elements: elements})
+	vm.track(array)
+	vm.pushStack(array)
+	return nil
+}
+
+func index(vm *VM, op byte) error {
+	key := vm.popStack()
+	target := vm.popStack()
+	switch container := target.Object().(type) {
+	case *builtins.Array:
+		i := vm.asInt(key, op)
+		if i < 0 || i >= len(container.Elements) {
+			vm.raise(TrapIndexOutOfRange, "index %d out of range for an array of length %d", i, len(container.Elements))
+		}
+		vm.pushStack(container.Elements[i])
+	case *builtins.Map:
+		value, exists := container.Entries[key]
+		if !exists {
+			vm.raise(TrapMissingKey, "key %s not found in map, use mapGet for keys that may be missing", quoted(key))
+		}
+		vm.pushStack(value)
+	default:
+		vm.trap("cannot index into %v", target)
+	}
+	return nil
+}
+
+func box(vm *VM, op byte) error {
+	cell := builtins.ObjectValue(&Cell{Value: vm.popStack()})
+	vm.track(cell)
+	vm.pushStack(cell)
+	return nil
+}
+
+func loadCell(vm *VM, op byte) error {
+	cell := vm.getCell(vm.frame.BasePointer + int(vm.readByte()))
+	vm.pushStack(cell.Value)
+	return nil
+}
+
+func storeCell(vm *VM, op byte) error {
+	cell := vm.getCell(vm.frame.BasePointer + int(vm.readByte()))
+	cell.Value = vm.popValue()
+	return nil
+}
+
+func loadUpvalue(vm *VM, op byte) error {
+	vm.pushStack(vm.frame.closure.Upvalues[vm.readByte()].Value)
+	return nil
+}
+
+func storeUpvalue(vm *VM, op byte) error {
+	vm.frame.closure.Upvalues[vm.readByte()].Value = vm.popValue()
+	return nil
+}
+
+func captureUpvalue(vm *VM, op byte) error {
+	vm.pushStack(builtins.ObjectValue(vm.frame.closure.Upvalues[vm.readByte()]))
+	return nil
+}
+
+func makeClosure(vm *VM, op byte) error {
+	address := vm.readUint16()
+	count := int(vm.readByte())
+	upvalues := make([]*Cell, count)
+	for i := count - 1; i >= 0; i-- {
+		cell, isCell := vm.popStack().Object().(*Cell)
+		if !isCell {
+			vm.trap("MAKE_CLOSURE expects captured cells")
+		}
+		upvalues[i] = cell
+	}
+	closure := &Closure{Address: address, Upvalues: upvalues}
+	value := builtins.ObjectValue(closure)
+	vm.track(value)
+	vm.pushStack(value)
+	if vm.tracing {
+		vm.logger.Debug("MAKE_CLOSURE %s with %d upvalues", closure, count)
+	}
+	return nil
+}
+
+func jump(vm *VM, op byte) error {
+	vm.Pc = vm.readUint16() + vm.PcOffset
+	return nil
+}
+
+func jumpIfFalse(vm *VM, op byte) error {
+	target := vm.readUint16()
+	if !vm.asBool(vm.popStack(), op) {
+		vm.Pc = target + vm.PcOffset
+	}
+	return nil
+}
+
+func jumpIfTrue(vm *VM, op byte) error {
+	target := vm.readUint16()
+	if vm.asBool(vm.popStack(), op) {
+		vm.Pc = target + vm.PcOffset
+	}
+	return nil
+}
+
+func jumpIfNone(vm *VM, op byte) error {
+	target := vm.readUint16()
+	if vm.peekValue().Kind == builtins.KindNone {
+		vm.popStack()
+		vm.Pc = target + vm.PcOffset
+	}
+	return nil
+}
+
+func jumpIfSome(vm *VM, op byte) error {
+	target := vm.readUint16()
+	if vm.peekValue().Kind != builtins.KindNone {
+		vm.Pc = target + vm.PcOffset
+	} else {
+		vm.popStack()
+	}
+	return nil
+}
+
+func startScope(vm *VM, op byte) error {
+	vm.openScope(vm.frame.BasePointer + int(vm.readByte()))
+	return nil
+}
+
+func endScope(vm *VM, op byte) error {
+	vm.closeScope()
+	return nil
+}
+
+func callBuiltin(vm *VM, op byte) error {
+	function := vm.Functions[vm.readByte()]
+	argCount := int(vm.readByte())
+	if vm.tracing {
+		vm.logger.Debug("CALL_BUILTIN function %s with %d arguments", function.Name, argCount)
+	}
+	args := make([]builtins.Value, argCount)
+	for i := argCount - 1; i >= 0; i-- {
+		args[i] = vm.popValue()
+	}
+	if function.Allocates != nil {
+		vm.reserve(function.Allocates(args...), args...)
+	}
+	// Void builtins return nil, which is pushed like any other result so
+	// that every call leaves exactly one value on the stack
+	result, err := function.Implementation(args...)
+	// A send or receive that has to wait blocks the task, and its result
+	// is pushed once it completes
+	var blocked blockedError
+	if errors.As(err, &blocked) && !vm.stopping {
+		vm.block(blocked.waits)
+		return nil
+	}
+	if err != nil {
+		return vm.builtinError(err)
+	}
+	vm.trackCall(args, result)
+	if r, isResult := result.Object().(*builtins.Result); isResult && !r.Ok {
+		vm.errorTraces[r] = vm.stackTrace()
+	}
+	vm.pushStack(result)
+	return nil
+}
+
+func call(vm *VM, op byte) error {
+	address := vm.readUint16() + vm.PcOffset
+	argCount := int(vm.readByte())
+	vm.enterFunction(address, nil, argCount)
+	return nil
+}
+
+func tailCall(vm *VM, op byte) error {
+	address := vm.readUint16() + vm.PcOffset
+	argCount := int(vm.readByte())
+	vm.replaceFunction(address, argCount)
+	return nil
+}
+
+func callValue(vm *VM, op byte) error {
+	argCount := int(vm.readByte())
+	calleeIndex := len(vm.stack) - argCount - 1
+	closure, isClosure := vm.stack[calleeIndex].Object().(*Closure)
+	if !isClosure {
+		vm.trap("cannot call %v", vm.stack[calleeIndex])
+	}
+	vm.stack = append(vm.stack[:calleeIndex], vm.stack[calleeIndex+1:]...)
+	if vm.tracing {
+		vm.logger.Debug("CALL_VALUE %s with %d arguments", closure, argCount)
+	}
+	vm.enterFunction(closure.Address+vm.PcOffset, closure, argCount)
+	return nil
+}
+
+func deferClosure(vm *VM, op byte) error {
+	argCount := int(vm.readByte())
+	args := make([]builtins.Value, argCount)
+	for i := argCount - 1; i >= 0; i-- {
+		args[i] = vm.popStack()
+	}
+	closure, isClosure := vm.popStack().Object().(*Closure)
+	if !isClosure {
+		vm.trap("DEFER expects a function value")
+	}
+	vm.frame.deferred = append(vm.frame.deferred, deferredCall{closure: closure, args: args})
+	return nil
+}
+
+func deferBuiltin(vm *VM, op byte) error {
+	function := &vm.Functions[vm.readByte()]
+	argCount := int(vm.readByte())
+	args := make([]builtins.Value, argCount)
+	for i := argCount - 1; i >= 0; i-- {
+		args[i] = vm.popStack()
+	}
+	vm.frame.deferred = append(vm.frame.deferred, deferredCall{builtin: function, args: args})
+	return nil
+}
+
+func runDeferred(vm *VM, op byte) error {
+	return vm.runNextDeferred()
+}
+
+func spawn(vm *VM, op byte) error {
+	argCount := int(vm.readByte())
+	args := make([]builtins.Value, argCount)
+	for i := argCount - 1; i >= 0; i-- {
+		args[i] = vm.popValue()
+	}
+	closure, isClosure := vm.popStack().Object().(*Closure)
+	if !isClosure {
+		vm.trap("SPAWN expects a function value")
+	}
+	vm.startTask(closure, args)
+	return nil
+}
+
+func selectCase(vm *VM, op byte) error {
+	count := int(vm.readByte())
+	sends := vm.readUint16()
+	hasElse := vm.readByte() != 0
+	vm.selectCases(count, sends, hasElse)
+	return nil
+}
+
+func makeGenerator(vm *VM, op byte) error {
+	resume := vm.readUint16() + vm.PcOffset
+	g := &Generator{}
+	vm.suspend(g, resume)
+	value := builtins.ObjectValue(g)
+	vm.track(value)
+	vm.pushStack(value)
+	return nil
+}
+
+func yieldValue(vm *VM, op byte) error {
+	value := vm.popValue()
+	g := vm.frame.generator
+	if g == nil {
+		vm.trap("YIELD outside of a generator")
+	}
+	vm.suspend(g, vm.Pc)
+	vm.leaveFrame()
+	vm.pushStack(value)
+	// The heap accounts for the state the generator holds
+	if generator := builtins.ObjectValue(g); vm.remeasure(generator) {
+		vm.allocated(generator)
+	}
+	return nil
+}
+
+func iter(vm *VM, op byte) error {
+	if array, isArray := vm.peekValue().Object().(*builtins.Array); isArray {
+		iterator := builtins.ObjectValue(&arrayIterator{array: array})
+		vm.stack[len(vm.stack)-1] = iterator
+		vm.track(iterator)
+	}
+	return nil
+}
+
+func next(vm *VM, op byte) error {
+	exhausted := vm.readUint16() + vm.PcOffset
+	vm.nextValue(vm.popValue(), exhausted)
+	return nil
+}
+
+func try(vm *VM, op byte) error {
+	target := vm.readUint16()
+	result, isResult := vm.peekValue().Object().(*builtins.Result)
+	if !isResult {
+		vm.trap("TRY expects a result, got %v", vm.peekValue())
+	}
+	if result.Ok {
+		vm.stack[len(vm.stack)-1] = result.Value
+		vm.Pc = target + vm.PcOffset
+	}
+	return nil
+}
+
+func ret(vm *VM, op byte) error {
+	valueCount := int(vm.readByte())
+	if g := vm.frame.generator; g != nil {
+		vm.finishGenerator(g)
+		return nil
+	}
+	// A task other than the first ends when its function returns, and the
+	// program when the first one does
+	if len(vm.frames) == 1 && !vm.isMainTask() {
+		vm.endTask()
+		return nil
+	}
+	if len(vm.frames) == 1 {
+		if result, isResult := vm.peekValue().Object().(*builtins.Result); isResult && !result.Ok {
+			return vm.uncaughtError(result)
+		}
+		vm.Pc = len(vm.program)
+		vm.logger.Debug("RETURN from main - program ended")
+		return nil
+	}
+	// A return can leave a frame before the operands it pushed were
+	// consumed, as with the ? operator, so only the values returned are
+	// kept. Functions with several return values leave them in order.
+	returnValues := vm.stack[len(vm.stack)-valueCount:]
+	vm.stack = append(vm.stack[:vm.frame.StackBase], returnValues...)
+	vm.leaveFrame()
+	return nil
+}
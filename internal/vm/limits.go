@@ -0,0 +1,63 @@
+package vm
+
+// Limits bounds the resources a program can use, so that programs that
+// cannot be trusted can be run without hanging or exhausting the process
+// running them. A limit left at zero is not enforced. A program exceeding a
+// limit stops with a runtime error whose Trap tells which one it was.
+type Limits struct {
+	// MaxInstructions is the number of instructions the program can execute
+	MaxInstructions int
+	// MaxCallDepth is the number of function calls that can be active at once
+	MaxCallDepth int
+	// MaxStackSize is the number of values the operand stack can hold
+	MaxStackSize int
+	// MaxHeapBytes is the number of bytes the strings, arrays, maps,
+	// results and closures the program can reach may take, estimated from
+	// their size. The heap is collected before the limit is enforced.
+	MaxHeapBytes int
+}
+
+// cancelCheckInterval is the number of instructions executed between checks
+// of the context a program is run with
+const cancelCheckInterval = 1024
+
+// countInstruction counts the instruction about to be executed. Every
+// cancelCheckInterval instructions, and when the instruction limit is
+// reached, it calls checkLimits, which also switches to the next ready task.
+func (vm *VM) countInstruction() {
+	if vm.executed == vm.nextCheck {
+		vm.checkLimits()
+	}
+	vm.executed++
+}
+
+// checkLimits stops the program when it has executed as many instructions as
+// it can or the context it is run with is done
+func (vm *VM) checkLimits() {
+	if max := vm.Limits.MaxInstructions; max > 0 && vm.executed >= max {
+		vm.raise(TrapInstructionLimit, "instruction limit of %d exceeded", max)
+	}
+	if vm.ctx != nil {
+		if err := vm.ctx.Err(); err != nil {
+			panic(trapError{trap: TrapCanceled, message: "program canceled: " + err.Error(), cause: err})
+		}
+	}
+
+	vm.nextCheck = vm.executed + cancelCheckInterval
+	if max := vm.Limits.MaxInstructions; max > 0 && vm.nextCheck > max {
+		vm.nextCheck = max
+	}
+
+	// The task running has had its turn
+	if len(vm.ready) > 0 && !vm.stopping {
+		vm.yield()
+	}
+}
+
+// checkCallDepth stops the program when entering a function would make more
+// calls active than it can have
+func (vm *VM) checkCallDepth() {
+	if max := vm.Limits.MaxCallDepth; max > 0 && len(vm.frames) > max {
+		vm.raise(TrapCallDepthLimit, "call depth limit of %d exceeded", max)
+	}
+}
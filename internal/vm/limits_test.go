@@ -0,0 +1,144 @@
+package vm
+
+import (
+	"alna-lang/internal/logger"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		limits  Limits
+		trap    Trap
+		message string
+	}{
+		{
+			"instructions",
+			"int count(int n) {\n  return 1 + count(n + 1)\n}\n\nint main() {\n  return count(0)\n}",
+			Limits{MaxInstructions: 5000},
+			TrapInstructionLimit,
+			"instruction limit of 5000 exceeded",
+		},
+		{
+			"call depth",
+			"int count(int n) {\n  return 1 + count(n + 1)\n}\n\nint main() {\n  return count(0)\n}",
+			Limits{MaxCallDepth: 100},
+			TrapCallDepthLimit,
+			"call depth limit of 100 exceeded",
+		},
+		{
+			"stack size",
+			"int sum(int n) {\n  return n + sum(n + 1)\n}\n\nint main() {\n  return sum(0)\n}",
+			Limits{MaxStackSize: 100},
+			TrapStackLimit,
+			"stack limit of 100 values exceeded",
+		},
+		{
+			"heap bytes",
+			"string grow(string s) {\n  return grow(s + s)\n}\n\nint main() {\n  printString(grow(\"ab\"))\n  return 0\n}",
+			Limits{MaxHeapBytes: 1 << 16},
+			TrapHeapLimit,
+			"heap limit of 65536 bytes exceeded",
+		},
+		{
+			"array growth",
+			"include \"arrays\"\n\nint fill(array<int> xs) {\n  arrayPush(xs, 1)\n  return fill(xs)\n}\n\nint main() {\n  return fill([0])\n}",
+			Limits{MaxHeapBytes: 1 << 16},
+			TrapHeapLimit,
+			"heap limit of 65536 bytes exceeded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runtimeErr := runFailing(t, tt.source, func(vm *VM) { vm.Limits = tt.limits })
+			if runtimeErr.Trap != tt.trap {
+				t.Errorf("Expected a %s trap, got %s: %s", tt.trap, runtimeErr.Trap, runtimeErr.Message)
+			}
+			if runtimeErr.Message != tt.message {
+				t.Errorf("Expected message %q, got %q", tt.message, runtimeErr.Message)
+			}
+		})
+	}
+}
+
+// TestHeapLimitBeforeAllocating checks that allocations whose size their
+// operands decide are refused before they are made, leaving the heap under
+// its limit
+func TestHeapLimitBeforeAllocating(t *testing.T) {
+	const limit = 60000
+	// s is 32 KB, so building anything as large again exceeds the limit
+	program := func(body string) string {
+		return `include "strings"
+include "arrays"
+
+string grow(s: string, n: int) {
+  if n == 0 {
+    return s
+  }
+  return grow(s + s, n - 1)
+}
+
+int main() {
+  string s = grow("ab", 14)
+  mut array<int> xs = []
+  ` + body + `
+  return 0
+}`
+	}
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"concatenation", "printString(s + s)"},
+		{"format", "printString(format(s, \"1000\"))"},
+		{"string slice", "printString(substring(s, 0, 30000))"},
+		{"array slice", "for i in range(0, 500) {\n    arrayPush(xs, i)\n  }\n  print(arrayLength(arraySlice(xs, 0, 500)))"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var machine *VM
+			runtimeErr := runFailing(t, program(tt.body), func(vm *VM) {
+				vm.Limits.MaxHeapBytes = limit
+				machine = vm
+			})
+			if runtimeErr.Trap != TrapHeapLimit {
+				t.Errorf("Expected a %s trap, got %s: %s", TrapHeapLimit, runtimeErr.Trap, runtimeErr.Message)
+			}
+			if stats := machine.HeapStats(); stats.Bytes > limit {
+				t.Errorf("Expected the heap to stay under its limit, got %v", stats)
+			}
+		})
+	}
+}
+
+func TestRunContextCanceled(t *testing.T) {
+	source := "int count(int n) {\n  return 1 + count(n + 1)\n}\n\nint main() {\n  return count(0)\n}"
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	bytecode, sourceLines, err := compile(source, "test.alna")
+	if err != nil {
+		t.Fatalf("Failed to compile program: %v", err)
+	}
+	machine := NewVM(bytecode, sourceLines, false, logger.New(logger.LevelInfo, false))
+	if err := machine.CheckHeader(); err != nil {
+		t.Fatalf("Invalid bytecode: %v", err)
+	}
+
+	err = machine.RunContext(ctx)
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("Expected a runtime error, got %v", err)
+	}
+	if runtimeErr.Trap != TrapCanceled {
+		t.Errorf("Expected a %s trap, got %s", TrapCanceled, runtimeErr.Trap)
+	}
+	if !errors.Is(runtimeErr, context.Canceled) {
+		t.Errorf("Expected the error to wrap context.Canceled, got %v", runtimeErr)
+	}
+}
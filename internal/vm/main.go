@@ -5,8 +5,11 @@ import (
 	"alna-lang/internal/codegen"
 	"alna-lang/internal/logger"
 	"alna-lang/internal/opcode"
+	"context"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"math/rand/v2"
 	"os"
 )
 
@@ -14,7 +17,7 @@ type DebugInfo struct {
 	Version     int              `json:"version"`
 	SourceFile  string           `json:"sourceFile"`
 	SourceLines []string         `json:"sourceLines"`
-	Variables   []VariableInfo   `json:"variables"`
+	Globals     []VariableInfo   `json:"globals"`
 	Functions   []FunctionInfo   `json:"functions"`
 	SourceMap   []SourceMapEntry `json:"sourceMap"`
 }
@@ -45,22 +48,62 @@ type SourcePosition struct {
 }
 
 type VM struct {
-	program       []byte
-	rawCode       []string
-	Pc            int
-	PcOffset      int
-	stack         []any
-	callStack     []int
-	scopeStack    []int
-	basePointer   int
-	constants     []any
-	Variables     []any
-	Functions     []FunctionDefinition
-	debugMode     bool
-	logger        *logger.Logger
-	debugInfo     *DebugInfo
-	VariableNames map[int]string
-	SourceMap     map[int]SourcePosition
+	program  []byte
+	rawCode  []string
+	Pc       int
+	PcOffset int
+	stack    []builtins.Value
+	// frames holds the active calls, and frame points to the last of them,
+	// the one being executed. scopeMarks holds the marks of the scopes open
+	// in all of them.
+	frames      []Frame
+	frame       *Frame
+	scopeMarks  []int
+	constants   []builtins.Value
+	Variables   []builtins.Value
+	Globals     []builtins.Value
+	Functions   []FunctionDefinition
+	debugMode   bool
+	logger      *logger.Logger
+	debugInfo   *DebugInfo
+	GlobalNames map[int]string
+	SourceMap   map[int]SourcePosition
+	// instructionPc is the address of the instruction being executed, and
+	// errorTraces the stack traces recorded where err results were created
+	instructionPc  int
+	functionRanges []codegen.FunctionRange
+	lineTable      []codegen.LineEntry
+	errorTraces    map[*builtins.Result][]TraceFrame
+	// tracing is set when debug messages are written, so that instructions
+	// are only traced when someone reads the trace
+	tracing bool
+	// CheckOverflow makes int arithmetic trap when its result overflows,
+	// instead of wrapping around
+	CheckOverflow bool
+	// Limits bounds the resources the program can use. executed counts the
+	// instructions executed, nextCheck is the count at which checkLimits is
+	// called next and ctx is the context the program is run with.
+	Limits    Limits
+	executed  int
+	nextCheck int
+	ctx       context.Context
+	// heap tracks the strings and objects the program allocates. GCStress
+	// collects it on every allocation, to test the collector.
+	heap     heap
+	GCStress bool
+	// tasks holds the tasks that have not ended, current the one running
+	// and ready those waiting for their turn. Seed makes the scheduler
+	// pick the next task and the case of a select at random, from numbers
+	// drawn by random, so that a program runs the same way for the same
+	// seed. When it is zero, tasks take turns in order. stopping is set
+	// once the program has failed, when tasks no longer switch.
+	tasks      []*task
+	current    *task
+	ready      []*task
+	nextTaskId int
+	Seed       uint64
+	random     *rand.Rand
+	stopping   bool
 }
 
 type FunctionType int
@@ -73,22 +116,23 @@ const (
 type FunctionDefinition struct {
 	Name           string
 	Implementation builtins.Function
+	Allocates      func(args ...builtins.Value) int
 	Type           FunctionType
 	Instructions   []byte
 }
 
 func NewVM(program []byte, code []string, debugMode bool, lgr *logger.Logger) *VM {
 	vm := &VM{
-		program:       program,
-		rawCode:       code,
-		Pc:            0,
-		stack:         []any{},
-		callStack:     []int{},
-		scopeStack:    []int{},
-		debugMode:     debugMode,
-		logger:        lgr,
-		VariableNames: make(map[int]string),
-		SourceMap:     make(map[int]SourcePosition),
+		program:     program,
+		rawCode:     code,
+		Pc:          0,
+		stack:       []builtins.Value{},
+		debugMode:   debugMode,
+		logger:      lgr,
+		GlobalNames: make(map[int]string),
+		SourceMap:   make(map[int]SourcePosition),
+		errorTraces: make(map[*builtins.Result][]TraceFrame),
+		tracing:     lgr.DebugEnabled(),
 	}
 	return vm
 }
@@ -107,8 +151,8 @@ func (vm *VM) LoadDebugFile(path string) error {
 	vm.debugInfo = &debugInfo
 	vm.rawCode = debugInfo.SourceLines
 
-	for _, v := range debugInfo.Variables {
-		vm.VariableNames[v.Index] = v.Name
+	for _, v := range debugInfo.Globals {
+		vm.GlobalNames[v.Index] = v.Name
 	}
 
 	for _, entry := range debugInfo.SourceMap {
@@ -138,12 +182,20 @@ func (vm *VM) CheckHeader() error {
 }
 
 func (vm *VM) Run() error {
+	return vm.RunContext(context.Background())
+}
+
+// RunContext runs the program until it ends, fails, exceeds its Limits or
+// ctx is done. A program stopped by ctx fails with a runtime error wrapping
+// the context's error.
+func (vm *VM) RunContext(ctx context.Context) error {
+	vm.ctx = ctx
 	startingPc := vm.readBytes(4)
 	mainAddress := int(startingPc[0]) | int(startingPc[1])<<8 | int(startingPc[2])<<16 | int(startingPc[3])<<24
 	vm.logger.Debug("Starting PC: %d", mainAddress)
 	costantsCount := vm.readByte()
 	vm.logger.Debug("Constants count: %d", costantsCount)
-	vm.constants = make([]any, int(costantsCount))
+	vm.constants = make([]builtins.Value, int(costantsCount))
 	vm.registerBuiltins()
 
 	compiledFuncNames := make(map[int]string)
@@ -157,17 +209,41 @@ func (vm *VM) Run() error {
 		typeId := vm.readByte()
 		switch typeId {
 		case codegen.IntTypeId:
-			intValue := vm.readByte()
+			intValue := int64(binary.LittleEndian.Uint64(vm.readBytes(8)))
 
 			vm.logger.Debug("Constant %d: INT %d", i, intValue)
-			vm.constants[i] = int(intValue)
+			vm.constants[i] = builtins.IntValue(int(intValue))
+		case codegen.BoolTypeId:
+			boolValue := vm.readByte() != 0
+
+			vm.logger.Debug("Constant %d: BOOL %v", i, boolValue)
+			vm.constants[i] = builtins.BoolValue(boolValue)
+		case codegen.StringTypeId:
+			length := int(binary.LittleEndian.Uint16(vm.readBytes(2)))
+			strValue := string(vm.readBytes(length))
+
+			vm.logger.Debug("Constant %d: STRING %q", i, strValue)
+			vm.constants[i] = builtins.StringValue(strValue)
 		default:
 			return fmt.Errorf("unknown constant type id: %d", typeId)
 		}
 	}
+
+	functionRanges, lineTable, size, err := codegen.DecodeLineTable(vm.program[vm.Pc:])
+	if err != nil {
+		return err
+	}
+	vm.functionRanges, vm.lineTable = functionRanges, lineTable
+	vm.Pc += size
+
 	vm.PcOffset = vm.Pc
 	vm.Pc = mainAddress + vm.PcOffset
 	vm.logger.Debug("Initial PC set to: %d", vm.Pc)
+	vm.enterFirstFrame()
+	vm.enterMainTask()
+	if vm.Seed != 0 {
+		vm.random = rand.New(rand.NewPCG(vm.Seed, 0))
+	}
 
 	if vm.debugMode {
 		vm.logger.Info("=== STARTING DEBUG MODE ===")
@@ -178,125 +254,72 @@ func (vm *VM) Run() error {
 		return nil
 	}
 
+	run := vm.run
+	if vm.tracing {
+		run = vm.stepAll
+	}
+	if err := run(); err != nil {
+		// Deferred calls are made on the way out of a failing program, by
+		// the task that failed alone
+		vm.stopping = true
+		vm.unwind(1)
+		vm.runDeferredCalls()
+		return err
+	}
+
+	return nil
+}
+
+// stepAll runs the program one Step at a time, tracing every instruction
+func (vm *VM) stepAll() error {
 	for vm.Pc < len(vm.program) {
-		err := vm.Step()
-		if err != nil {
+		if err := vm.Step(); err != nil {
 			return err
 		}
 	}
-
 	return nil
 }
 
-func (vm *VM) Step() error {
+// Step executes a single instruction. It is the path taken by the debugger
+// and while tracing, and reports traps as runtime errors like run does.
+func (vm *VM) Step() (err error) {
 	if vm.Pc >= len(vm.program) {
 		return nil
 	}
+	defer vm.recoverTrap(&err)
+	vm.instructionPc = vm.Pc
+	vm.countInstruction()
 	op := vm.readByte()
+	if vm.tracing {
+		vm.traceInstruction(op)
+	}
+	return handlers[op](vm, op)
+}
 
-	switch op {
-	case byte(opcode.LOAD_CONST):
-		constIndex := vm.readByte()
-		constValue := vm.constants[int(constIndex)]
-
-		vm.pushStack(constValue)
-		vm.logger.Debug("LOAD_CONST %d -> %v", constIndex, constValue)
-	case byte(opcode.LOAD_VAR):
-		varIndex := vm.readByte()
-		varValue := vm.getVariable(vm.basePointer + int(varIndex))
-		vm.pushStack(varValue)
-		vm.logger.Debug("LOAD_VAR %d (abs %d) -> %v", varIndex, vm.basePointer+int(varIndex), varValue)
-	case byte(opcode.STORE_VAR):
-		varIndex := vm.readByte()
-		value := vm.popStack()
-		absIndex := vm.basePointer + int(varIndex)
-		for len(vm.Variables) <= absIndex {
-			vm.Variables = append(vm.Variables, nil)
-		}
-		vm.Variables[absIndex] = value
-
-		vm.logger.Debug("STORE_VAR %d (abs %d) <- %v", varIndex, absIndex, value)
-
-	case byte(opcode.ADD):
-		right := vm.popStack()
-		left := vm.popStack()
-		result := left.(int) + right.(int)
-		vm.pushStack(result)
-		vm.logger.Debug("ADD %v + %v -> %v", left, right, result)
-
-	case byte(opcode.GT):
-		right := vm.popStack()
-		left := vm.popStack()
-		result := left.(int) > right.(int)
-		vm.pushStack(result)
-		vm.logger.Debug("GT %v > %v -> %v", left, right, result)
-
-	case byte(opcode.LT):
-		right := vm.popStack()
-		left := vm.popStack()
-		result := left.(int) < right.(int)
-		vm.pushStack(result)
-		vm.logger.Debug("LT %v > %v -> %v", left, right, result)
-
-	case byte(opcode.JUMP):
-		target := vm.readByte()
-		vm.Pc = int(target) + vm.PcOffset
-
-	case byte(opcode.JUMP_IF_FALSE):
-		target := vm.readByte()
-		condition := vm.popStack()
-		if condition == false {
-			vm.Pc = int(target) + vm.PcOffset
-			vm.logger.Debug("JUMP_IF_FALSE to %d", target)
-		} else {
-			vm.logger.Debug("JUMP_IF_FALSE skipped")
-		}
-	case byte(opcode.START_SCOPE):
-		localsIndex := vm.readByte()
-		absIndex := vm.basePointer + int(localsIndex)
-		vm.pushScopeStack(absIndex)
-		vm.logger.Debug("START_SCOPE %d (abs %d)", localsIndex, absIndex)
-	case byte(opcode.END_SCOPE):
-		scopeVarIndex := vm.popScopeStack()
-		vm.logger.Debug("END_SCOPE, clearing variables to abs index %d", scopeVarIndex)
-		vm.Variables = vm.Variables[:scopeVarIndex]
-	case byte(opcode.CALL_BUILTIN):
-		funcIndex := vm.readByte()
-		function := vm.Functions[int(funcIndex)]
-		vm.logger.Debug("CALL_BUILTIN function %s", function.Name)
-		arg := vm.popStack()
-		result := function.Implementation(arg)
-		if result != nil {
-			vm.pushStack(result)
-			vm.logger.Debug("Function %s returned %v", function.Name, result)
-		}
-	case byte(opcode.CALL):
-		funcIndex := int(vm.readByte()) + vm.PcOffset
-		vm.logger.Debug("CALL function at: %d", funcIndex)
-
-		returnAddress := vm.Pc
-		vm.pushCallStack(returnAddress)
-		vm.pushCallStack(vm.basePointer)
-		vm.basePointer = len(vm.Variables)
-		vm.Pc = funcIndex
-
-	case byte(opcode.RETURN):
-		if len(vm.callStack) == 0 {
-			vm.Pc = len(vm.program)
-			vm.logger.Debug("RETURN from main - program ended")
-			return nil
+// run executes instructions until the program ends or fails. It does the
+// same as calling Step in a loop, without its per-instruction overhead.
+func (vm *VM) run() (err error) {
+	defer vm.recoverTrap(&err)
+	for vm.Pc < len(vm.program) {
+		vm.instructionPc = vm.Pc
+		vm.countInstruction()
+		op := vm.program[vm.Pc]
+		vm.Pc++
+		if err := handlers[op](vm, op); err != nil {
+			return err
 		}
-		vm.Variables = vm.Variables[:vm.basePointer]
-		vm.basePointer = vm.popCallStack()
-		returnAddress := vm.popCallStack()
-		vm.Pc = returnAddress
-		vm.logger.Debug("RETURN to %d, basePointer restored to %d", returnAddress, vm.basePointer)
-
-	default:
-		return fmt.Errorf("unknown opcode: 0x%02X at pc %d", op, vm.Pc-1)
 	}
 	return nil
+}
 
+// traceInstruction logs the instruction about to be executed along with the
+// value on top of the stack
+func (vm *VM) traceInstruction(op byte) {
+	top := "empty"
+	if len(vm.stack) > 0 {
+		top = vm.stack[len(vm.stack)-1].String()
+	}
+	vm.logger.Debug("%04d %s (stack %d, top %s)", vm.instructionPc-vm.PcOffset, opcode.Opcode(op), len(vm.stack), top)
 }
 
 func (vm *VM) readByte() byte {
@@ -315,48 +338,79 @@ func (vm *VM) readBytes(n int) []byte {
 	return bytes
 }
 
-func (vm *VM) pushStack(value any) {
+func (vm *VM) readUint16() int {
+	return int(binary.LittleEndian.Uint16(vm.readBytes(2)))
+}
+
+func (vm *VM) pushStack(value builtins.Value) {
+	if max := vm.Limits.MaxStackSize; max > 0 && len(vm.stack) >= max {
+		vm.raise(TrapStackLimit, "stack limit of %d values exceeded", max)
+	}
 	vm.stack = append(vm.stack, value)
 }
 
-func (vm *VM) popStack() any {
-	if len(vm.stack) == 0 {
-		return nil
+// popStack pops an operand of the current frame. The operands below the
+// frame's stack base belong to its callers.
+func (vm *VM) popStack() builtins.Value {
+	if len(vm.stack) <= vm.frame.StackBase {
+		vm.raise(TrapStackUnderflow, "operand stack underflow")
 	}
 	value := vm.stack[len(vm.stack)-1]
 	vm.stack = vm.stack[:len(vm.stack)-1]
 	return value
 }
 
-func (vm *VM) pushCallStack(returnAddress int) {
-	vm.callStack = append(vm.callStack, returnAddress)
+// popValue pops a value that is stored or passed on, which is never nil: nil
+// only stands for the missing result of a void call, which is discarded
+func (vm *VM) popValue() builtins.Value {
+	value := vm.popStack()
+	if value.Kind == builtins.KindNil {
+		vm.trap("nil value where a value was expected")
+	}
+	return value
 }
 
-func (vm *VM) popCallStack() int {
-	if len(vm.callStack) == 0 {
-		return 0
+// peekValue returns the value on top of the stack without popping it
+func (vm *VM) peekValue() builtins.Value {
+	if len(vm.stack) <= vm.frame.StackBase {
+		vm.raise(TrapStackUnderflow, "operand stack underflow")
 	}
-	address := vm.callStack[len(vm.callStack)-1]
-	vm.callStack = vm.callStack[:len(vm.callStack)-1]
-	return address
+	return vm.stack[len(vm.stack)-1]
 }
 
-func (vm *VM) pushScopeStack(localsIndex int) {
-	vm.scopeStack = append(vm.scopeStack, localsIndex)
+func (vm *VM) getVariable(index int) builtins.Value {
+	if index < 0 || index >= len(vm.Variables) || vm.Variables[index].Kind == builtins.KindNil {
+		vm.trap("read of unset variable slot %d", index)
+	}
+	return vm.Variables[index]
 }
 
-func (vm *VM) popScopeStack() int {
-	if len(vm.scopeStack) == 0 {
-		return 0
+// getCell returns the cell holding a captured variable
+func (vm *VM) getCell(index int) *Cell {
+	cell, isCell := vm.getVariable(index).Object().(*Cell)
+	if !isCell {
+		vm.trap("variable slot %d does not hold a captured variable", index)
 	}
-	index := vm.scopeStack[len(vm.scopeStack)-1]
-	vm.scopeStack = vm.scopeStack[:len(vm.scopeStack)-1]
-	return index
+	return cell
 }
 
-func (vm *VM) getVariable(index int) any {
-	if index < 0 || index >= len(vm.Variables) {
-		return nil
+// popInts pops the two int operands of a binary instruction
+func (vm *VM) popInts(op byte) (int, int) {
+	right := vm.popStack()
+	left := vm.popStack()
+	return vm.asInt(left, op), vm.asInt(right, op)
+}
+
+func (vm *VM) asInt(value builtins.Value, op byte) int {
+	if value.Kind != builtins.KindInt {
+		vm.trap("%s expects an int operand, got %s", opcode.Opcode(op), value.Kind)
 	}
-	return vm.Variables[index]
+	return value.AsInt()
+}
+
+func (vm *VM) asBool(value builtins.Value, op byte) bool {
+	if value.Kind != builtins.KindBool {
+		vm.trap("%s expects a bool operand, got %s", opcode.Opcode(op), value.Kind)
+	}
+	return value.AsBool()
 }
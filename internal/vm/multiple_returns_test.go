@@ -0,0 +1,71 @@
+package vm
+
+import "testing"
+
+// TestMultipleReturns runs functions returning several values, which are
+// destructured, assigned, discarded and passed along, many times over so
+// that values left behind on the stack would overflow it
+func TestMultipleReturns(t *testing.T) {
+	source := `
+(int, int, int) split(n: int) {
+  if n < 0 {
+    return 0 - 1, 0 - 1, 0 - 1
+  }
+  return n / 100, n / 10 % 10, n % 10
+}
+
+(int, int, int) passed(n: int) {
+  return split(n)
+}
+
+(string, bool) label(n: int) {
+  return if n % 2 == 0 { "even" } else { "odd" }, n > 5
+}
+
+int main() {
+  mut int total = 0
+  for i in range(0, 300) {
+    a, b, c := split(i)
+    total = total + a * 100 + b * 10 + c
+    _, _, last := passed(i)
+    total = total - last
+    split(i)
+  }
+  print(total)
+
+  x, y, z := split(0 - 5)
+  print(x + y + z)
+
+  mut lo, hi := 1, 2
+  lo, hi = hi, lo
+  print(lo * 10 + hi)
+
+  mut int a = 0
+  mut int b = 0
+  mut int c = 0
+  a, b, c = passed(472)
+  print(a * 100 + b * 10 + c)
+
+  name, big := label(7)
+  printString("{name} {big}")
+  return 0
+}`
+	bytecode, sourceLines, err := compile(source, "test.alna")
+	if err != nil {
+		t.Fatalf("Failed to compile program: %v", err)
+	}
+
+	var machine *VM
+	output := captureOutput(t, bytecode, sourceLines, func(vm *VM) {
+		vm.Limits.MaxStackSize = 64
+		machine = vm
+	})
+	expected := "43500\n-3\n21\n472\nodd true\n"
+	if output != expected {
+		t.Errorf("Expected output:\n%s\ngot:\n%s", expected, output)
+	}
+	// main's return value is all that is left once it returns
+	if len(machine.stack) != 1 {
+		t.Errorf("Expected 1 value on the stack, got %v", machine.stack)
+	}
+}
@@ -0,0 +1,85 @@
+package vm
+
+import "testing"
+
+func TestOptionals(t *testing.T) {
+	source := `
+include "maps"
+
+int? half(n: int) {
+  if n % 2 == 0 {
+    return n / 2
+  }
+  return none
+}
+
+int fallback(n: int) {
+  print(n)
+  return n
+}
+
+string describe(string? name) {
+  return if name is some n { "name {n}" } else { "no name" }
+}
+
+int main() {
+  // ?? only evaluates its right side for none
+  print(half(8) ?? fallback(100))
+  print(half(7) ?? fallback(200))
+  print(half(7) ?? half(5) ?? 0)
+
+  mut int? value = none
+  if value == none {
+    print(1)
+  }
+  value = 6
+  if value is some v {
+    print(v * 2)
+  }
+  if value != none {
+    print(2)
+  }
+  value = none
+  if value is some v {
+    print(v)
+  } else {
+    print(3)
+  }
+
+  printString(describe("ada"))
+  printString(describe(none))
+
+  map<string, int> ages
+  mapSet(ages, "ada", 36)
+  print(mapGet(ages, "ada") ?? 0)
+  print(mapGet(ages, "alan") ?? 0)
+
+  mut int found = 0
+  for i in range(0, 100) {
+    if half(i) is some h {
+      found = found + h
+    }
+    found = found + (half(i) ?? 0)
+  }
+  print(found)
+  return 0
+}`
+	bytecode, sourceLines, err := compile(source, "test.alna")
+	if err != nil {
+		t.Fatalf("Failed to compile program: %v", err)
+	}
+
+	var machine *VM
+	output := captureOutput(t, bytecode, sourceLines, func(vm *VM) {
+		vm.Limits.MaxStackSize = 64
+		machine = vm
+	})
+	expected := "4\n200\n200\n0\n1\n12\n2\n3\nname ada\nno name\n36\n0\n2450\n"
+	if output != expected {
+		t.Errorf("Expected output:\n%s\ngot:\n%s", expected, output)
+	}
+	// main's return value is all that is left once it returns
+	if len(machine.stack) != 1 {
+		t.Errorf("Expected 1 value on the stack, got %v", machine.stack)
+	}
+}
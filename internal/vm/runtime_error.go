@@ -0,0 +1,301 @@
+package vm
+
+import (
+	"alna-lang/internal/builtins"
+	"alna-lang/internal/common"
+	"alna-lang/internal/stdlib"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// RuntimeError is a failure that terminates an Alna program, such as an
+// uncaught err result, a failing builtin or a trap. Pc is the address of the
+// instruction that failed, relative to the start of the code. Trace lists the
+// calls that led to it, innermost first. Excerpt shows the source where it
+// happened, and is empty when that source is not available.
+type RuntimeError struct {
+	Message string
+	Trap    Trap
+	Pc      int
+	Trace   []TraceFrame
+	Excerpt string
+	// cause is the error of the context a canceled program was run with
+	cause error
+}
+
+// Trap identifies the failure of an instruction a runtime error reports
+type Trap int
+
+const (
+	// TrapNone is the kind of the failures raised by the program rather
+	// than by an instruction, such as uncaught err results
+	TrapNone Trap = iota
+	TrapDivisionByZero
+	TrapOverflow
+	TrapIndexOutOfRange
+	TrapMissingKey
+	TrapStackUnderflow
+	// TrapClosedChannel reports a send on or a close of a closed channel,
+	// and TrapDeadlock a program whose tasks are all blocked on channels
+	TrapClosedChannel
+	TrapDeadlock
+	// TrapGeneratorRunning reports a generator resumed while it is running,
+	// from its own body
+	TrapGeneratorRunning
+	// The limit traps report a program exceeding its Limits, and
+	// TrapCanceled one whose context was done before it ended
+	TrapInstructionLimit
+	TrapCallDepthLimit
+	TrapStackLimit
+	TrapHeapLimit
+	TrapCanceled
+	// TrapInternal reports bytecode the compiler should never have produced
+	// and panics of the Go runtime
+	TrapInternal
+)
+
+func (t Trap) String() string {
+	switch t {
+	case TrapNone:
+		return "none"
+	case TrapDivisionByZero:
+		return "division by zero"
+	case TrapOverflow:
+		return "overflow"
+	case TrapIndexOutOfRange:
+		return "index out of range"
+	case TrapMissingKey:
+		return "missing key"
+	case TrapStackUnderflow:
+		return "stack underflow"
+	case TrapClosedChannel:
+		return "closed channel"
+	case TrapDeadlock:
+		return "deadlock"
+	case TrapGeneratorRunning:
+		return "generator running"
+	case TrapInstructionLimit:
+		return "instruction limit"
+	case TrapCallDepthLimit:
+		return "call depth limit"
+	case TrapStackLimit:
+		return "stack limit"
+	case TrapHeapLimit:
+		return "heap limit"
+	case TrapCanceled:
+		return "canceled"
+	case TrapInternal:
+		return "internal"
+	default:
+		return fmt.Sprintf("trap(%d)", int(t))
+	}
+}
+
+// TraceFrame is a call in the stack trace of a runtime error
+type TraceFrame struct {
+	Function string
+	File     string
+	Line     int
+	Column   int
+}
+
+func (e *RuntimeError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("\n\033[1;31mRuntime Error:\033[0m %s\n", e.Message))
+	sb.WriteString(e.Excerpt)
+	for i, frame := range e.Trace {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(frame.String())
+	}
+	return sb.String()
+}
+
+// Unwrap returns the error of the context a canceled program was run with,
+// so that errors.Is matches context.Canceled and context.DeadlineExceeded
+func (e *RuntimeError) Unwrap() error {
+	return e.cause
+}
+
+func (f TraceFrame) String() string {
+	if f.Line == 0 {
+		return fmt.Sprintf("  at %s (%s)", f.Function, f.File)
+	}
+	return fmt.Sprintf("  at %s (%s:%d:%d)", f.Function, f.File, f.Line, f.Column+1)
+}
+
+// runtimeError builds a runtime error whose trace starts at the instruction
+// being executed
+func (vm *VM) runtimeError(format string, args ...any) *RuntimeError {
+	return vm.newRuntimeError(fmt.Sprintf(format, args...), vm.stackTrace())
+}
+
+func (vm *VM) newRuntimeError(message string, trace []TraceFrame) *RuntimeError {
+	err := &RuntimeError{Message: message, Pc: vm.instructionPc - vm.PcOffset, Trace: trace}
+	if len(trace) > 0 && trace[0].Line > 0 {
+		pos := common.Position{Line: trace[0].Line, Column: trace[0].Column, EndColumn: trace[0].Column + 1}
+		err.Excerpt = common.SourceExcerpt(pos, vm.sourceOf(trace[0].File))
+	}
+	return err
+}
+
+// sourceOf returns the lines of a source file of the program: the file being
+// run, a standard library module or an included file
+func (vm *VM) sourceOf(file string) []string {
+	var source []byte
+	if module, isStd := strings.CutPrefix(file, "std/"); isStd {
+		source, _ = stdlib.Source(strings.TrimSuffix(module, ".alna"))
+	} else if file == vm.mainFile() {
+		return vm.rawCode
+	} else {
+		source, _ = os.ReadFile(file)
+	}
+	if source == nil {
+		return nil
+	}
+	return strings.Split(string(source), "\n")
+}
+
+// mainFile returns the file being run, which the top-level statements come
+// from
+func (vm *VM) mainFile() string {
+	for _, fn := range vm.functionRanges {
+		if fn.Name == "<init>" {
+			return fn.File
+		}
+	}
+	return ""
+}
+
+// builtinError builds the runtime error for a failing builtin. Builtins
+// given an index out of range fail with an index trap, and so do those given
+// a closed channel with a channel trap.
+func (vm *VM) builtinError(err error) *RuntimeError {
+	if errors.Is(err, builtins.ErrIndexOutOfRange) {
+		return vm.trapped(TrapIndexOutOfRange, err.Error())
+	}
+	if errors.Is(err, errClosedChannel) {
+		return vm.trapped(TrapClosedChannel, err.Error())
+	}
+	return vm.runtimeError("%v", err)
+}
+
+// trapError is raised by raise to stop the instruction being executed. It
+// is recovered by Step and run, which report it as a runtime error.
+type trapError struct {
+	trap    Trap
+	message string
+	cause   error
+}
+
+// raise stops the instruction being executed with a trap
+func (vm *VM) raise(trap Trap, format string, args ...any) {
+	panic(trapError{trap: trap, message: fmt.Sprintf(format, args...)})
+}
+
+// trap stops the instruction being executed when the VM finds a value the
+// compiler should never have produced, such as nil where a value is expected
+func (vm *VM) trap(format string, args ...any) {
+	vm.raise(TrapInternal, "internal error: "+format, args...)
+}
+
+// recoverTrap turns a trap raised while executing an instruction into the
+// runtime error the instruction returns, and so does it for the panics of
+// the Go runtime
+func (vm *VM) recoverTrap(err *error) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	if trap, isTrap := recovered.(trapError); isTrap {
+		runtimeErr := vm.trapped(trap.trap, trap.message)
+		runtimeErr.cause = trap.cause
+		*err = runtimeErr
+		return
+	}
+	var goErr runtime.Error
+	if recoveredErr, isErr := recovered.(error); isErr && errors.As(recoveredErr, &goErr) {
+		*err = vm.trapped(TrapInternal, "internal error: "+strings.TrimPrefix(goErr.Error(), "runtime error: "))
+		return
+	}
+	panic(recovered)
+}
+
+func (vm *VM) trapped(trap Trap, message string) *RuntimeError {
+	err := vm.newRuntimeError(message, vm.stackTrace())
+	err.Trap = trap
+	return err
+}
+
+// uncaughtError builds the runtime error for an err result returned from
+// main. Its trace is the one recorded where the error was created.
+func (vm *VM) uncaughtError(result *builtins.Result) *RuntimeError {
+	trace, recorded := vm.errorTraces[result]
+	if !recorded {
+		trace = vm.stackTrace()
+	}
+	return vm.newRuntimeError(fmt.Sprintf("uncaught error: %v", result.Value), trace)
+}
+
+// stackTrace maps the instruction being executed and the return address of
+// every active call to their function and source position. Frames inside the
+// standard library are left out from the top of the trace, so that it starts
+// at the program code that called into it. A frame whose function was
+// replaced by a tail call into the standard library has no such code left,
+// so the tail call stands in for it.
+func (vm *VM) stackTrace() []TraceFrame {
+	var trace []TraceFrame
+	for i := len(vm.frames) - 1; i >= 0; i-- {
+		pc := vm.instructionPc
+		if i < len(vm.frames)-1 {
+			pc = vm.frames[i+1].ReturnPc - 1
+		}
+		frame := vm.traceFrame(pc - vm.PcOffset)
+		trace = append(trace, frame)
+
+		if vm.frames[i].tailCalled && isStd(frame.File) {
+			if site := vm.traceFrame(vm.frames[i].tailCallPc - vm.PcOffset); !isStd(site.File) {
+				trace = append(trace, site)
+			}
+		}
+	}
+
+	for len(trace) > 1 && isStd(trace[0].File) {
+		trace = trace[1:]
+	}
+	return trace
+}
+
+// isStd reports whether file is a module of the standard library
+func isStd(file string) bool {
+	return strings.HasPrefix(file, "std/")
+}
+
+func (vm *VM) traceFrame(pc int) TraceFrame {
+	frame := TraceFrame{Function: "?", File: "?"}
+
+	// Function literals are nested in the code of the function declaring
+	// them, so the innermost range holding pc is the function it belongs to
+	innermost := -1
+	for i, fn := range vm.functionRanges {
+		if pc >= fn.Start && pc < fn.End && (innermost < 0 || fn.Start > vm.functionRanges[innermost].Start) {
+			innermost = i
+		}
+	}
+	if innermost >= 0 {
+		frame.Function = vm.functionRanges[innermost].Name
+		frame.File = vm.functionRanges[innermost].File
+	}
+
+	for _, entry := range vm.lineTable {
+		if entry.Pc > pc {
+			break
+		}
+		frame.Line, frame.Column = entry.Line, entry.Column
+	}
+	return frame
+}
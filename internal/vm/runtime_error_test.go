@@ -0,0 +1,127 @@
+package vm
+
+import (
+	"alna-lang/internal/logger"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRuntimeErrorTrace(t *testing.T) {
+	source := `int pick(array<int> xs, int i) {
+  return xs[i]
+}
+
+int main() {
+  array<int> xs = [1, 2, 3]
+  int picked = pick(xs, 7)
+  return picked
+}`
+
+	runtimeErr := runFailing(t, source, nil)
+	if runtimeErr.Message != "index 7 out of range for an array of length 3" {
+		t.Errorf("Unexpected message %q", runtimeErr.Message)
+	}
+
+	expected := []TraceFrame{
+		{Function: "pick", File: "test.alna", Line: 2, Column: 9},
+		{Function: "main", File: "test.alna", Line: 7, Column: 15},
+	}
+	if len(runtimeErr.Trace) != len(expected) {
+		t.Fatalf("Expected %d frames, got %v", len(expected), runtimeErr.Trace)
+	}
+	for i, frame := range expected {
+		if runtimeErr.Trace[i] != frame {
+			t.Errorf("Frame %d: expected %+v, got %+v", i, frame, runtimeErr.Trace[i])
+		}
+	}
+
+	if !strings.Contains(runtimeErr.Excerpt, "2 |   return xs[i]") {
+		t.Errorf("Excerpt does not show the failing line:\n%s", runtimeErr.Excerpt)
+	}
+}
+
+// TestTailCallIntoStdTrace checks that the trace of an error made by a
+// standard library function main tail calls starts at that call, although
+// the function replaced main's frame
+func TestTailCallIntoStdTrace(t *testing.T) {
+	source := `include "strings"
+
+Result<int, string> main() {
+  return parseInt("x")
+}`
+
+	runtimeErr := runFailing(t, source, nil)
+	if runtimeErr.Message != `uncaught error: cannot convert "x" to int` {
+		t.Errorf("Unexpected message %q", runtimeErr.Message)
+	}
+
+	expected := TraceFrame{Function: "main", File: "test.alna", Line: 4, Column: 9}
+	if len(runtimeErr.Trace) == 0 || runtimeErr.Trace[0] != expected {
+		t.Errorf("Expected the trace to start at %+v, got %v", expected, runtimeErr.Trace)
+	}
+	if !strings.Contains(runtimeErr.Excerpt, `4 |   return parseInt("x")`) {
+		t.Errorf("Excerpt does not show the tail call:\n%s", runtimeErr.Excerpt)
+	}
+}
+
+func TestTraps(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		checked bool
+		trap    Trap
+		message string
+	}{
+		{"division by zero", "int zero = 0\n  return 7 / zero", false, TrapDivisionByZero, "division by zero: 7 / 0"},
+		{"remainder by zero", "int zero = 0\n  return 7 % zero", false, TrapDivisionByZero, "division by zero: 7 % 0"},
+		{"unchecked overflow", "int big = 9223372036854775807\n  int wrapped = big + 1\n  return 1 / 0", false, TrapDivisionByZero, "division by zero: 1 / 0"},
+		{"checked add", "int big = 9223372036854775807\n  return big + 1", true, TrapOverflow, "int overflow: 9223372036854775807 + 1"},
+		{"checked mul", "int big = 4611686018427387904\n  return big * 2", true, TrapOverflow, "int overflow: 4611686018427387904 * 2"},
+		{"array index", "array<int> xs = [1]\n  int i = 0 - 1\n  return xs[i]", false, TrapIndexOutOfRange, "index -1 out of range for an array of length 1"},
+		{"builtin index", "return stringLength(substring(\"abc\", 2, 5))", false, TrapIndexOutOfRange, "index out of range: range 2 to 5 for a string of length 3"},
+		{"format width", "string spec = \"99999999999999999999\"\n  return stringLength(format(1, spec))", false, TrapNone, "invalid format spec \"99999999999999999999\": width must be at most 1000"},
+		{"format precision", "string spec = \".5000\"\n  return stringLength(format(\"abc\", spec))", false, TrapNone, "invalid format spec \".5000\": precision must be at most 1000"},
+		{"missing key", "map<string, int> m\n  return m[\"a\"]", false, TrapMissingKey, "key \"a\" not found in map, use mapGet for keys that may be missing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := "include \"strings\"\ninclude \"maps\"\n\nint main() {\n  " + tt.body + "\n}"
+			runtimeErr := runFailing(t, source, func(vm *VM) { vm.CheckOverflow = tt.checked })
+			if runtimeErr.Trap != tt.trap {
+				t.Errorf("Expected a %s trap, got %s", tt.trap, runtimeErr.Trap)
+			}
+			if runtimeErr.Message != tt.message {
+				t.Errorf("Expected message %q, got %q", tt.message, runtimeErr.Message)
+			}
+			if len(runtimeErr.Trace) == 0 || runtimeErr.Trace[0].Function != "main" {
+				t.Errorf("Expected the trace to start in main, got %v", runtimeErr.Trace)
+			}
+		})
+	}
+}
+
+// runFailing runs a program that is expected to end in a runtime error.
+// setup, when given, configures the VM before it runs.
+func runFailing(t *testing.T, source string, setup func(vm *VM)) *RuntimeError {
+	t.Helper()
+	bytecode, sourceLines, err := compile(source, "test.alna")
+	if err != nil {
+		t.Fatalf("Failed to compile program: %v", err)
+	}
+
+	machine := NewVM(bytecode, sourceLines, false, logger.New(logger.LevelInfo, false))
+	if setup != nil {
+		setup(machine)
+	}
+	if err := machine.CheckHeader(); err != nil {
+		t.Fatalf("Invalid bytecode: %v", err)
+	}
+	err = machine.Run()
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("Expected a runtime error, got %v", err)
+	}
+	return runtimeErr
+}
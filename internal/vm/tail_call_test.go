@@ -0,0 +1,88 @@
+package vm
+
+import (
+	"alna-lang/internal/logger"
+	"testing"
+)
+
+// TestTailCallsReuseFrames runs recursions far deeper than the call depth
+// and stack limits allow, which only fit when their calls are tail calls
+func TestTailCallsReuseFrames(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{"self", `
+int sum(int n, int total) {
+  if n == 0 {
+    return total
+  }
+  return sum(n - 1, total + n)
+}
+
+int main() {
+  if sum(100000, 0) != 5000050000 {
+    int zero = 0
+    return 1 / zero
+  }
+  return 0
+}`},
+		{"mutual", `
+bool even(int n) {
+  if n == 0 {
+    return true
+  }
+  return odd(n - 1)
+}
+
+bool odd(int n) {
+  if n == 0 {
+    return false
+  }
+  return even(n - 1)
+}
+
+int main() {
+  if odd(100000) {
+    int zero = 0
+    return 1 / zero
+  }
+  return 0
+}`},
+		{"void", `
+mut int calls = 0
+
+countdown(n: int) {
+  calls = calls + 1
+  if n > 0 {
+    countdown(n - 1)
+  }
+}
+
+int main() {
+  countdown(100000)
+  if calls != 100001 {
+    int zero = 0
+    return 1 / zero
+  }
+  return 0
+}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bytecode, sourceLines, err := compile(tt.source, "test.alna")
+			if err != nil {
+				t.Fatalf("Failed to compile program: %v", err)
+			}
+			machine := NewVM(bytecode, sourceLines, false, logger.New(logger.LevelInfo, false))
+			machine.Limits = Limits{MaxCallDepth: 4, MaxStackSize: 32}
+			if err := machine.CheckHeader(); err != nil {
+				t.Fatalf("Invalid bytecode: %v", err)
+			}
+			if err := machine.Run(); err != nil {
+				t.Fatalf("Program failed: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package vm
+
+import (
+	"alna-lang/internal/builtins"
+	"slices"
+)
+
+// task is a green thread of the program: the top-level code and main run in
+// the first one, and spawn starts the others. The registers of the VM hold
+// those of the task running, while the other tasks keep theirs here until
+// they are resumed.
+type task struct {
+	id         int
+	pc         int
+	stack      []builtins.Value
+	frames     []Frame
+	scopeMarks []int
+	variables  []builtins.Value
+	// waits holds the channel operations the task is blocked on, and
+	// blockedPc the address of the instruction that blocked. failure is set
+	// when the task is woken up to fail, as senders are when their channel
+	// is closed.
+	waits     []*waiter
+	blockedPc int
+	failure   *trapError
+}
+
+// enterMainTask starts the task the top-level code runs in, in the frame
+// entered by enterFirstFrame
+func (vm *VM) enterMainTask() {
+	vm.current = &task{}
+	vm.tasks = []*task{vm.current}
+	vm.ready = nil
+	vm.nextTaskId = 1
+}
+
+// startTask starts a task calling closure with args. It waits in the ready
+// queue for its turn, and ends when the function returns.
+func (vm *VM) startTask(closure *Closure, args []builtins.Value) {
+	address := closure.Address + vm.PcOffset
+	t := &task{
+		id:     vm.nextTaskId,
+		pc:     address,
+		stack:  args,
+		frames: []Frame{{Function: address, ReturnPc: len(vm.program), ArgCount: len(args), closure: closure}},
+	}
+	vm.nextTaskId++
+	vm.tasks = append(vm.tasks, t)
+	vm.ready = append(vm.ready, t)
+	if vm.tracing {
+		vm.logger.Debug("SPAWN task %d calling %s", t.id, closure)
+	}
+}
+
+// isMainTask reports whether the task running is the first one, whose end
+// is the end of the program
+func (vm *VM) isMainTask() bool {
+	return vm.current == vm.tasks[0]
+}
+
+// saveTask stores the registers of the task running into it
+func (vm *VM) saveTask() {
+	t := vm.current
+	t.pc, t.stack, t.frames, t.scopeMarks, t.variables = vm.Pc, vm.stack, vm.frames, vm.scopeMarks, vm.Variables
+}
+
+// resume loads the registers of t, which continues where it stopped. A task
+// woken up to fail raises its trap at the instruction it blocked on.
+func (vm *VM) resume(t *task) {
+	vm.current = t
+	vm.Pc, vm.stack, vm.frames, vm.scopeMarks, vm.Variables = t.pc, t.stack, t.frames, t.scopeMarks, t.variables
+	vm.frame = &vm.frames[len(vm.frames)-1]
+	vm.instructionPc = vm.Pc
+	if vm.tracing {
+		vm.logger.Debug("Switched to task %d", t.id)
+	}
+
+	if failure := t.failure; failure != nil {
+		t.failure = nil
+		vm.instructionPc = t.blockedPc
+		panic(*failure)
+	}
+}
+
+// yield puts the task running back in the ready queue and runs the next
+// one, so that tasks that never block still take turns
+func (vm *VM) yield() {
+	vm.saveTask()
+	vm.ready = append(vm.ready, vm.current)
+	vm.switchTask()
+}
+
+// switchTask runs the next ready task in place of the one running, which
+// has been saved, is blocked or has ended. The queue is run in order, or in
+// a random order drawn from Seed when it is set.
+func (vm *VM) switchTask() {
+	if len(vm.ready) == 0 {
+		vm.deadlock()
+	}
+	next := 0
+	if vm.random != nil {
+		next = vm.random.IntN(len(vm.ready))
+	}
+	t := vm.ready[next]
+	vm.ready = slices.Delete(vm.ready, next, next+1)
+	vm.resume(t)
+}
+
+// endTask ends the task running, whose function has returned, discarding
+// the values it returned
+func (vm *VM) endTask() {
+	if vm.tracing {
+		vm.logger.Debug("Task %d ended", vm.current.id)
+	}
+	vm.tasks = slices.DeleteFunc(vm.tasks, func(t *task) bool { return t == vm.current })
+	vm.switchTask()
+}
+
+// block stops the task running until one of waits completes, and runs the
+// next ready task meanwhile. The operation that completes pushes its result
+// onto the stack of the task, which then continues after the instruction
+// that blocked.
+func (vm *VM) block(waits []*waiter) {
+	t := vm.current
+	t.waits = waits
+	t.blockedPc = vm.instructionPc
+	for _, w := range waits {
+		w.channel.enqueue(w)
+	}
+	if vm.tracing {
+		vm.logger.Debug("Task %d blocked on %d channel operations", t.id, len(waits))
+	}
+	vm.saveTask()
+	vm.switchTask()
+}
+
+// deadlock stops the program once no task can run. The error is reported
+// where the main task is blocked, which is the one whose deferred calls are
+// made on the way out.
+func (vm *VM) deadlock() {
+	count := len(vm.tasks)
+	if !vm.isMainTask() {
+		main := vm.tasks[0]
+		for _, w := range main.waits {
+			w.channel.cancel(w)
+		}
+		main.waits = nil
+		vm.resume(main)
+		vm.instructionPc = main.blockedPc
+	}
+	if count == 1 {
+		vm.raise(TrapDeadlock, "deadlock: the only task left is blocked on a channel")
+	}
+	vm.raise(TrapDeadlock, "deadlock: all %d tasks left are blocked on channels", count)
+}
@@ -0,0 +1,196 @@
+package vm
+
+import "testing"
+
+func TestTasks(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{"producer and consumer", `
+produce(c: chan<int>, n: int) {
+  if n > 0 {
+    send(c, n)
+    produce(c, n - 1)
+  } else {
+    close(c)
+  }
+}
+
+consume(c: chan<int>) {
+  int? value = receive(c)
+  if value is some n {
+    print(n)
+    consume(c)
+  }
+}
+
+int main() {
+  chan<int> c
+  spawn produce(c, 3)
+  consume(c)
+  return 0
+}`, "3\n2\n1\n"},
+		{"buffered", `
+int main() {
+  chan<string> c = channel(2)
+  send(c, "a")
+  send(c, "b")
+  close(c)
+  printString(receive(c) ?? "none")
+  printString(receive(c) ?? "none")
+  printString(receive(c) ?? "none")
+  return 0
+}`, "a\nb\nnone\n"},
+		{"select", `
+answer(c: chan<int>) {
+  send(c, 42)
+}
+
+int main() {
+  chan<int> numbers
+  chan<string> words
+  spawn answer(numbers)
+  select {
+    case word := receive(words) {
+      printString(word ?? "")
+    }
+    case n := receive(numbers) {
+      print(n ?? 0)
+    }
+  }
+  select {
+    case send(words, "late") {
+      printString("sent")
+    }
+    else {
+      printString("no receiver")
+    }
+  }
+  return 0
+}`, "42\nno receiver\n"},
+		{"preemption", `
+count(name: string, n: int) {
+  if n > 0 {
+    if n % 1000 == 0 {
+      printString("{name} {n}")
+    }
+    count(name, n - 1)
+  }
+}
+
+int main() {
+  spawn count("a", 2000)
+  spawn count("b", 2000)
+  count("main", 4000)
+  return 0
+}`, "main 4000\na 2000\nb 2000\nmain 3000\na 1000\nb 1000\nmain 2000\nmain 1000\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bytecode, sourceLines, err := compile(tt.source, "test.alna")
+			if err != nil {
+				t.Fatalf("Failed to compile program: %v", err)
+			}
+			if output := captureOutput(t, bytecode, sourceLines, nil); output != tt.expected {
+				t.Errorf("Expected output:\n%s\ngot:\n%s", tt.expected, output)
+			}
+		})
+	}
+}
+
+func TestChannelTraps(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		trap    Trap
+		message string
+	}{
+		{"deadlock", `
+wait(c: chan<int>) {
+  int? value = receive(c)
+}
+
+int main() {
+  chan<int> c
+  spawn wait(c)
+  int? value = receive(c)
+  return 0
+}`, TrapDeadlock, "deadlock: all 2 tasks left are blocked on channels"},
+		{"send on closed", `
+int main() {
+  chan<int> c = channel(1)
+  close(c)
+  send(c, 1)
+  return 0
+}`, TrapClosedChannel, "cannot send on a closed channel"},
+		{"close closed", `
+int main() {
+  chan<int> c
+  close(c)
+  close(c)
+  return 0
+}`, TrapClosedChannel, "cannot close a closed channel"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runtimeErr := runFailing(t, tt.source, nil)
+			if runtimeErr.Trap != tt.trap {
+				t.Errorf("Expected a %s trap, got %s", tt.trap, runtimeErr.Trap)
+			}
+			if runtimeErr.Message != tt.message {
+				t.Errorf("Expected message %q, got %q", tt.message, runtimeErr.Message)
+			}
+			if len(runtimeErr.Trace) == 0 || runtimeErr.Trace[0].Function != "main" {
+				t.Errorf("Expected the trace to start in main, got %v", runtimeErr.Trace)
+			}
+		})
+	}
+}
+
+// TestSeedReplaysSchedule runs tasks racing to send on a channel, whose
+// order only depends on the seed the VM is given
+func TestSeedReplaysSchedule(t *testing.T) {
+	source := `
+report(c: chan<string>, name: string) {
+  send(c, name)
+}
+
+int main() {
+  chan<string> c
+  spawn report(c, "a")
+  spawn report(c, "b")
+  spawn report(c, "c")
+  spawn report(c, "d")
+  string first = receive(c) ?? ""
+  string second = receive(c) ?? ""
+  string third = receive(c) ?? ""
+  string fourth = receive(c) ?? ""
+  printString(first + second + third + fourth)
+  return 0
+}`
+	bytecode, sourceLines, err := compile(source, "test.alna")
+	if err != nil {
+		t.Fatalf("Failed to compile program: %v", err)
+	}
+
+	if output := captureOutput(t, bytecode, sourceLines, nil); output != "abcd\n" {
+		t.Errorf("Expected the tasks to run in order without a seed, got %q", output)
+	}
+
+	orders := make(map[string]bool)
+	for seed := uint64(1); seed <= 8; seed++ {
+		withSeed := func(vm *VM) { vm.Seed = seed }
+		output := captureOutput(t, bytecode, sourceLines, withSeed)
+		if again := captureOutput(t, bytecode, sourceLines, withSeed); again != output {
+			t.Errorf("Seed %d ran as %q, then as %q", seed, output, again)
+		}
+		orders[output] = true
+	}
+	if len(orders) < 2 {
+		t.Errorf("Expected different seeds to run the tasks in different orders, got %v", orders)
+	}
+}
@@ -2,6 +2,7 @@ package vm
 
 import (
 	"alna-lang/internal/opcode"
+	"encoding/binary"
 	"fmt"
 	"strings"
 
@@ -22,6 +23,7 @@ type TuiDebuggerModel struct {
 	functionsViewport viewport.Model
 	stackViewport     viewport.Model
 	variablesViewport viewport.Model
+	framesViewport    viewport.Model
 }
 
 var (
@@ -93,7 +95,7 @@ func (m TuiDebuggerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 
 		leftPanelCount := 3
-		rightPanelCount := 2
+		rightPanelCount := 3
 		leftHeight := (msg.Height - 5 - leftPanelCount*3) / leftPanelCount
 		rightHeight := (msg.Height - 5 - rightPanelCount*3) / rightPanelCount
 
@@ -102,6 +104,7 @@ func (m TuiDebuggerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.functionsViewport = viewport.New(colWidth, leftHeight)
 		m.stackViewport = viewport.New(colWidth, rightHeight)
 		m.variablesViewport = viewport.New(colWidth, rightHeight)
+		m.framesViewport = viewport.New(colWidth, rightHeight)
 	}
 
 	return m, nil
@@ -113,6 +116,7 @@ func (m TuiDebuggerModel) View() string {
 	m.functionsViewport.SetContent(m.VM.renderFunctionsView())
 	m.stackViewport.SetContent(m.VM.renderStackView())
 	m.variablesViewport.SetContent(m.VM.renderVariablesView())
+	m.framesViewport.SetContent(m.VM.renderFramesView())
 
 	colWidth := m.width/2 - 4
 	if colWidth < 20 {
@@ -124,9 +128,10 @@ func (m TuiDebuggerModel) View() string {
 	functionsBox := m.renderTitledBox("Functions", m.functionsViewport.View(), colWidth)
 	stackBox := m.renderTitledBox("Stack", m.stackViewport.View(), colWidth)
 	variablesBox := m.renderTitledBox("Variables", m.variablesViewport.View(), colWidth)
+	framesBox := m.renderTitledBox("Frames", m.framesViewport.View(), colWidth)
 
 	leftSide := lipgloss.JoinVertical(lipgloss.Top, bytecodeBox, sourceBox, functionsBox)
-	rightSide := lipgloss.JoinVertical(lipgloss.Top, stackBox, variablesBox)
+	rightSide := lipgloss.JoinVertical(lipgloss.Top, stackBox, variablesBox, framesBox)
 
 	content := lipgloss.JoinHorizontal(lipgloss.Top, leftSide, rightSide)
 
@@ -190,6 +195,8 @@ func (m TuiDebuggerModel) renderStatusBar() string {
 	stateText := pausedStyle.Render("⏸ PAUSED")
 	pcText := fmt.Sprintf("PC: %04d", m.VM.Pc)
 	stepText := fmt.Sprintf("Step: %d", m.stepCount)
+	stats := m.VM.HeapStats()
+	heapText := fmt.Sprintf("Heap: %d objects, %s, %d GCs", stats.Objects, formatBytes(stats.Bytes), stats.Collections)
 
 	keys := fmt.Sprintf("%s %s %s",
 		keyStyle.Render("[n]ext"),
@@ -197,7 +204,7 @@ func (m TuiDebuggerModel) renderStatusBar() string {
 		keyStyle.Render("[h]elp"),
 	)
 
-	leftSide := fmt.Sprintf("%s │ %s │ %s", stateText, dimStyle.Render(pcText), dimStyle.Render(stepText))
+	leftSide := fmt.Sprintf("%s │ %s │ %s │ %s", stateText, dimStyle.Render(pcText), dimStyle.Render(stepText), dimStyle.Render(heapText))
 	rightSide := keys
 
 	spacing := m.width - lipgloss.Width(leftSide) - lipgloss.Width(rightSide) - 4
@@ -268,6 +275,23 @@ func (vm *VM) renderStackView() string {
 	return stackContent
 }
 
+// renderFramesView lists the active calls, innermost first, with the line
+// each of them is at
+func (vm *VM) renderFramesView() string {
+	var framesContent string
+	frames := vm.Frames()
+	pc := vm.Pc
+	for i := len(frames) - 1; i >= 0; i-- {
+		frame := frames[i]
+		location := vm.traceFrame(pc - vm.PcOffset)
+		framesContent += fmt.Sprintf("%s line %d ", location.Function, location.Line)
+		framesContent += dimStyle.Render(fmt.Sprintf("(%d args, %d scopes, vars from %d)", frame.ArgCount, len(frame.ScopeMarks), frame.BasePointer)) + "\n"
+		// The caller is at the instruction that made the call
+		pc = frame.ReturnPc - 1
+	}
+	return framesContent
+}
+
 func (vm *VM) renderBytecodeView() string {
 	var bytecodeContent string
 
@@ -282,16 +306,24 @@ func (vm *VM) renderBytecodeView() string {
 		op := opcode.Opcode(vm.program[pos])
 		instruction := fmt.Sprintf("%s%04d: %s", indicator, pos, op.String())
 
-		if op.HasOperand() && pos+1 < len(vm.program) {
+		if op.HasOperand() && pos+op.Size() <= len(vm.program) {
 			operand := int(vm.program[pos+1])
-			instruction += fmt.Sprintf(" %d", operand)
+			operandPos := pos + 1
+			for _, width := range op.OperandWidths() {
+				if width == 2 {
+					instruction += fmt.Sprintf(" %d", binary.LittleEndian.Uint16(vm.program[operandPos:]))
+				} else {
+					instruction += fmt.Sprintf(" %d", vm.program[operandPos])
+				}
+				operandPos += width
+			}
 
 			if op == opcode.LOAD_CONST && operand < len(vm.constants) {
 				instruction += fmt.Sprintf("  ; %v", vm.constants[operand])
 			} else if op == opcode.LOAD_VAR || op == opcode.STORE_VAR {
 				relativePc := pos - vm.PcOffset
 				if srcPos, ok := vm.SourceMap[relativePc]; ok && srcPos.VarName != "" {
-					absIdx := vm.basePointer + operand
+					absIdx := vm.frame.BasePointer + operand
 					if absIdx < len(vm.Variables) {
 						instruction += fmt.Sprintf("  ; %s=%v", srcPos.VarName, vm.Variables[absIdx])
 					} else {
@@ -300,7 +332,7 @@ func (vm *VM) renderBytecodeView() string {
 				}
 			}
 
-			pos += 2
+			pos += op.Size()
 		} else {
 			pos++
 		}
@@ -384,13 +416,6 @@ func (vm *VM) getVariableNamesAtCurrentPc() map[int]string {
 		}
 	}
 
-	// Also include global variable names
-	for idx, name := range vm.VariableNames {
-		if _, exists := names[idx]; !exists {
-			names[idx] = name
-		}
-	}
-
 	return names
 }
 
@@ -400,16 +425,27 @@ func (vm *VM) renderVariablesView() string {
 		variablesContent = "No variables yet\n"
 	} else {
 		varNames := vm.getVariableNamesAtCurrentPc()
-		for i := vm.basePointer; i < len(vm.Variables); i++ {
-			relIdx := i - vm.basePointer
+		for i := vm.frame.BasePointer; i < len(vm.Variables); i++ {
+			relIdx := i - vm.frame.BasePointer
 			if name, ok := varNames[relIdx]; ok {
 				variablesContent += fmt.Sprintf("%s: %v\n", name, vm.Variables[i])
 			} else {
 				variablesContent += fmt.Sprintf("var[%d]: %v\n", relIdx, vm.Variables[i])
 			}
 		}
-		if vm.basePointer > 0 {
-			variablesContent += dimStyle.Render(fmt.Sprintf("--- parent frames: %d vars ---\n", vm.basePointer))
+		if vm.frame.BasePointer > 0 {
+			variablesContent += dimStyle.Render(fmt.Sprintf("--- parent frames: %d vars ---\n", vm.frame.BasePointer))
+		}
+	}
+
+	if len(vm.Globals) > 0 {
+		variablesContent += dimStyle.Render("--- globals ---\n")
+		for i, value := range vm.Globals {
+			name, ok := vm.GlobalNames[i]
+			if !ok {
+				name = fmt.Sprintf("global[%d]", i)
+			}
+			variablesContent += fmt.Sprintf("%s: %v\n", name, value)
 		}
 	}
 	return variablesContent
@@ -4,21 +4,31 @@ import (
 	"alna-lang/internal/analyzer"
 	"alna-lang/internal/ast"
 	"alna-lang/internal/codegen"
+	"alna-lang/internal/common"
 	"alna-lang/internal/disassembler"
 	"alna-lang/internal/lexer"
+	"alna-lang/internal/loader"
 	"alna-lang/internal/logger"
+	"alna-lang/internal/migrate"
 	"alna-lang/internal/parser"
 	"alna-lang/internal/vm"
 	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 )
 
 var verbose = flag.Bool("verbose", false, "print tokens and AST during compilation")
 var disassemble = flag.Bool("disassemble", false, "disassemble bytecode into human-readable format")
 var debug = flag.Bool("tui", false, "run with TUI debugger (generates .alnbc.debug file)")
+var migrateParams = flag.Bool("migrate", false, "rewrite Type name parameters in the source file as name: Type and exit")
+var checked = flag.Bool("checked", false, "trap on int overflow instead of wrapping around")
+var gcStats = flag.Bool("gcstats", false, "print heap statistics when the program ends")
+var gcStress = flag.Bool("gcstress", false, "collect the heap on every allocation")
+var seed = flag.Uint64("seed", 0, "schedule tasks and select cases at random from this seed instead of in order")
 
 func main() {
 	flag.Parse()
@@ -76,8 +86,34 @@ func main() {
 		log.Panicf("Syntax analysis error: %v", err.Error())
 	}
 
+	if *migrateParams {
+		migrated, count := migrate.Parameters(tree, sourceLines)
+		if count > 0 {
+			if err := os.WriteFile(sourceFile, []byte(strings.Join(migrated, "\n")+"\n"), 0644); err != nil {
+				log.Fatalf("Failed to write %s: %v", sourceFile, err)
+			}
+		}
+		fmt.Printf("Migrated %d parameters in %s\n", count, sourceFile)
+		return
+	}
+
+	moduleLoader := loader.NewLoader(lgr.WithStep("loader"))
+	if err := moduleLoader.Resolve(&tree, sourceFile); err != nil {
+		log.Panicf("Include error: %v", err.Error())
+	}
+
 	semantic := analyzer.NewAnalyzer(&tree, sourceLines, lgr.WithStep("analyzer"))
-	semantic.Analyze()
+	if err := semantic.Analyze(); err != nil {
+		log.Panicf("Semantic analysis error: %v", err.Error())
+	}
+
+	// Warnings in included modules would be shown with the wrong source
+	includedFunctions := moduleLoader.FunctionFiles()
+	for _, warning := range semantic.Warnings {
+		if _, included := includedFunctions[warning.Function]; !included {
+			fmt.Fprint(os.Stderr, common.CompilerWarning(warning.Position, warning.Message, sourceLines))
+		}
+	}
 
 	if *verbose {
 		fmt.Println("\n=== SYMBOL TABLE ===")
@@ -86,6 +122,7 @@ func main() {
 
 	codegen := codegen.NewCodeGenerator(tree, sourceLines, semantic.SymbolTable, lgr.WithStep("codegen"))
 
+	codegen.SetSourceFiles(sourceFile, moduleLoader.FunctionFiles())
 	if *debug {
 		codegen.SetDebugMode(sourceFile)
 	}
@@ -111,20 +148,31 @@ func main() {
 		}
 	}
 
-	vm := vm.NewVM(codegen.Bytecode, sourceLines, *debug, lgr.WithStep("vm"))
+	machine := vm.NewVM(codegen.Bytecode, sourceLines, *debug, lgr.WithStep("vm"))
+	machine.CheckOverflow = *checked
+	machine.GCStress = *gcStress
+	machine.Seed = *seed
 
 	if *debug {
-		if err := vm.LoadDebugFile("out.alnac.debug"); err != nil {
+		if err := machine.LoadDebugFile("out.alnac.debug"); err != nil {
 			log.Fatalf("Failed to load debug file: %v", err)
 		}
 	}
 
-	err = vm.CheckHeader()
+	err = machine.CheckHeader()
 	if err != nil {
 		log.Panicf("VM header check failed: %v", err.Error())
 	}
 
-	err = vm.Run()
+	err = machine.Run()
+	if *gcStats {
+		fmt.Fprintf(os.Stderr, "gc: %s\n", machine.HeapStats())
+	}
+	var runtimeErr *vm.RuntimeError
+	if errors.As(err, &runtimeErr) {
+		fmt.Fprintln(os.Stderr, runtimeErr)
+		os.Exit(1)
+	}
 	if err != nil {
 		log.Panicf("VM runtime error: %v", err.Error())
 	}
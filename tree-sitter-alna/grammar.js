@@ -8,6 +8,11 @@ module.exports = grammar({
 
   conflicts: $ => [
     [$._expression, $.function_call],
+    [$.function_call, $.function_declaration],
+    [$._expression, $.parameter],
+    [$._expression, $.type],
+    [$.function_call, $.type],
+    [$.function_declaration, $.type],
   ],
 
   rules: {
@@ -112,12 +117,27 @@ module.exports = grammar({
       repeat(seq(',', $._expression))
     ),
 
+    // The return type is written before the name, after the parameters
+    // following ->, or left out for void functions
     function_declaration: $ => seq(
-      field('return_type', $.type),
-      field('name', $.identifier),
-      '(',
-      optional($.parameter_list),
-      ')',
+      choice(
+        seq(
+          field('return_type', $.type),
+          field('name', $.identifier),
+          optional($.type_parameters),
+          '(',
+          optional($.parameter_list),
+          ')',
+        ),
+        seq(
+          field('name', $.identifier),
+          optional($.type_parameters),
+          '(',
+          optional($.parameter_list),
+          ')',
+          optional(seq('->', field('return_type', $.type))),
+        ),
+      ),
       field('body', $.block)
     ),
 
@@ -127,11 +147,34 @@ module.exports = grammar({
     ),
 
     parameter: $ => seq(
-      field('type', $.type),
-      field('name', $.identifier)
+      choice(
+        seq(field('name', $.identifier), ':', field('type', $.type)),
+        seq(field('type', $.type), field('name', $.identifier)),
+      ),
+      optional(seq('=', field('default', $._expression)))
     ),
 
-    type: $ => choice(
+    type_parameters: $ => seq(
+      '<',
+      $.identifier,
+      repeat(seq(',', $.identifier)),
+      '>'
+    ),
+
+    // Names other than the builtin types refer to type parameters, and a
+    // trailing ? makes any type optional
+    type: $ => seq(
+      choice(
+        $._primitive_type,
+        $.generic_type,
+        $.function_type,
+        $.tuple_type,
+        field('name', $.identifier),
+      ),
+      optional(field('optional', '?'))
+    ),
+
+    _primitive_type: $ => choice(
       'int',
       'i8',
       'i16',
@@ -149,6 +192,35 @@ module.exports = grammar({
       'void'
     ),
 
+    generic_type: $ => seq(
+      field('name', choice('array', 'map', 'chan', 'gen', 'Result')),
+      $.type_arguments
+    ),
+
+    type_arguments: $ => seq(
+      '<',
+      $.type,
+      repeat(seq(',', $.type)),
+      '>'
+    ),
+
+    // A function type without a return type is void
+    function_type: $ => prec.right(seq(
+      'fn',
+      '(',
+      optional(seq($.type, repeat(seq(',', $.type)))),
+      ')',
+      optional(field('return_type', $.type))
+    )),
+
+    // The types of the values a function returns together
+    tuple_type: $ => seq(
+      '(',
+      $.type,
+      repeat1(seq(',', $.type)),
+      ')'
+    ),
+
     identifier: $ => /[a-zA-Z_][a-zA-Z0-9_]*/,
 
     number: $ => token(choice(